@@ -0,0 +1,56 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package datetime_prefix
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/couchbaselabs/cbfullofit/analysis"
+	"github.com/couchbaselabs/cbfullofit/analysis/tokenizers/numeric_prefix"
+)
+
+// DEFAULT_LAYOUTS are tried in order when a field does not list
+// its own layouts
+var DEFAULT_LAYOUTS = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// DateTimePrefixTokenizer turns a JSON string holding a date/time
+// in one of the layouts into the prefix coded terms of its Unix
+// time in nanoseconds, anything else produces no tokens
+type DateTimePrefixTokenizer struct {
+	layouts []string
+}
+
+func NewDateTimePrefixTokenizer(layouts []string) *DateTimePrefixTokenizer {
+	if len(layouts) == 0 {
+		layouts = DEFAULT_LAYOUTS
+	}
+	return &DateTimePrefixTokenizer{
+		layouts: layouts,
+	}
+}
+
+func (t *DateTimePrefixTokenizer) Tokenize(input []byte) analysis.TokenStream {
+	var value string
+	err := json.Unmarshal(input, &value)
+	if err != nil {
+		return analysis.TokenStream{}
+	}
+	for _, layout := range t.layouts {
+		parsed, err := time.Parse(layout, value)
+		if err == nil {
+			return numeric_prefix.Tokens(parsed.UnixNano(), len(input))
+		}
+	}
+	return analysis.TokenStream{}
+}
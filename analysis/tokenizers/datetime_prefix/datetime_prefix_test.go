@@ -0,0 +1,73 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package datetime_prefix
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/couchbaselabs/cbfullofit/analysis"
+	"github.com/couchbaselabs/cbfullofit/analysis/tokenizers/numeric_prefix"
+)
+
+func TestDateTimePrefixTokenizer(t *testing.T) {
+
+	christmas := time.Date(2013, time.December, 25, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		layouts []string
+		input   []byte
+		output  analysis.TokenStream
+	}{
+		{
+			nil,
+			[]byte(`"2013-12-25T00:00:00Z"`),
+			numeric_prefix.Tokens(christmas.UnixNano(), 22),
+		},
+		{
+			nil,
+			[]byte(`"2013-12-25T01:00:00+01:00"`),
+			numeric_prefix.Tokens(christmas.UnixNano(), 27),
+		},
+		{
+			nil,
+			[]byte(`"2013-12-25"`),
+			numeric_prefix.Tokens(christmas.UnixNano(), 12),
+		},
+		{
+			[]string{"02/01/2006"},
+			[]byte(`"25/12/2013"`),
+			numeric_prefix.Tokens(christmas.UnixNano(), 12),
+		},
+		{
+			[]string{"02/01/2006"},
+			[]byte(`"2013-12-25"`),
+			analysis.TokenStream{},
+		},
+		{
+			nil,
+			[]byte(`"christmas"`),
+			analysis.TokenStream{},
+		},
+		{
+			nil,
+			[]byte(`20131225`),
+			analysis.TokenStream{},
+		},
+	}
+
+	for _, test := range tests {
+		actual := NewDateTimePrefixTokenizer(test.layouts).Tokenize(test.input)
+
+		if !reflect.DeepEqual(actual, test.output) {
+			t.Errorf("Expected %v, got %v for %s", test.output, actual, string(test.input))
+		}
+	}
+}
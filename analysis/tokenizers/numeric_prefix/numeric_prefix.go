@@ -0,0 +1,50 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package numeric_prefix
+
+import (
+	"encoding/json"
+
+	"github.com/couchbaselabs/cbfullofit/analysis"
+	"github.com/couchbaselabs/cbfullofit/numeric"
+)
+
+// NumericPrefixTokenizer turns a JSON number into its prefix coded
+// terms, anything else produces no tokens
+type NumericPrefixTokenizer struct {
+}
+
+func NewNumericPrefixTokenizer() *NumericPrefixTokenizer {
+	return &NumericPrefixTokenizer{}
+}
+
+func (t *NumericPrefixTokenizer) Tokenize(input []byte) analysis.TokenStream {
+	var value float64
+	err := json.Unmarshal(input, &value)
+	if err != nil {
+		return analysis.TokenStream{}
+	}
+	return Tokens(numeric.Float64ToInt64(value), len(input))
+}
+
+// Tokens are the prefix coded terms of the value, all at the
+// same position spanning the original input
+func Tokens(value int64, inputLength int) analysis.TokenStream {
+	terms := numeric.Terms(value)
+	rv := make(analysis.TokenStream, len(terms))
+	for i, term := range terms {
+		rv[i] = &analysis.Token{
+			Term:     term,
+			Position: 1,
+			Start:    0,
+			End:      inputLength,
+		}
+	}
+	return rv
+}
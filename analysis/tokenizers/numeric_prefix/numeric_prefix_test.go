@@ -0,0 +1,63 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package numeric_prefix
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/couchbaselabs/cbfullofit/analysis"
+	"github.com/couchbaselabs/cbfullofit/numeric"
+)
+
+func TestNumericPrefixTokenizer(t *testing.T) {
+
+	tests := []struct {
+		input  []byte
+		output analysis.TokenStream
+	}{
+		{
+			[]byte("3.5"),
+			Tokens(numeric.Float64ToInt64(3.5), 3),
+		},
+		{
+			[]byte("-12"),
+			Tokens(numeric.Float64ToInt64(-12), 3),
+		},
+		{
+			[]byte(`"3.5"`),
+			analysis.TokenStream{},
+		},
+		{
+			nil,
+			analysis.TokenStream{},
+		},
+	}
+
+	tokenizer := NewNumericPrefixTokenizer()
+	for _, test := range tests {
+		actual := tokenizer.Tokenize(test.input)
+
+		if !reflect.DeepEqual(actual, test.output) {
+			t.Errorf("Expected %v, got %v for %s", test.output, actual, string(test.input))
+		}
+	}
+
+	tokens := tokenizer.Tokenize([]byte("7"))
+	if len(tokens) != 64/int(numeric.PRECISION_STEP) {
+		t.Errorf("expected a token for each precision step, got %d", len(tokens))
+	}
+	value, err := numeric.PrefixCoded(tokens[0].Term).Int64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if numeric.Int64ToFloat64(value) != 7 {
+		t.Errorf("expected the full precision term to decode to 7, got %v", numeric.Int64ToFloat64(value))
+	}
+}
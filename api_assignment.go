@@ -44,10 +44,42 @@ func nodesAssignedToIndex(index string) ([]string, error) {
 	return rv, nil
 }
 
+// Assignment makes a node index an index, or only the partition of
+// it in vbucket ranges like 0-255,512-767. Nodes assigned the same partition
+// hold copies of each other.
 type Assignment struct {
-	Index string `json:"index"`
-	Node  string `json:"node"`
-	Type  string `json:"type"`
+	Index     string `json:"index"`
+	Node      string `json:"node"`
+	Partition string `json:"partition,omitempty"`
+	Type      string `json:"type"`
+}
+
+// partitionsAssignedToIndex lists the assignments of the index
+// along with the partition each node holds
+func partitionsAssignedToIndex(index string) ([]*Assignment, error) {
+	viewResult := struct {
+		Rows []struct {
+			Value struct {
+				Node      string `json:"node"`
+				Partition string `json:"partition"`
+			} `json:"value"`
+		} `json:"rows"`
+	}{}
+
+	err := db.ViewCustom(ddoc, "partitionsByIndex", map[string]interface{}{"key": index, "stale": false}, &viewResult)
+	if err != nil {
+		return nil, err
+	}
+	rv := make([]*Assignment, len(viewResult.Rows))
+	for i, row := range viewResult.Rows {
+		rv[i] = &Assignment{
+			Index:     index,
+			Node:      row.Value.Node,
+			Partition: row.Value.Partition,
+			Type:      "assignment",
+		}
+	}
+	return rv, nil
 }
 
 func assignNodeToIndex(w http.ResponseWriter, r *http.Request) {
@@ -73,6 +105,12 @@ func assignNodeToIndex(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	err = rebalanceIndex(indexName, nodeName)
+	if err != nil {
+		showError(w, r, fmt.Sprintf("error rebalancing index: %v", err), 500)
+		return
+	}
+
 	mustEncode(w, assignment)
 }
 
@@ -90,6 +128,12 @@ func unAssignNodeToIndex(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	err = rebalanceIndex(indexName, "")
+	if err != nil {
+		showError(w, r, fmt.Sprintf("error rebalancing index: %v", err), 500)
+		return
+	}
+
 	mustEncode(w, "ok")
 }
 
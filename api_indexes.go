@@ -9,13 +9,17 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"time"
 
+	"github.com/couchbaselabs/cbfullofit/analysis"
 	"github.com/couchbaselabs/cbfullofit/search"
+	"github.com/couchbaselabs/cbfullofit/search/highlight"
 	"github.com/couchbaselabs/go-couchbase"
 	"github.com/gorilla/mux"
 )
@@ -58,10 +62,15 @@ func indexList(serv string) ([]string, error) {
 }
 
 type Index struct {
-	Name   string           `json:"name"`
-	Type   string           `json:"type"`
-	Bucket string           `json:"bucket"`
-	Schema map[string]Field `json:"schema"`
+	Name       string                   `json:"name"`
+	Type       string                   `json:"type"`
+	Bucket     string                   `json:"bucket"`
+	Schema     map[string]Field         `json:"schema"`
+	Similarity *search.SimilarityConfig `json:"similarity,omitempty"`
+	// with a type discriminator only the types with a mapping are
+	// indexed, with the schema fields and those of their mapping
+	TypeDiscriminator *TypeDiscriminator      `json:"type_discriminator,omitempty"`
+	Mappings          map[string]*TypeMapping `json:"mappings,omitempty"`
 }
 
 func createIndex(w http.ResponseWriter, r *http.Request) {
@@ -101,6 +110,29 @@ func createIndex(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// assert that the similarity is valid
+	_, err = index.Similarity.Similarity()
+	if err != nil {
+		showError(w, r, fmt.Sprintf("error validating similarity: %v", err), 400)
+		return
+	}
+
+	// assert that the schema fields are valid
+	for fieldName, field := range index.Schema {
+		err = field.Validate()
+		if err != nil {
+			showError(w, r, fmt.Sprintf("error validating field '%s': %v", fieldName, err), 400)
+			return
+		}
+	}
+
+	// assert that the type mappings are valid
+	err = index.ValidateMappings()
+	if err != nil {
+		showError(w, r, fmt.Sprintf("error validating mappings: %v", err), 400)
+		return
+	}
+
 	added, err := db.Add("index_"+indexName, 0, index)
 	if err != nil {
 		showError(w, r, err.Error(), 500)
@@ -151,6 +183,48 @@ func getIndexDoc(indexName string) (*Index, error) {
 	return &index, nil
 }
 
+// indexStatus reports the progress of the indexer of this node
+func indexStatus(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	indexName := vars["index"]
+
+	indexer, ok := assignments[indexName]
+	if !ok {
+		showError(w, r, fmt.Sprintf("index '%s' is not assigned to this node", indexName), 404)
+		return
+	}
+
+	mustEncode(w, indexer.Status())
+}
+
+// IndexErrors lists the latest documents this node failed to index
+type IndexErrors struct {
+	Index  string      `json:"index"`
+	Node   string      `json:"node"`
+	Total  uint64      `json:"total"`
+	Errors []*DocError `json:"errors"`
+}
+
+func indexErrors(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	indexName := vars["index"]
+
+	indexer, ok := assignments[indexName]
+	if !ok {
+		showError(w, r, fmt.Sprintf("index '%s' is not assigned to this node", indexName), 404)
+		return
+	}
+
+	mustEncode(w, IndexErrors{
+		Index:  indexName,
+		Node:   nodeID,
+		Total:  indexer.Status().DocErrors,
+		Errors: indexer.Errors(),
+	})
+}
+
 func searchIndexTerm(w http.ResponseWriter, r *http.Request) {
 
 	vars := mux.Vars(r)
@@ -174,13 +248,19 @@ func searchIndexTerm(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Printf("query: %#v", tq)
 
+	similarity, err := indexer.similarity.Similarity()
+	if err != nil {
+		showError(w, r, fmt.Sprintf("similarity error: %v", err), 500)
+		return
+	}
+
 	collector := search.NewTopScorerCollector(10)
-	searcher, err := tq.Searcher(indexer.index)
+	searcher, err := tq.Searcher(r.Context(), indexer.index, similarity)
 	if err != nil {
 		showError(w, r, fmt.Sprintf("searcher error: %v", err), 500)
 		return
 	}
-	err = collector.Collect(searcher)
+	err = collector.Collect(r.Context(), searcher)
 	if err != nil {
 		showError(w, r, fmt.Sprintf("search error: %v", err), 500)
 		return
@@ -203,16 +283,151 @@ func searchIndexTerm(w http.ResponseWriter, r *http.Request) {
 }
 
 type SearchRequest struct {
-	Q       search.Query `json:"query"`
-	Size    float64      `json:"size"`
-	Explain bool         `json:"explain"`
+	Q           search.Query             `json:"query"`
+	Size        float64                  `json:"size"`
+	From        float64                  `json:"from,omitempty"`
+	Explain     bool                     `json:"explain"`
+	Similarity  *search.SimilarityConfig `json:"similarity,omitempty"`
+	Fields      []string                 `json:"fields,omitempty"`
+	Highlight   *HighlightRequest        `json:"highlight,omitempty"`
+	Facets      map[string]*FacetRequest `json:"facets,omitempty"`
+	Sort        []string                 `json:"sort,omitempty"`
+	SearchAfter *search.SearchAfter      `json:"search_after,omitempty"`
+	Timeout     string                   `json:"timeout,omitempty"`
+}
+
+type SearchResponse struct {
+	MaxScore    float64                        `json:"max_score"`
+	TotalHits   uint64                         `json:"total_hits"`
+	Took        float64                        `json:"took"`
+	Hits        search.DocumentMatchCollection `json:"hits"`
+	Facets      search.FacetResults            `json:"facets,omitempty"`
+	TimedOut    bool                           `json:"timed_out"`
+	SearchAfter *search.SearchAfter            `json:"search_after,omitempty"`
+}
+
+type HighlightRequest struct {
+	Style      string   `json:"style"`
+	Fragmenter string   `json:"fragmenter"`
+	Fields     []string `json:"fields"`
+}
+
+const DEFAULT_FACET_SIZE = 10
+
+// FacetRequest asks for the size most frequent terms of the field
+// among all the matching documents, or for the number of values in
+// each of the numeric or date ranges
+type FacetRequest struct {
+	Field         string                 `json:"field"`
+	Size          int                    `json:"size,omitempty"`
+	NumericRanges []*NumericRangeRequest `json:"numeric_ranges,omitempty"`
+	DateRanges    []*DateRangeRequest    `json:"date_ranges,omitempty"`
+}
+
+// NumericRangeRequest is a range from Min up to but excluding Max
+type NumericRangeRequest struct {
+	Name string   `json:"name"`
+	Min  *float64 `json:"min,omitempty"`
+	Max  *float64 `json:"max,omitempty"`
+}
+
+// DateRangeRequest is a range from Start up to but excluding End,
+// given in RFC3339 or relative to now like now-7d
+type DateRangeRequest struct {
+	Name  string  `json:"name"`
+	Start *string `json:"start,omitempty"`
+	End   *string `json:"end,omitempty"`
+}
+
+func (fr *FacetRequest) Validate() error {
+	if fr.Field == "" {
+		return fmt.Errorf("facet must specify a field")
+	}
+	if fr.Size < 0 {
+		return fmt.Errorf("facet size must not be negative")
+	}
+	if len(fr.NumericRanges) > 0 && len(fr.DateRanges) > 0 {
+		return fmt.Errorf("facet cannot have both numeric and date ranges")
+	}
+	for _, nr := range fr.NumericRanges {
+		if nr.Name == "" {
+			return fmt.Errorf("numeric range must have a name")
+		}
+		if nr.Min == nil && nr.Max == nil {
+			return fmt.Errorf("numeric range '%s' must specify min or max", nr.Name)
+		}
+		if nr.Min != nil && nr.Max != nil && *nr.Min > *nr.Max {
+			return fmt.Errorf("numeric range '%s' min must not be greater than max", nr.Name)
+		}
+	}
+	_, err := fr.dateRangeBuilder(time.Now())
+	return err
+}
+
+func (fr *FacetRequest) Builder() (search.FacetBuilder, error) {
+	if len(fr.NumericRanges) > 0 {
+		builder := search.NewNumericRangeFacetBuilder(fr.Field)
+		for _, nr := range fr.NumericRanges {
+			builder.AddRange(nr.Name, nr.Min, nr.Max)
+		}
+		return builder, nil
+	}
+	if len(fr.DateRanges) > 0 {
+		return fr.dateRangeBuilder(time.Now())
+	}
+	size := fr.Size
+	if size == 0 {
+		size = DEFAULT_FACET_SIZE
+	}
+	return search.NewTermsFacetBuilder(fr.Field, size), nil
+}
+
+// dateRangeBuilder resolves the date ranges relative to now
+func (fr *FacetRequest) dateRangeBuilder(now time.Time) (*search.DateRangeFacetBuilder, error) {
+	builder := search.NewDateRangeFacetBuilder(fr.Field)
+	for _, dr := range fr.DateRanges {
+		if dr.Name == "" {
+			return nil, fmt.Errorf("date range must have a name")
+		}
+		if dr.Start == nil && dr.End == nil {
+			return nil, fmt.Errorf("date range '%s' must specify start or end", dr.Name)
+		}
+		var start, end *time.Time
+		if dr.Start != nil {
+			t, err := search.ParseDateTime(*dr.Start, now)
+			if err != nil {
+				return nil, fmt.Errorf("date range '%s': %v", dr.Name, err)
+			}
+			start = &t
+		}
+		if dr.End != nil {
+			t, err := search.ParseDateTime(*dr.End, now)
+			if err != nil {
+				return nil, fmt.Errorf("date range '%s': %v", dr.Name, err)
+			}
+			end = &t
+		}
+		if start != nil && end != nil && start.After(*end) {
+			return nil, fmt.Errorf("date range '%s' start must not be after end", dr.Name)
+		}
+		builder.AddRange(dr.Name, start, end)
+	}
+	return builder, nil
 }
 
 func (r *SearchRequest) UnmarshalJSON(input []byte) error {
 	var temp struct {
-		Q       json.RawMessage `json:"query"`
-		Size    float64         `json:"size"`
-		Explain bool            `json:"explain"`
+		Q           json.RawMessage          `json:"query"`
+		Size        float64                  `json:"size"`
+		From        float64                  `json:"from"`
+		Explain     bool                     `json:"explain"`
+		Similarity  *search.SimilarityConfig `json:"similarity"`
+		Fields      []string                 `json:"fields"`
+		Highlight   *HighlightRequest        `json:"highlight"`
+		Facets      map[string]*FacetRequest `json:"facets"`
+		Sort        []string                 `json:"sort"`
+		SearchAfter *search.SearchAfter      `json:"search_after"`
+		Timeout     string                   `json:"timeout"`
 	}
 
 	err := json.Unmarshal(input, &temp)
@@ -221,7 +436,15 @@ func (r *SearchRequest) UnmarshalJSON(input []byte) error {
 	}
 
 	r.Size = temp.Size
+	r.From = temp.From
 	r.Explain = temp.Explain
+	r.Similarity = temp.Similarity
+	r.Fields = temp.Fields
+	r.Highlight = temp.Highlight
+	r.Facets = temp.Facets
+	r.Sort = temp.Sort
+	r.SearchAfter = temp.SearchAfter
+	r.Timeout = temp.Timeout
 	r.Q, err = search.ParseQuery(temp.Q)
 	if err != nil {
 		return err
@@ -230,6 +453,13 @@ func (r *SearchRequest) UnmarshalJSON(input []byte) error {
 	if r.Size <= 0 {
 		r.Size = 10
 	}
+	if r.From < 0 {
+		r.From = 0
+	}
+	// collectors keep from+size hits, on every partition
+	if r.From+r.Size > float64(*maxResultWindow) {
+		return fmt.Errorf("from + size must be at most %d, got %v", *maxResultWindow, r.From+r.Size)
+	}
 
 	return nil
 }
@@ -239,13 +469,6 @@ func searchIndex(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	indexName := vars["index"]
 
-	indexer, ok := assignments[indexName]
-	if !ok {
-		// FIXME, redirect to a node that can?
-		showError(w, r, "sorry this node cannot search this index", 500)
-		return
-	}
-
 	requestBody, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		showError(w, r, fmt.Sprintf("error reading request body: %v", err), 500)
@@ -254,10 +477,29 @@ func searchIndex(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("query: %s", string(requestBody))
 
+	// requests forwarded by another node only search this one
+	if r.URL.Query().Get(LOCAL_SEARCH_PARAM) == "" {
+		targets, err := searchTargets(indexName)
+		if err != nil {
+			showError(w, r, fmt.Sprintf("error finding nodes to search: %v", err), 500)
+			return
+		}
+		if len(targets) > 1 || targets[0].Node != nodeID {
+			distributedSearch(w, r, indexName, requestBody, targets)
+			return
+		}
+	}
+
+	indexer, ok := assignments[indexName]
+	if !ok {
+		showError(w, r, "sorry this node cannot search this index", 500)
+		return
+	}
+
 	var sr SearchRequest
 	err = json.Unmarshal(requestBody, &sr)
 	if err != nil {
-		showError(w, r, fmt.Sprintf("error parsing query: %v", err), 500)
+		showError(w, r, fmt.Sprintf("error parsing query: %v", err), 400)
 		return
 	}
 
@@ -267,30 +509,173 @@ func searchIndex(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	collector := search.NewTopScorerCollector(int(sr.Size))
-	searcher, err := sr.Q.Searcher(indexer.index)
+	// the request similarity overrides the one in the index definition
+	similarityConfig := indexer.similarity
+	if sr.Similarity != nil {
+		similarityConfig = sr.Similarity
+	}
+	similarity, err := similarityConfig.Similarity()
 	if err != nil {
+		showError(w, r, fmt.Sprintf("error validating similarity: %v", err), 400)
+		return
+	}
+
+	for name, facetRequest := range sr.Facets {
+		err = facetRequest.Validate()
+		if err != nil {
+			showError(w, r, fmt.Sprintf("error validating facet '%s': %v", name, err), 400)
+			return
+		}
+	}
+
+	var highlighter *highlight.Highlighter
+	if sr.Highlight != nil {
+		highlighter, err = highlight.HighlighterInstance(sr.Highlight.Style, sr.Highlight.Fragmenter)
+		if err != nil {
+			showError(w, r, fmt.Sprintf("error validating highlight: %v", err), 400)
+			return
+		}
+	}
+
+	// the search stops when the client goes away or the timeout expires
+	ctx := r.Context()
+	if sr.Timeout != "" {
+		timeout, err := time.ParseDuration(sr.Timeout)
+		if err != nil || timeout <= 0 {
+			showError(w, r, fmt.Sprintf("error validating timeout: '%s' is not a positive duration", sr.Timeout), 400)
+			return
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	if sr.SearchAfter != nil && len(sr.Sort) > 0 {
+		showError(w, r, "search_after is only supported when sorting by score", 400)
+		return
+	}
+	topScoreCollector := search.NewTopScorerSkipCollector(int(sr.Size), int(sr.From))
+	topScoreCollector.SetSearchAfter(sr.SearchAfter)
+	var collector search.Collector = topScoreCollector
+	if len(sr.Sort) > 0 {
+		sortOrder, err := search.ParseSortOrder(sr.Sort)
+		if err == nil {
+			err = sortOrder.Validate(indexer.index)
+		}
+		if err != nil {
+			showError(w, r, fmt.Sprintf("error validating sort: %v", err), 400)
+			return
+		}
+		collector = search.NewTopNSkipCollector(int(sr.Size), int(sr.From), indexer.index, sortOrder)
+	}
+	var facetsCollector *search.FacetsCollector
+	if len(sr.Facets) > 0 {
+		facetsCollector = search.NewFacetsCollector(collector, indexer.index)
+		for name, facetRequest := range sr.Facets {
+			builder, err := facetRequest.Builder()
+			if err != nil {
+				showError(w, r, fmt.Sprintf("error building facet '%s': %v", name, err), 400)
+				return
+			}
+			facetsCollector.AddFacet(name, builder)
+		}
+		collector = facetsCollector
+	}
+	// expanding terms may already run into the timeout
+	searcher, err := sr.Q.Searcher(ctx, indexer.index, similarity)
+	if err != nil && err != ctx.Err() {
 		showError(w, r, fmt.Sprintf("searcher error: %v", err), 500)
 		return
 	}
-	err = collector.Collect(searcher)
-	if err != nil {
+	timedOut := false
+	if err == nil {
+		err = collector.Collect(ctx, searcher)
+	}
+	if err == context.DeadlineExceeded {
+		// return what was collected so far
+		timedOut = true
+	} else if err == context.Canceled {
+		log.Printf("search of index %s cancelled, client went away", indexName)
+		return
+	} else if err != nil {
 		showError(w, r, fmt.Sprintf("search error: %v", err), 500)
 		return
 	}
 	results := collector.Results()
 
-	fres := struct {
-		MaxScore  float64                        `json:"max_score"`
-		TotalHits uint64                         `json:"total_hits"`
-		Took      float64                        `json:"took"`
-		Hits      search.DocumentMatchCollection `json:"hits"`
-	}{
+	err = search.LoadFields(indexer.index, results, sr.Fields)
+	if err != nil {
+		showError(w, r, fmt.Sprintf("error loading fields: %v", err), 500)
+		return
+	}
+
+	if highlighter != nil {
+		err = highlightResults(indexer, results, highlighter, sr.Highlight.Fields)
+		if err != nil {
+			showError(w, r, fmt.Sprintf("error highlighting results: %v", err), 500)
+			return
+		}
+	}
+
+	fres := SearchResponse{
 		Hits:      results,
 		MaxScore:  collector.MaxScore(),
 		TotalHits: collector.Total(),
 		Took:      collector.Took().Seconds(),
+		TimedOut:  timedOut,
+	}
+	if facetsCollector != nil {
+		fres.Facets = facetsCollector.FacetResults()
+	}
+	if len(results) > 0 && len(sr.Sort) == 0 {
+		fres.SearchAfter = search.NewSearchAfter(results[len(results)-1])
 	}
 
 	mustEncode(w, fres)
 }
+
+const DEFAULT_HIGHLIGHT_FRAGMENTS = 3
+
+// highlightResults adds fragments to each hit for the requested
+// fields, or all fields with term locations if none were requested.
+// Only stored fields indexed with term vectors can be highlighted.
+func highlightResults(indexer *Indexer, results search.DocumentMatchCollection, highlighter *highlight.Highlighter, fields []string) error {
+	for _, hit := range results {
+		if len(hit.Locations) == 0 {
+			continue
+		}
+		stored, err := indexer.index.Document([]byte(hit.ID))
+		if err != nil {
+			return err
+		}
+		for field, _ := range hit.Locations {
+			if len(fields) > 0 && !search.ContainsString(fields, field) {
+				continue
+			}
+			value, ok := stored[field]
+			if !ok {
+				continue
+			}
+			// the term vectors are offsets into the sanitized value
+			schemaField, ok := indexer.schema[field]
+			if !ok || !schemaField.IsText() {
+				continue
+			}
+			analyzer, err := analysis.AnalyzerInstance(schemaField.Analyzer)
+			if err != nil {
+				return err
+			}
+			if analyzer.Sanitizer != nil {
+				value = analyzer.Sanitizer.Sanitize(value)
+			}
+			fragments := highlighter.BestFragmentsInField(hit, field, value, DEFAULT_HIGHLIGHT_FRAGMENTS)
+			if len(fragments) > 0 {
+				if hit.Fragments == nil {
+					hit.Fragments = make(map[string][]string)
+				}
+				hit.Fragments[field] = fragments
+			}
+		}
+	}
+	return nil
+}
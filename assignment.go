@@ -9,6 +9,7 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"time"
 )
@@ -28,7 +29,27 @@ func lookupAssignments(assignments map[string]*Indexer) {
 
 	// look for new assignments
 	for _, indexName := range indexes {
+		partition, err := partitionOfNode(indexName, nodeID)
+		if err != nil {
+			log.Printf("Unable to lookup partition of '%s': %v", indexName, err)
+			continue
+		}
+
 		indexer, ok := assignments[indexName]
+		if ok && indexer.partition != partition {
+			// the new indexer drops the documents of the vbuckets moved
+			// away and builds the ones moved here, the rest resume
+			log.Printf("partition of '%s' moved from '%s' to '%s', restarting", indexName, indexer.partition, partition)
+			indexer.Stop()
+			delete(assignments, indexName)
+			ok = false
+		}
+		if ok && indexer.Stopped() {
+			// the index or feed failed, resume from the checkpoints
+			log.Printf("indexer of '%s' stopped, restarting", indexName)
+			delete(assignments, indexName)
+			ok = false
+		}
 		if !ok {
 			log.Printf("starting new indexer for '%s'", indexName)
 			// start up an indexer
@@ -38,7 +59,11 @@ func lookupAssignments(assignments map[string]*Indexer) {
 				continue
 			}
 
-			indexer = NewIndexer(index.Name, index.Bucket, index.Schema)
+			indexer, err = NewIndexer(index, partition)
+			if err != nil {
+				log.Printf("cannot index '%s': %v", indexName, err)
+				continue
+			}
 			assignments[indexName] = indexer
 			go indexer.Run()
 		}
@@ -59,6 +84,20 @@ OUTER:
 	}
 }
 
+// partitionOfNode is the partition of the index assigned to the node
+func partitionOfNode(indexName, node string) (string, error) {
+	assigned, err := partitionsAssignedToIndex(indexName)
+	if err != nil {
+		return "", err
+	}
+	for _, assignment := range assigned {
+		if assignment.Node == node {
+			return assignment.Partition, nil
+		}
+	}
+	return "", fmt.Errorf("index '%s' is not assigned to node '%s'", indexName, node)
+}
+
 func pollAssignments() {
 
 	lookupAssignments(assignments)
@@ -24,7 +24,7 @@ type viewMarker struct {
 
 const ddoc = "cbfullofit"
 const ddocKey = "/@cbfullofitDdocVersion"
-const ddocVersion = 4
+const ddocVersion = 5
 const designDoc = `
 {
   "views": {
@@ -39,6 +39,9 @@ const designDoc = `
   	},
 	"assignmentsByNode": {
   		"map": "function (doc, meta) { if (doc.type == 'assignment') { emit(doc.node, doc.index);}}"
+  	},
+	"partitionsByIndex": {
+  		"map": "function (doc, meta) { if (doc.type == 'assignment') { emit(doc.index, {node: doc.node, partition: doc.partition || ''});}}"
   	}
   }
 }`
@@ -0,0 +1,76 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// DocError is a document the indexer could not index
+type DocError struct {
+	Key   string    `json:"key"`
+	Error string    `json:"error"`
+	Time  time.Time `json:"time"`
+}
+
+// DeadLetters keeps the most recent document errors of an index, and
+// counts all of them
+type DeadLetters struct {
+	sync.Mutex
+	errors []*DocError
+	// where the next error goes once errors is full
+	next  int
+	count uint64
+}
+
+func NewDeadLetters(max int) *DeadLetters {
+	if max < 1 {
+		max = 1
+	}
+	return &DeadLetters{
+		errors: make([]*DocError, 0, max),
+	}
+}
+
+func (d *DeadLetters) Record(key string, err error) {
+	d.Lock()
+	defer d.Unlock()
+
+	docError := &DocError{
+		Key:   key,
+		Error: err.Error(),
+		Time:  time.Now(),
+	}
+	if len(d.errors) < cap(d.errors) {
+		d.errors = append(d.errors, docError)
+	} else {
+		d.errors[d.next] = docError
+		d.next = (d.next + 1) % len(d.errors)
+	}
+	d.count += 1
+}
+
+// Errors returns the errors kept, oldest first
+func (d *DeadLetters) Errors() []*DocError {
+	d.Lock()
+	defer d.Unlock()
+
+	rv := make([]*DocError, 0, len(d.errors))
+	rv = append(rv, d.errors[d.next:]...)
+	rv = append(rv, d.errors[:d.next]...)
+	return rv
+}
+
+// Count is the number of errors ever recorded
+func (d *DeadLetters) Count() uint64 {
+	d.Lock()
+	defer d.Unlock()
+	return d.count
+}
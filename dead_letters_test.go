@@ -0,0 +1,47 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestDeadLetters(t *testing.T) {
+	tests := []struct {
+		recorded int
+		keys     []string
+	}{
+		{0, []string{}},
+		{2, []string{"0", "1"}},
+		{3, []string{"0", "1", "2"}},
+		{7, []string{"4", "5", "6"}},
+	}
+
+	for _, test := range tests {
+		deadLetters := NewDeadLetters(3)
+		for i := 0; i < test.recorded; i++ {
+			deadLetters.Record(fmt.Sprintf("%d", i), fmt.Errorf("bad doc %d", i))
+		}
+		keys := make([]string, 0)
+		for _, docError := range deadLetters.Errors() {
+			keys = append(keys, docError.Key)
+			if docError.Error != "bad doc "+docError.Key {
+				t.Errorf("expected error of %s to be recorded, got %s", docError.Key, docError.Error)
+			}
+		}
+		if !reflect.DeepEqual(keys, test.keys) {
+			t.Errorf("expected errors of %v after %d, got %v", test.keys, test.recorded, keys)
+		}
+		if deadLetters.Count() != uint64(test.recorded) {
+			t.Errorf("expected count %d, got %d", test.recorded, deadLetters.Count())
+		}
+	}
+}
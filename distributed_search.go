@@ -0,0 +1,259 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/couchbaselabs/cbfullofit/search"
+)
+
+// LOCAL_SEARCH_PARAM marks search requests forwarded by another
+// node, they only search the index on the receiving node
+const LOCAL_SEARCH_PARAM = "local"
+
+// searchTarget is the node searching one partition of an index
+type searchTarget struct {
+	Partition string
+	Node      string
+	URL       string
+}
+
+// searchTargets picks a live node for each partition of the index,
+// preferring this node. A node holding the whole index is enough.
+func searchTargets(indexName string) ([]*searchTarget, error) {
+	assigned, err := partitionsAssignedToIndex(indexName)
+	if err != nil {
+		return nil, err
+	}
+
+	// nodes for each partition, in the order partitions were found
+	partitions := make([]string, 0)
+	nodes := make(map[string][]string)
+	for _, assignment := range assigned {
+		if _, ok := nodes[assignment.Partition]; !ok {
+			partitions = append(partitions, assignment.Partition)
+		}
+		nodes[assignment.Partition] = append(nodes[assignment.Partition], assignment.Node)
+	}
+	if wholeIndex, ok := nodes[""]; ok {
+		partitions = []string{""}
+		nodes = map[string][]string{"": wholeIndex}
+	}
+	if len(partitions) == 0 {
+		return nil, fmt.Errorf("index '%s' is not assigned to any node", indexName)
+	}
+	err = checkPartitions(partitions)
+	if err != nil {
+		return nil, fmt.Errorf("index '%s' is being rebalanced: %v", indexName, err)
+	}
+
+	rv := make([]*searchTarget, 0, len(partitions))
+	for _, partition := range partitions {
+		candidates := nodes[partition]
+		if search.ContainsString(candidates, nodeID) {
+			candidates = append([]string{nodeID}, candidates...)
+		}
+		var target *searchTarget
+		for _, candidate := range candidates {
+			node, err := lookupNode(candidate)
+			if err != nil {
+				log.Printf("skipping node '%s' for index '%s': %v", candidate, indexName, err)
+				continue
+			}
+			target = &searchTarget{
+				Partition: partition,
+				Node:      candidate,
+				URL:       node.URL(),
+			}
+			break
+		}
+		if target == nil {
+			return nil, fmt.Errorf("no live node holds partition '%s' of index '%s'", partition, indexName)
+		}
+		rv = append(rv, target)
+	}
+	return rv, nil
+}
+
+// checkPartitions makes sure the partitions hold every vbucket once,
+// while a rebalance moves vbuckets they may overlap or leave gaps and
+// searching them would count documents twice or miss them
+func checkPartitions(partitions []string) error {
+	var holders [NUM_VBUCKETS]int
+	for _, partition := range partitions {
+		vbuckets, err := ParseVBucketRanges(partition)
+		if err != nil {
+			return err
+		}
+		for _, vbucket := range vbuckets.VBuckets() {
+			holders[vbucket]++
+		}
+	}
+	for vbucket, count := range holders {
+		if count == 0 {
+			return fmt.Errorf("no partition holds vbucket %d", vbucket)
+		}
+		if count > 1 {
+			return fmt.Errorf("%d partitions hold vbucket %d", count, vbucket)
+		}
+	}
+	return nil
+}
+
+// remoteSearchError is a search another node refused or failed
+type remoteSearchError struct {
+	Node string
+	Code int
+	Msg  string
+}
+
+func (e *remoteSearchError) Error() string {
+	return fmt.Sprintf("node '%s' failed to search: %s", e.Node, e.Msg)
+}
+
+// postSearch sends the search request to the node of the target, the
+// request is cancelled along with the one from the client
+func postSearch(r *http.Request, target *searchTarget, indexName string, requestBody []byte) ([]byte, error) {
+	searchURL := fmt.Sprintf("%s/api/index/%s/_search?%s=true", target.URL, url.PathEscape(indexName), LOCAL_SEARCH_PARAM)
+	req, err := http.NewRequest("POST", searchURL, bytes.NewReader(requestBody))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(r.Context())
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	responseBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &remoteSearchError{
+			Node: target.Node,
+			Code: resp.StatusCode,
+			Msg:  string(bytes.TrimSpace(responseBody)),
+		}
+	}
+	return responseBody, nil
+}
+
+// distributedSearch forwards the search to the node holding the index,
+// or when the index is partitioned, searches every partition and
+// merges the best hits of each
+func distributedSearch(w http.ResponseWriter, r *http.Request, indexName string, requestBody []byte, targets []*searchTarget) {
+	if len(targets) == 1 {
+		responseBody, err := postSearch(r, targets[0], indexName, requestBody)
+		if err != nil {
+			showSearchError(w, r, err)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Content-type", "application/json")
+		w.Write(responseBody)
+		return
+	}
+
+	var sr SearchRequest
+	err := json.Unmarshal(requestBody, &sr)
+	if err != nil {
+		showError(w, r, fmt.Sprintf("error parsing query: %v", err), 400)
+		return
+	}
+	if len(sr.Sort) > 0 || len(sr.Facets) > 0 {
+		showError(w, r, "sort and facets are not supported on partitioned indexes", 400)
+		return
+	}
+
+	// each partition returns its best from+size hits, unpaged
+	var partitionRequest map[string]json.RawMessage
+	err = json.Unmarshal(requestBody, &partitionRequest)
+	if err != nil {
+		showError(w, r, fmt.Sprintf("error parsing query: %v", err), 400)
+		return
+	}
+	partitionRequest["from"] = json.RawMessage("0")
+	partitionRequest["size"] = json.RawMessage(fmt.Sprintf("%d", int(sr.From+sr.Size)))
+	partitionRequestBody, err := json.Marshal(partitionRequest)
+	if err != nil {
+		showError(w, r, fmt.Sprintf("error encoding partition query: %v", err), 500)
+		return
+	}
+
+	startTime := time.Now()
+	responses := make([]*SearchResponse, len(targets))
+	errs := make([]error, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target *searchTarget) {
+			defer wg.Done()
+			responseBody, err := postSearch(r, target, indexName, partitionRequestBody)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			var response SearchResponse
+			err = json.Unmarshal(responseBody, &response)
+			if err != nil {
+				errs[i] = fmt.Errorf("error parsing response of node '%s': %v", target.Node, err)
+				return
+			}
+			responses[i] = &response
+		}(i, target)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			showSearchError(w, r, err)
+			return
+		}
+	}
+
+	fres := SearchResponse{}
+	hits := make([]search.DocumentMatchCollection, len(responses))
+	for i, response := range responses {
+		hits[i] = response.Hits
+		fres.TotalHits += response.TotalHits
+		if response.MaxScore > fres.MaxScore {
+			fres.MaxScore = response.MaxScore
+		}
+		fres.TimedOut = fres.TimedOut || response.TimedOut
+	}
+	fres.Hits = search.MergeTopScores(int(sr.Size), int(sr.From), hits...)
+	fres.Took = time.Since(startTime).Seconds()
+	if len(fres.Hits) > 0 {
+		fres.SearchAfter = search.NewSearchAfter(fres.Hits[len(fres.Hits)-1])
+	}
+
+	mustEncode(w, fres)
+}
+
+// showSearchError passes on the status of a node refusing the search
+func showSearchError(w http.ResponseWriter, r *http.Request, err error) {
+	if remoteErr, ok := err.(*remoteSearchError); ok {
+		showError(w, r, remoteErr.Error(), remoteErr.Code)
+		return
+	}
+	showError(w, r, fmt.Sprintf("search error: %v", err), 500)
+}
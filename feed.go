@@ -0,0 +1,102 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/couchbaselabs/cbfullofit/index"
+	"github.com/couchbaselabs/go-couchbase"
+)
+
+type FeedEventType int
+
+const (
+	FEED_MUTATION FeedEventType = iota
+	FEED_DELETION
+	// FEED_SNAPSHOT starts a snapshot of the vbucket from Seq to
+	// SnapEnd, a feed resumed from a change inside it is told about
+	// the whole snapshot
+	FEED_SNAPSHOT
+	// FEED_BACKFILL_END follows the documents the vbucket held when
+	// the feed started
+	FEED_BACKFILL_END
+	// FEED_ROLLBACK follows a failover which lost changes the vbucket
+	// was indexed with, its documents are dropped and streamed again
+	// from the start of its current history
+	FEED_ROLLBACK
+)
+
+// FeedEvent is a change to a document of a vbucket, the feed of the
+// vbucket resumes from Seq of the history VBuuid after a restart
+type FeedEvent struct {
+	Type    FeedEventType
+	VBucket uint16
+	VBuuid  uint64
+	Seq     uint64
+	SnapEnd uint64
+	Key     []byte
+	Value   []byte
+}
+
+// Feed streams the changes to the documents of a bucket
+type Feed interface {
+	Events() <-chan *FeedEvent
+	// Backfilling lists the vbuckets streaming their existing
+	// documents first, each ends with a FEED_BACKFILL_END event
+	Backfilling() []uint16
+	// EstimatedItems roughly counts the documents of the backfill
+	EstimatedItems() uint64
+	Close() error
+}
+
+// FeedStarter starts a feed of the vbuckets of the bucket, each
+// vbucket resumes after its checkpoint, the others backfill
+type FeedStarter func(name string, bucket string, vbuckets VBucketRanges, checkpoints map[uint16]*index.Checkpoint) (Feed, error)
+
+var feedStarters = map[string]FeedStarter{
+	"tap": startTapFeed,
+	"dcp": startDCPFeed,
+}
+
+func lookupFeedStarter(feedType string) (FeedStarter, error) {
+	starter, ok := feedStarters[feedType]
+	if !ok {
+		return nil, fmt.Errorf("No feed named `%s`", feedType)
+	}
+	return starter, nil
+}
+
+// missingCheckpoints lists the vbuckets with nothing to resume from
+func missingCheckpoints(vbuckets VBucketRanges, checkpoints map[uint16]*index.Checkpoint) []uint16 {
+	rv := make([]uint16, 0)
+	for _, vbucket := range vbuckets.VBuckets() {
+		if _, ok := checkpoints[vbucket]; !ok {
+			rv = append(rv, vbucket)
+		}
+	}
+	return rv
+}
+
+// estimateItems guesses how many documents the vbuckets hold from the
+// item count of the bucket, assuming they are spread evenly
+func estimateItems(bucket *couchbase.Bucket, vbuckets []uint16) uint64 {
+	var total uint64
+	for server, stats := range bucket.GetStats("") {
+		items, err := strconv.ParseUint(stats["curr_items"], 10, 64)
+		if err != nil {
+			log.Printf("unable to read item count of '%s': %v", server, err)
+			continue
+		}
+		total += items
+	}
+	return total * uint64(len(vbuckets)) / NUM_VBUCKETS
+}
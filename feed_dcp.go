@@ -0,0 +1,266 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+
+	"github.com/couchbaselabs/cbfullofit/index"
+	"github.com/couchbaselabs/go-couchbase"
+	"github.com/dustin/gomemcached"
+)
+
+const (
+	// DCP_END_OF_STREAM keeps a stream open for live mutations
+	DCP_END_OF_STREAM = math.MaxUint64
+	// DCP_STREAM_END_OK ends a stream which reached its end seqno
+	DCP_STREAM_END_OK = 0
+)
+
+// dcpFeed opens a DCP stream for each vbucket, starting after its
+// checkpoint, within the snapshot the checkpoint was taken in, or at
+// the beginning for vbuckets without one.  Those backfill up to the
+// sequence the vbucket was at when the feed started: the server ends
+// such a stream there even when the change at that sequence was
+// deduplicated or purged, and a live stream is opened in its place.
+// Events carry the vbuuid of the history the stream follows, which a
+// checkpoint must be resumed with.  A stream the server ends early, on
+// a failover or a change of vbucket state, is opened again from the
+// last change it sent.
+type dcpFeed struct {
+	bucket         *couchbase.Bucket
+	feed           *couchbase.UprFeed
+	events         chan *FeedEvent
+	closing        StopChannel
+	backfilling    []uint16
+	highSeqnos     map[uint16]uint64
+	vbuuids        map[uint16]uint64
+	seqs           map[uint16]uint64
+	snapshots      map[uint16][2]uint64
+	estimatedItems uint64
+}
+
+func startDCPFeed(name string, bucket string, vbuckets VBucketRanges, checkpoints map[uint16]*index.Checkpoint) (Feed, error) {
+	bucketDb, err := dbConnect(*cbServ, *cbPool, bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := dcpFeed{
+		bucket:      bucketDb,
+		events:      make(chan *FeedEvent),
+		closing:     make(StopChannel),
+		backfilling: missingCheckpoints(vbuckets, checkpoints),
+		vbuuids:     make(map[uint16]uint64),
+		seqs:        make(map[uint16]uint64),
+		snapshots:   make(map[uint16][2]uint64),
+	}
+	rv.highSeqnos, err = highSeqnos(bucketDb, rv.backfilling)
+	if err != nil {
+		bucketDb.Close()
+		return nil, err
+	}
+	rv.estimatedItems = estimateItems(bucketDb, rv.backfilling)
+
+	rv.feed, err = bucketDb.StartUprFeed(name, 0)
+	if err != nil {
+		bucketDb.Close()
+		return nil, err
+	}
+	for _, vbucket := range vbuckets.VBuckets() {
+		// a checkpoint resumes the history it was taken in, the
+		// server asks for a rollback if that history diverged
+		if checkpoint, ok := checkpoints[vbucket]; ok {
+			rv.vbuuids[vbucket] = checkpoint.VBuuid
+			rv.seqs[vbucket] = checkpoint.Seq
+			rv.snapshots[vbucket] = [2]uint64{checkpoint.SnapStart, checkpoint.SnapEnd}
+		}
+		err = rv.requestStream(vbucket)
+		if err != nil {
+			rv.Close()
+			return nil, err
+		}
+	}
+
+	go rv.run()
+
+	return &rv, nil
+}
+
+// highSeqnos is the last sequence of each vbucket, vbuckets which
+// held nothing or are missing from the stats are left out
+func highSeqnos(bucket *couchbase.Bucket, vbuckets []uint16) (map[uint16]uint64, error) {
+	rv := make(map[uint16]uint64)
+	all := bucket.GetStats("vbucket-seqno")
+	for _, vbucket := range vbuckets {
+		key := fmt.Sprintf("vb_%d:high_seqno", vbucket)
+		for _, stats := range all {
+			value, ok := stats[key]
+			if !ok {
+				continue
+			}
+			seqno, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			if seqno > rv[vbucket] {
+				rv[vbucket] = seqno
+			}
+		}
+	}
+	return rv, nil
+}
+
+// requestStream streams the changes of the vbucket after the last one
+// the feed got, in the history and snapshot it got it in, up to the
+// high sequence of a backfill or on and on
+func (f *dcpFeed) requestStream(vbucket uint16) error {
+	start := f.seqs[vbucket]
+	snapshot := f.snapshots[vbucket]
+	if start < snapshot[0] || start > snapshot[1] {
+		snapshot = [2]uint64{start, start}
+	}
+	var end uint64 = DCP_END_OF_STREAM
+	if highSeqno, ok := f.highSeqnos[vbucket]; ok {
+		end = highSeqno
+	}
+	return f.feed.UprRequestStream(vbucket, vbucket, 0, f.vbuuids[vbucket], start, end, snapshot[0], snapshot[1])
+}
+
+func (f *dcpFeed) run() {
+	defer close(f.events)
+
+	// vbuckets without a high sequence have nothing to backfill
+	for _, vbucket := range f.backfilling {
+		if _, ok := f.highSeqnos[vbucket]; ok {
+			continue
+		}
+		if !f.send(&FeedEvent{Type: FEED_BACKFILL_END, VBucket: vbucket, VBuuid: f.vbuuids[vbucket]}) {
+			return
+		}
+	}
+
+	for dcpEvent := range f.feed.C {
+		event := &FeedEvent{
+			VBucket: dcpEvent.VBucket,
+			VBuuid:  f.vbuuids[dcpEvent.VBucket],
+			Seq:     dcpEvent.Seqno,
+			Key:     dcpEvent.Key,
+			Value:   dcpEvent.Value,
+		}
+		switch dcpEvent.Opcode {
+		case gomemcached.UPR_STREAMREQ:
+			if dcpEvent.Status != gomemcached.ROLLBACK {
+				// the stream follows the latest history of the vbucket
+				if dcpEvent.Status == gomemcached.SUCCESS && dcpEvent.FailoverLog != nil && len(*dcpEvent.FailoverLog) > 0 {
+					f.vbuuids[dcpEvent.VBucket] = (*dcpEvent.FailoverLog)[0][0]
+				}
+				continue
+			}
+			var err error
+			event, err = f.rollback(dcpEvent.VBucket)
+			if err != nil {
+				log.Printf("unable to roll back vbucket %d: %v", dcpEvent.VBucket, err)
+				return
+			}
+		case gomemcached.UPR_MUTATION:
+			event.Type = FEED_MUTATION
+			f.seqs[dcpEvent.VBucket] = dcpEvent.Seqno
+		case gomemcached.UPR_DELETION, gomemcached.UPR_EXPIRATION:
+			event.Type = FEED_DELETION
+			f.seqs[dcpEvent.VBucket] = dcpEvent.Seqno
+		case gomemcached.UPR_SNAPSHOT:
+			event.Type = FEED_SNAPSHOT
+			event.Seq = dcpEvent.SnapstartSeq
+			event.SnapEnd = dcpEvent.SnapendSeq
+			f.snapshots[dcpEvent.VBucket] = [2]uint64{dcpEvent.SnapstartSeq, dcpEvent.SnapendSeq}
+		case gomemcached.UPR_STREAMEND:
+			select {
+			case <-f.closing:
+				return
+			default:
+			}
+			highSeqno, backfilling := f.highSeqnos[dcpEvent.VBucket]
+			if !backfilling || dcpEvent.Flags != DCP_STREAM_END_OK {
+				// ended early, pick up where it left off
+				log.Printf("DCP stream of vbucket %d ended with flags %d, reopening", dcpEvent.VBucket, dcpEvent.Flags)
+				err := f.requestStream(dcpEvent.VBucket)
+				if err != nil {
+					log.Printf("unable to stream vbucket %d: %v", dcpEvent.VBucket, err)
+					return
+				}
+				continue
+			}
+			// the backfill is done, keep streaming from its end
+			delete(f.highSeqnos, dcpEvent.VBucket)
+			f.seqs[dcpEvent.VBucket] = highSeqno
+			err := f.requestStream(dcpEvent.VBucket)
+			if err != nil {
+				log.Printf("unable to stream vbucket %d: %v", dcpEvent.VBucket, err)
+				return
+			}
+			event.Type = FEED_BACKFILL_END
+			event.Seq = highSeqno
+		default:
+			continue
+		}
+
+		if !f.send(event) {
+			return
+		}
+	}
+}
+
+// rollback streams the vbucket again from the start when the server
+// asks to roll back, the documents indexed from the changes it lost
+// cannot be told apart from the others.  The stream follows the
+// current history, its vbuuid arrives with the stream request.
+func (f *dcpFeed) rollback(vbucket uint16) (*FeedEvent, error) {
+	f.vbuuids[vbucket] = 0
+	f.seqs[vbucket] = 0
+	delete(f.snapshots, vbucket)
+	err := f.requestStream(vbucket)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("DCP stream of vbucket %d rolled back to the start", vbucket)
+	return &FeedEvent{Type: FEED_ROLLBACK, VBucket: vbucket}, nil
+}
+
+// send returns false when the feed is closing
+func (f *dcpFeed) send(event *FeedEvent) bool {
+	select {
+	case f.events <- event:
+		return true
+	case <-f.closing:
+		return false
+	}
+}
+
+func (f *dcpFeed) Events() <-chan *FeedEvent {
+	return f.events
+}
+
+func (f *dcpFeed) Backfilling() []uint16 {
+	return f.backfilling
+}
+
+func (f *dcpFeed) EstimatedItems() uint64 {
+	return f.estimatedItems
+}
+
+func (f *dcpFeed) Close() error {
+	close(f.closing)
+	f.feed.Close()
+	f.bucket.Close()
+	return nil
+}
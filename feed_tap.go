@@ -0,0 +1,134 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package main
+
+import (
+	"encoding/binary"
+
+	"github.com/couchbaselabs/cbfullofit/index"
+	"github.com/couchbaselabs/go-couchbase"
+	"github.com/dustin/gomemcached/client"
+)
+
+// gomemcached only asks for a backfill when Backfill is not 0, the
+// value is the date to backfill from so 1 streams every document
+const BACKFILL_ALL = 1
+
+// tapFeed registers its TAP stream under the name of the feed, the
+// server keeps the position of a registered client while it is away
+// and resumes it from the start of the TAP checkpoint it was in.  TAP
+// can't be told where to resume, so the Seq of its events is the id
+// of that TAP checkpoint rather than a mutation sequence, and a saved
+// checkpoint only tells that the vbucket was backfilled.  TAP can't
+// resume vbuckets one by one either, so it backfills all of them
+// unless every one has a checkpoint.
+type tapFeed struct {
+	bucket         *couchbase.Bucket
+	feed           *couchbase.TapFeed
+	events         chan *FeedEvent
+	closing        StopChannel
+	backfilling    []uint16
+	estimatedItems uint64
+}
+
+func startTapFeed(name string, bucket string, vbuckets VBucketRanges, checkpoints map[uint16]*index.Checkpoint) (Feed, error) {
+	bucketDb, err := dbConnect(*cbServ, *cbPool, bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := tapFeed{
+		bucket:      bucketDb,
+		events:      make(chan *FeedEvent),
+		closing:     make(StopChannel),
+		backfilling: make([]uint16, 0),
+	}
+
+	args := memcached.DefaultTapArguments()
+	args.Checkpoint = true
+	args.ClientName = name
+	args.RegisteredClient = true
+	if len(vbuckets.VBuckets()) < NUM_VBUCKETS {
+		args.VBuckets = vbuckets.VBuckets()
+	}
+	if len(missingCheckpoints(vbuckets, checkpoints)) > 0 {
+		args.Backfill = BACKFILL_ALL
+		rv.backfilling = vbuckets.VBuckets()
+		rv.estimatedItems = estimateItems(bucketDb, rv.backfilling)
+	}
+
+	rv.feed, err = bucketDb.StartTapFeed(&args)
+	if err != nil {
+		bucketDb.Close()
+		return nil, err
+	}
+
+	// the checkpoint each vbucket is currently in
+	current := make(map[uint16]uint64)
+	for vbucket, checkpoint := range checkpoints {
+		current[vbucket] = checkpoint.Seq
+	}
+	go rv.run(current)
+
+	return &rv, nil
+}
+
+func (f *tapFeed) run(current map[uint16]uint64) {
+	defer close(f.events)
+
+	for tapEvent := range f.feed.C {
+		event := &FeedEvent{
+			VBucket: tapEvent.VBucket,
+			Key:     tapEvent.Key,
+			Value:   tapEvent.Value,
+		}
+		switch tapEvent.Opcode {
+		case memcached.TapMutation:
+			event.Type = FEED_MUTATION
+		case memcached.TapDeletion:
+			event.Type = FEED_DELETION
+		case memcached.TapCheckpointStart:
+			if len(tapEvent.Value) != 8 {
+				continue
+			}
+			current[tapEvent.VBucket] = binary.BigEndian.Uint64(tapEvent.Value)
+			event.Type = FEED_SNAPSHOT
+		case memcached.TapEndBackfill:
+			event.Type = FEED_BACKFILL_END
+		default:
+			continue
+		}
+		event.Seq = current[tapEvent.VBucket]
+
+		select {
+		case f.events <- event:
+		case <-f.closing:
+			return
+		}
+	}
+}
+
+func (f *tapFeed) Events() <-chan *FeedEvent {
+	return f.events
+}
+
+func (f *tapFeed) Backfilling() []uint16 {
+	return f.backfilling
+}
+
+func (f *tapFeed) EstimatedItems() uint64 {
+	return f.estimatedItems
+}
+
+func (f *tapFeed) Close() error {
+	close(f.closing)
+	err := f.feed.Close()
+	f.bucket.Close()
+	return err
+}
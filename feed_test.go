@@ -0,0 +1,236 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/couchbaselabs/cbfullofit/index"
+)
+
+// memBucket keeps every change made to it, its feeds stand in for a
+// Couchbase server streaming DCP so indexers can be tested end to end
+type memBucket struct {
+	sync.Mutex
+	// failoverLogs lists the vbuuid and first sequence of each
+	// history of a vbucket, newest first
+	failoverLogs map[uint16][][2]uint64
+	seqs         map[uint16]uint64
+	changes      []*FeedEvent
+	feeds        map[*memFeed]bool
+}
+
+func newMemBucket() *memBucket {
+	rv := memBucket{
+		failoverLogs: make(map[uint16][][2]uint64),
+		seqs:         make(map[uint16]uint64),
+		changes:      make([]*FeedEvent, 0),
+		feeds:        make(map[*memFeed]bool),
+	}
+	for vbucket := uint16(0); vbucket < NUM_VBUCKETS; vbucket++ {
+		rv.failoverLogs[vbucket] = [][2]uint64{{0xcb00 + uint64(vbucket), 0}}
+	}
+	return &rv
+}
+
+func (b *memBucket) vbuuid(vbucket uint16) uint64 {
+	return b.failoverLogs[vbucket][0][0]
+}
+
+// failover starts a new history of the vbucket at seq, the changes
+// after it are lost
+func (b *memBucket) failover(vbucket uint16, seq uint64) {
+	b.Lock()
+	defer b.Unlock()
+
+	changes := make([]*FeedEvent, 0, len(b.changes))
+	for _, event := range b.changes {
+		if event.VBucket != vbucket || event.Seq <= seq {
+			changes = append(changes, event)
+		}
+	}
+	b.changes = changes
+	b.seqs[vbucket] = seq
+	b.failoverLogs[vbucket] = append([][2]uint64{{b.vbuuid(vbucket) + NUM_VBUCKETS, seq}}, b.failoverLogs[vbucket]...)
+}
+
+// diverged tells if the checkpoint was taken in a history which went
+// past where the current history of the vbucket left it, or unknown
+func (b *memBucket) diverged(checkpoint *index.Checkpoint) bool {
+	failoverLog := b.failoverLogs[checkpoint.VBucket]
+	for i, entry := range failoverLog {
+		if entry[0] != checkpoint.VBuuid {
+			continue
+		}
+		return i > 0 && checkpoint.Seq > failoverLog[i-1][1]
+	}
+	return checkpoint.Seq > 0
+}
+
+func (b *memBucket) set(key, value string) {
+	b.change(FEED_MUTATION, key, []byte(value))
+}
+
+func (b *memBucket) delete(key string) {
+	b.change(FEED_DELETION, key, nil)
+}
+
+func (b *memBucket) change(eventType FeedEventType, key string, value []byte) {
+	b.Lock()
+	defer b.Unlock()
+
+	vbucket := vbucketOf(key)
+	b.seqs[vbucket] += 1
+	event := &FeedEvent{
+		Type:    eventType,
+		VBucket: vbucket,
+		VBuuid:  b.vbuuid(vbucket),
+		Seq:     b.seqs[vbucket],
+		Key:     []byte(key),
+		Value:   value,
+	}
+	b.changes = append(b.changes, event)
+	// each live change is a snapshot of its own
+	snapshot := &FeedEvent{
+		Type:    FEED_SNAPSHOT,
+		VBucket: vbucket,
+		VBuuid:  event.VBuuid,
+		Seq:     event.Seq,
+		SnapEnd: event.Seq,
+	}
+	for feed, _ := range b.feeds {
+		if feed.vbuckets[vbucket] {
+			feed.events <- snapshot
+			feed.events <- event
+		}
+	}
+}
+
+// startFeed is a FeedStarter replaying the changes after each
+// checkpoint in a single snapshot, then streaming the changes made
+// while it is open.  Like DCP it refuses checkpoints outside their
+// snapshot, and only replays the latest change of each document.  A
+// vbucket whose checkpoint went past its current history is rolled
+// back and replayed from the start.
+func (b *memBucket) startFeed(name string, bucket string, vbuckets VBucketRanges, checkpoints map[uint16]*index.Checkpoint) (Feed, error) {
+	b.Lock()
+	defer b.Unlock()
+
+	for vbucket, checkpoint := range checkpoints {
+		if checkpoint.Seq < checkpoint.SnapStart || checkpoint.Seq > checkpoint.SnapEnd {
+			return nil, fmt.Errorf("checkpoint %d of vbucket %d is outside its snapshot %d-%d", checkpoint.Seq, vbucket, checkpoint.SnapStart, checkpoint.SnapEnd)
+		}
+	}
+
+	rv := memFeed{
+		bucket: b,
+		// buffered so that changes never wait for the indexer
+		events:      make(chan *FeedEvent, len(b.changes)+3*NUM_VBUCKETS+1000),
+		vbuckets:    make(map[uint16]bool),
+		backfilling: missingCheckpoints(vbuckets, checkpoints),
+	}
+	for _, vbucket := range vbuckets.VBuckets() {
+		rv.vbuckets[vbucket] = true
+	}
+	start := make(map[uint16]uint64)
+	for vbucket, checkpoint := range checkpoints {
+		if !rv.vbuckets[vbucket] {
+			continue
+		}
+		if !b.diverged(checkpoint) {
+			start[vbucket] = checkpoint.Seq
+			continue
+		}
+		rv.events <- &FeedEvent{
+			Type:    FEED_ROLLBACK,
+			VBucket: vbucket,
+		}
+	}
+
+	latest := make(map[string]*FeedEvent)
+	replayed := make(map[uint16]bool)
+	for _, event := range b.changes {
+		if rv.vbuckets[event.VBucket] && event.Seq > start[event.VBucket] {
+			latest[string(event.Key)] = event
+			replayed[event.VBucket] = true
+		}
+	}
+	for _, vbucket := range vbuckets.VBuckets() {
+		if replayed[vbucket] {
+			rv.events <- &FeedEvent{
+				Type:    FEED_SNAPSHOT,
+				VBucket: vbucket,
+				VBuuid:  b.vbuuid(vbucket),
+				Seq:     start[vbucket] + 1,
+				SnapEnd: b.seqs[vbucket],
+			}
+		}
+	}
+	for _, event := range b.changes {
+		if latest[string(event.Key)] != event {
+			continue
+		}
+		rv.events <- event
+		if _, ok := checkpoints[event.VBucket]; !ok && event.Type == FEED_MUTATION {
+			rv.estimatedItems += 1
+		}
+	}
+	for _, vbucket := range rv.backfilling {
+		rv.events <- &FeedEvent{
+			Type:    FEED_BACKFILL_END,
+			VBucket: vbucket,
+			VBuuid:  b.vbuuid(vbucket),
+			Seq:     b.seqs[vbucket],
+		}
+	}
+	b.feeds[&rv] = true
+
+	return &rv, nil
+}
+
+// endFeeds closes the open feeds as if the server went away
+func (b *memBucket) endFeeds() {
+	b.Lock()
+	defer b.Unlock()
+	for feed, _ := range b.feeds {
+		delete(b.feeds, feed)
+		close(feed.events)
+	}
+}
+
+type memFeed struct {
+	bucket         *memBucket
+	events         chan *FeedEvent
+	vbuckets       map[uint16]bool
+	backfilling    []uint16
+	estimatedItems uint64
+}
+
+func (f *memFeed) Events() <-chan *FeedEvent {
+	return f.events
+}
+
+func (f *memFeed) Backfilling() []uint16 {
+	return f.backfilling
+}
+
+func (f *memFeed) EstimatedItems() uint64 {
+	return f.estimatedItems
+}
+
+func (f *memFeed) Close() error {
+	f.bucket.Lock()
+	defer f.bucket.Unlock()
+	if f.bucket.feeds[f] {
+		delete(f.bucket.feeds, f)
+		close(f.events)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package index
+
+import (
+	"fmt"
+)
+
+// Batch gathers changes to documents to apply together, a change to a
+// document replaces any earlier change to it in the batch
+type Batch struct {
+	// Docs maps ids to their new contents, nil deletes the document
+	Docs map[string][]byte
+	// Checkpoints maps vbuckets to the sequence they were indexed up
+	// to, nil removes the checkpoint of the vbucket
+	Checkpoints map[uint16]*Checkpoint
+}
+
+func NewBatch() *Batch {
+	return &Batch{
+		Docs:        make(map[string][]byte),
+		Checkpoints: make(map[uint16]*Checkpoint),
+	}
+}
+
+func (b *Batch) Update(id []byte, doc []byte) {
+	if doc == nil {
+		doc = []byte{}
+	}
+	b.Docs[string(id)] = doc
+}
+
+func (b *Batch) Delete(id []byte) {
+	b.Docs[string(id)] = nil
+}
+
+func (b *Batch) SetCheckpoint(checkpoint *Checkpoint) {
+	b.Checkpoints[checkpoint.VBucket] = checkpoint
+}
+
+// RemoveCheckpoint forgets how far the vbucket was indexed
+func (b *Batch) RemoveCheckpoint(vbucket uint16) {
+	b.Checkpoints[vbucket] = nil
+}
+
+// Size is the number of documents the batch changes
+func (b *Batch) Size() int {
+	return len(b.Docs)
+}
+
+func (b *Batch) Reset() {
+	b.Docs = make(map[string][]byte)
+	b.Checkpoints = make(map[uint16]*Checkpoint)
+}
+
+// DocErrors maps the ids of the documents of a batch which could not
+// be indexed to the reason, they are no longer in the index but the
+// rest of the batch was applied
+type DocErrors map[string]error
+
+func (e DocErrors) Error() string {
+	return fmt.Sprintf("%d documents could not be indexed", len(e))
+}
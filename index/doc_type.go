@@ -0,0 +1,46 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package index
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/dustin/go-jsonpointer"
+)
+
+// TypeDiscriminator tells the type of a document, from the string at
+// Path in the document or from the key up to the first KeyDelimiter
+type TypeDiscriminator struct {
+	Path         string
+	KeyDelimiter string
+}
+
+// DocType returns the type of the document, empty when it has none
+func (d *TypeDiscriminator) DocType(key, doc []byte) (string, error) {
+	if d.KeyDelimiter != "" {
+		end := bytes.Index(key, []byte(d.KeyDelimiter))
+		if end < 0 {
+			return "", nil
+		}
+		return string(key[:end]), nil
+	}
+
+	value, err := jsonpointer.Find(doc, d.Path)
+	if err != nil || value == nil {
+		return "", err
+	}
+	var rv string
+	err = json.Unmarshal(value, &rv)
+	if err != nil {
+		// only strings name types
+		return "", nil
+	}
+	return rv, nil
+}
@@ -9,7 +9,13 @@
 package index
 
 import (
+	"encoding/json"
 	"fmt"
+
+	"github.com/couchbaselabs/cbfullofit/analysis"
+	"github.com/couchbaselabs/cbfullofit/analysis/tokenizers/datetime_prefix"
+	"github.com/couchbaselabs/cbfullofit/analysis/tokenizers/numeric_prefix"
+	"github.com/couchbaselabs/cbfullofit/numeric"
 )
 
 type Index interface {
@@ -19,11 +25,69 @@ type Index interface {
 	Update(id []byte, doc []byte) error
 	Delete(id []byte) error
 
+	// UpdateWithCheckpoint and DeleteWithCheckpoint also record how
+	// far the feed was indexed, atomically with the document change
+	UpdateWithCheckpoint(id []byte, doc []byte, checkpoint *Checkpoint) error
+	DeleteWithCheckpoint(id []byte, checkpoint *Checkpoint) error
+
+	// Batch applies the changes of the batch in one write, documents
+	// which fail to index are removed and returned as DocErrors
+	Batch(batch *Batch) error
+
+	// SetCheckpoint records a checkpoint without changing a document
+	SetCheckpoint(checkpoint *Checkpoint) error
+	// Checkpoints returns the last checkpoint recorded for each vbucket
+	Checkpoints() ([]*Checkpoint, error)
+
 	TermFieldReader(term []byte, field string) (TermFieldReader, error)
 
+	// FieldDict enumerates the terms of the named field between
+	// start and end inclusive, an empty end means no upper bound.
+	// Terms are not guaranteed to be returned in order.
+	FieldDict(field string, start, end []byte) (FieldDict, error)
+
+	// FieldLength returns the number of terms indexed for the
+	// named field of the document, norms are computed from it
+	FieldLength(id []byte, field string) (uint64, error)
+	// AvgFieldLength returns the mean FieldLength of the
+	// named field across all documents in the index
+	AvgFieldLength(field string) (float64, error)
+
 	DocCount() uint64
+	// DocIDs lists the ids of the documents in the index accepted by
+	// match, all of them if match is nil
+	DocIDs(match func(id []byte) bool) ([]string, error)
+
+	// Fields returns the schema the index was built with
+	Fields() []*Field
+
+	// Document returns the stored field values of the document
+	// as raw JSON keyed by field name, nil if it does not exist
+	Document(id []byte) (map[string][]byte, error)
+
+	// DocumentFieldTerms returns the terms indexed for each field
+	// of the document, nil if it does not exist
+	DocumentFieldTerms(id []byte) (FieldTerms, error)
+
+	// SortValue returns the bytes documents are ordered by for the
+	// named sortable field, nil if the document has no value for it
+	SortValue(id []byte, field string) ([]byte, error)
+}
+
+// Checkpoint is the sequence the feed of a vbucket was indexed up to,
+// VBuuid names the history of the vbucket the sequence belongs to and
+// SnapStart to SnapEnd the snapshot of the feed holding the sequence
+type Checkpoint struct {
+	VBucket   uint16
+	VBuuid    uint64
+	Seq       uint64
+	SnapStart uint64
+	SnapEnd   uint64
 }
 
+// FieldTerms maps field names to the terms indexed for the field
+type FieldTerms map[string][]string
+
 type TermFieldVector struct {
 	Field string
 	Pos   uint64
@@ -34,7 +98,6 @@ type TermFieldVector struct {
 type TermFieldDoc struct {
 	ID      string
 	Freq    uint64
-	Norm    float64
 	Vectors []*TermFieldVector
 }
 
@@ -45,13 +108,82 @@ type TermFieldReader interface {
 	Close()
 }
 
+type DictEntry struct {
+	Term  string
+	Count uint64
+}
+
+type FieldDict interface {
+	Next() (*DictEntry, error)
+	Close()
+}
+
+// field types, an empty type is text
+const (
+	TEXT_FIELD     = "text"
+	NUMERIC_FIELD  = "numeric"
+	DATETIME_FIELD = "datetime"
+)
+
 type Field struct {
 	Name               string
 	Path               string
+	Type               string
 	Analyzer           string
 	IncludeTermVectors bool
+	Store              bool
+	// Sortable fields keep the value each document sorts by
+	Sortable bool
+	// DateTimeLayouts parse the values of datetime fields,
+	// the first layout accepting a value is used
+	DateTimeLayouts []string
+}
+
+// NewAnalyzer builds the analyzer turning values of the field into
+// terms, numeric and datetime fields are indexed as prefix coded
+// terms, datetimes as nanoseconds since the Unix epoch
+func (f *Field) NewAnalyzer() (*analysis.Analyzer, error) {
+	switch f.Type {
+	case "", TEXT_FIELD:
+		return analysis.AnalyzerInstance(f.Analyzer)
+	case NUMERIC_FIELD:
+		return &analysis.Analyzer{
+			Tokenizer: numeric_prefix.NewNumericPrefixTokenizer(),
+		}, nil
+	case DATETIME_FIELD:
+		return &analysis.Analyzer{
+			Tokenizer: datetime_prefix.NewDateTimePrefixTokenizer(f.DateTimeLayouts),
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown field type '%s'", f.Type)
+}
+
+// SortValue picks the bytes ordering documents by the field from
+// its raw JSON value and the tokens analyzed from it. Numeric and
+// datetime fields sort by their full precision prefix coded term,
+// text fields by the unanalyzed string. It is nil when there is
+// nothing to sort by, or the field isn't sortable.
+func (f *Field) SortValue(value []byte, tokens analysis.TokenStream) []byte {
+	if !f.Sortable {
+		return nil
+	}
+	switch f.Type {
+	case NUMERIC_FIELD, DATETIME_FIELD:
+		for _, token := range tokens {
+			if len(token.Term) > 0 && token.Term[0] == numeric.SHIFT_START_INT64 {
+				return token.Term
+			}
+		}
+	default:
+		var s string
+		err := json.Unmarshal(value, &s)
+		if err == nil {
+			return []byte(s)
+		}
+	}
+	return nil
 }
 
 func (f *Field) String() string {
-	return fmt.Sprintf("Field[name=%s, path=%s, analyzer=%s]", f.Name, f.Path, f.Analyzer)
+	return fmt.Sprintf("Field[name=%s, path=%s, type=%s, analyzer=%s, sortable=%t]", f.Name, f.Path, f.Type, f.Analyzer, f.Sortable)
 }
@@ -10,7 +10,7 @@ package mock
 
 import (
 	"encoding/json"
-	"math"
+	"fmt"
 	"sort"
 
 	"github.com/couchbaselabs/cbfullofit/analysis"
@@ -20,7 +20,6 @@ import (
 
 type mockFreq struct {
 	freq    uint64
-	norm    float64
 	vectors []*index.TermFieldVector
 }
 
@@ -42,6 +41,18 @@ type MockIndex struct {
 	// key is docid
 	backIndex map[string]mockBackIndexEntry
 
+	// key is docid, inner key is field name
+	fieldLengths map[string]map[string]uint64
+
+	// key is docid, inner key is field name
+	stored map[string]map[string][]byte
+
+	// key is docid, inner key is field name
+	sortValues map[string]map[string][]byte
+
+	// key is vbucket
+	checkpoints map[uint16]*index.Checkpoint
+
 	docCount uint64
 	analyzer map[string]*analysis.Analyzer
 	schema   []*index.Field
@@ -60,18 +71,22 @@ func NewMockIndexWithDocs(schema []*index.Field, docs map[string]interface{}) *M
 
 func NewMockIndex(schema []*index.Field) *MockIndex {
 	mi := MockIndex{
-		termIndex: make(map[string]mockFieldDocFreq),
-		backIndex: make(map[string]mockBackIndexEntry),
-		analyzer:  make(map[string]*analysis.Analyzer),
-		schema:    schema,
+		termIndex:    make(map[string]mockFieldDocFreq),
+		backIndex:    make(map[string]mockBackIndexEntry),
+		fieldLengths: make(map[string]map[string]uint64),
+		stored:       make(map[string]map[string][]byte),
+		sortValues:   make(map[string]map[string][]byte),
+		checkpoints:  make(map[uint16]*index.Checkpoint),
+		analyzer:     make(map[string]*analysis.Analyzer),
+		schema:       schema,
 	}
 
 	for _, field := range schema {
-		fieldAnalyzer, err := analysis.AnalyzerInstance(field.Analyzer)
+		fieldAnalyzer, err := field.NewAnalyzer()
 		if err != nil {
 			panic("error building analyzer")
 		}
-		mi.analyzer[field.Analyzer] = fieldAnalyzer
+		mi.analyzer[field.Name] = fieldAnalyzer
 	}
 
 	return &mi
@@ -89,21 +104,29 @@ func (index *MockIndex) Update(id []byte, doc []byte) error {
 	index.Delete(id)
 
 	backIndexEntry := make(mockBackIndexEntry, 0)
+	fieldLengths := make(map[string]uint64)
+	stored := make(map[string][]byte)
+	sortValues := make(map[string][]byte)
 	for fieldIndex, field := range index.schema {
 		fieldValue, err := jsonpointer.Find(doc, field.Path)
 		if err != nil {
 			return err
 		}
+		if field.Store && fieldValue != nil {
+			stored[field.Name] = fieldValue
+		}
 
-		analyzer := index.analyzer[field.Analyzer]
+		analyzer := index.analyzer[field.Name]
 		tokens := analyzer.Analyze(fieldValue)
-		fieldLength := len(tokens) // number of tokens in this doc field
-		fieldNorm := 1.0 / math.Sqrt(float64(fieldLength))
+		fieldLengths[field.Name] = uint64(len(tokens)) // number of tokens in this doc field
+		sortValue := field.SortValue(fieldValue, tokens)
+		if sortValue != nil {
+			sortValues[field.Name] = sortValue
+		}
 		tokenFreqs := analysis.TokenFrequency(tokens)
 		for _, tf := range tokenFreqs {
 			mf := mockFreq{
 				freq: uint64(len(tf.Locations)),
-				norm: fieldNorm,
 			}
 			if field.IncludeTermVectors {
 				mf.vectors = index.mockVectorsFromTokenFreq(uint16(fieldIndex), tf)
@@ -125,6 +148,9 @@ func (index *MockIndex) Update(id []byte, doc []byte) error {
 		}
 	}
 	index.backIndex[string(id)] = backIndexEntry
+	index.fieldLengths[string(id)] = fieldLengths
+	index.stored[string(id)] = stored
+	index.sortValues[string(id)] = sortValues
 	index.docCount += 1
 	return nil
 }
@@ -146,12 +172,77 @@ func (index *MockIndex) Delete(id []byte) error {
 			}
 		}
 		delete(index.backIndex, string(id))
+		delete(index.fieldLengths, string(id))
+		delete(index.stored, string(id))
+		delete(index.sortValues, string(id))
 		index.docCount -= 1
 	}
 
 	return nil
 }
 
+func (index *MockIndex) UpdateWithCheckpoint(id []byte, doc []byte, checkpoint *index.Checkpoint) error {
+	err := index.Update(id, doc)
+	if err == nil && checkpoint != nil {
+		index.checkpoints[checkpoint.VBucket] = checkpoint
+	}
+	return err
+}
+
+func (index *MockIndex) DeleteWithCheckpoint(id []byte, checkpoint *index.Checkpoint) error {
+	err := index.Delete(id)
+	if err == nil && checkpoint != nil {
+		index.checkpoints[checkpoint.VBucket] = checkpoint
+	}
+	return err
+}
+
+func (index *MockIndex) Batch(batch *index.Batch) error {
+	failed := make(map[string]error)
+	for id, doc := range batch.Docs {
+		if doc == nil {
+			index.Delete([]byte(id))
+		} else {
+			err := index.Update([]byte(id), doc)
+			if err != nil {
+				failed[id] = err
+			}
+		}
+	}
+	for vbucket, checkpoint := range batch.Checkpoints {
+		if checkpoint == nil {
+			delete(index.checkpoints, vbucket)
+			continue
+		}
+		index.checkpoints[vbucket] = checkpoint
+	}
+	return docErrors(failed)
+}
+
+func docErrors(failed map[string]error) error {
+	if len(failed) == 0 {
+		return nil
+	}
+	return index.DocErrors(failed)
+}
+
+func (index *MockIndex) SetCheckpoint(checkpoint *index.Checkpoint) error {
+	index.checkpoints[checkpoint.VBucket] = checkpoint
+	return nil
+}
+
+func (index *MockIndex) Checkpoints() ([]*index.Checkpoint, error) {
+	return checkpointList(index.checkpoints), nil
+}
+
+func checkpointList(checkpoints map[uint16]*index.Checkpoint) []*index.Checkpoint {
+	rv := make([]*index.Checkpoint, 0, len(checkpoints))
+	for _, checkpoint := range checkpoints {
+		rv = append(rv, checkpoint)
+	}
+	return rv
+}
+
 func (index *MockIndex) TermFieldReader(term []byte, field string) (index.TermFieldReader, error) {
 
 	fdf, ok := index.termIndex[string(term)]
@@ -177,10 +268,101 @@ func (index *MockIndex) TermFieldReader(term []byte, field string) (index.TermFi
 	return &mtfr, nil
 }
 
+func (index *MockIndex) FieldDict(field string, start, end []byte) (index.FieldDict, error) {
+	found := false
+	for _, f := range index.schema {
+		if f.Name == field {
+			found = true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("No field named `%s` in the schema", field)
+	}
+
+	return newMockFieldDict(index.termIndex, field, string(start), string(end)), nil
+}
+
+func (index *MockIndex) FieldLength(id []byte, field string) (uint64, error) {
+	for _, f := range index.schema {
+		if f.Name == field {
+			return index.fieldLengths[string(id)][field], nil
+		}
+	}
+	return 0, fmt.Errorf("No field named `%s` in the schema", field)
+}
+
+func (index *MockIndex) AvgFieldLength(field string) (float64, error) {
+	for _, f := range index.schema {
+		if f.Name == field {
+			if index.docCount == 0 {
+				return 0, nil
+			}
+			var total uint64
+			for _, fieldLengths := range index.fieldLengths {
+				total += fieldLengths[field]
+			}
+			return float64(total) / float64(index.docCount), nil
+		}
+	}
+	return 0, fmt.Errorf("No field named `%s` in the schema", field)
+}
+
+func (index *MockIndex) Document(id []byte) (map[string][]byte, error) {
+	_, existed := index.backIndex[string(id)]
+	if !existed {
+		return nil, nil
+	}
+	rv := make(map[string][]byte)
+	for field, value := range index.stored[string(id)] {
+		rv[field] = value
+	}
+	return rv, nil
+}
+
+func (index *MockIndex) DocumentFieldTerms(id []byte) (index.FieldTerms, error) {
+	backIndexEntry, existed := index.backIndex[string(id)]
+	if !existed {
+		return nil, nil
+	}
+	rv := make(map[string][]string)
+	for _, backIndexPair := range backIndexEntry {
+		if len(backIndexPair) == 2 {
+			rv[backIndexPair[0]] = append(rv[backIndexPair[0]], backIndexPair[1])
+		}
+	}
+	return rv, nil
+}
+
+func (index *MockIndex) SortValue(id []byte, field string) ([]byte, error) {
+	for _, f := range index.schema {
+		if f.Name == field {
+			if !f.Sortable {
+				return nil, fmt.Errorf("Field `%s` is not sortable", field)
+			}
+			return index.sortValues[string(id)][field], nil
+		}
+	}
+	return nil, fmt.Errorf("No field named `%s` in the schema", field)
+}
+
 func (index *MockIndex) DocCount() uint64 {
 	return index.docCount
 }
 
+func (index *MockIndex) DocIDs(match func(id []byte) bool) ([]string, error) {
+	rv := make([]string, 0)
+	for id, _ := range index.backIndex {
+		if match == nil || match([]byte(id)) {
+			rv = append(rv, id)
+		}
+	}
+	return rv, nil
+}
+
+func (index *MockIndex) Fields() []*index.Field {
+	return index.schema
+}
+
 type mockTermFieldReader struct {
 	index        mockDocFreq
 	sortedDocIds sort.StringSlice
@@ -193,23 +375,23 @@ func (reader *mockTermFieldReader) Next() (*index.TermFieldDoc, error) {
 		nextTermKey := reader.sortedDocIds[next]
 		nextTerm := reader.index[nextTermKey]
 		reader.curr = next
-		return &index.TermFieldDoc{ID: nextTermKey, Freq: nextTerm.freq, Norm: nextTerm.norm, Vectors: nextTerm.vectors}, nil
+		return &index.TermFieldDoc{ID: nextTermKey, Freq: nextTerm.freq, Vectors: nextTerm.vectors}, nil
 	}
 	return nil, nil
 }
 
 func (reader *mockTermFieldReader) Advance(ID []byte) (*index.TermFieldDoc, error) {
-	if reader.curr >= len(reader.sortedDocIds) {
-		return nil, nil
+	if reader.curr < 0 {
+		reader.curr = 0
 	}
-	for currTermID := reader.sortedDocIds[reader.curr]; currTermID < string(ID) && reader.curr < len(reader.sortedDocIds); reader.curr += 1 {
-
+	for reader.curr < len(reader.sortedDocIds) && reader.sortedDocIds[reader.curr] < string(ID) {
+		reader.curr += 1
 	}
 
 	if reader.curr < len(reader.sortedDocIds) {
 		nextTermKey := reader.sortedDocIds[reader.curr]
 		nextTerm := reader.index[nextTermKey]
-		return &index.TermFieldDoc{ID: nextTermKey, Freq: nextTerm.freq, Norm: nextTerm.norm, Vectors: nextTerm.vectors}, nil
+		return &index.TermFieldDoc{ID: nextTermKey, Freq: nextTerm.freq, Vectors: nextTerm.vectors}, nil
 	}
 	return nil, nil
 }
@@ -235,3 +417,46 @@ func (mi *MockIndex) mockVectorsFromTokenFreq(field uint16, tf *analysis.TokenFr
 
 	return rv
 }
+
+type mockDictEntries []*index.DictEntry
+
+func (m mockDictEntries) Len() int           { return len(m) }
+func (m mockDictEntries) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
+func (m mockDictEntries) Less(i, j int) bool { return m[i].Term < m[j].Term }
+
+type mockFieldDict struct {
+	entries mockDictEntries
+	curr    int
+}
+
+func newMockFieldDict(termIndex map[string]mockFieldDocFreq, field, start, end string) *mockFieldDict {
+	rv := mockFieldDict{
+		entries: make(mockDictEntries, 0),
+	}
+	for term, fieldMap := range termIndex {
+		if term < start || (end != "" && term > end) {
+			continue
+		}
+		docMap, ok := fieldMap[field]
+		if !ok || len(docMap) == 0 {
+			continue
+		}
+		rv.entries = append(rv.entries, &index.DictEntry{
+			Term:  term,
+			Count: uint64(len(docMap)),
+		})
+	}
+	sort.Sort(rv.entries)
+	return &rv
+}
+
+func (f *mockFieldDict) Next() (*index.DictEntry, error) {
+	if f.curr >= len(f.entries) {
+		return nil, nil
+	}
+	rv := f.entries[f.curr]
+	f.curr++
+	return rv, nil
+}
+
+func (f *mockFieldDict) Close() {}
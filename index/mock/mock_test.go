@@ -50,7 +50,6 @@ func TestCRUD(t *testing.T) {
 	expectedMatch := &index.TermFieldDoc{
 		ID:   "1",
 		Freq: 1,
-		Norm: 1,
 	}
 	tfr, err := i.TermFieldReader([]byte("marty"), "name")
 	if err != nil {
@@ -105,7 +104,6 @@ func TestCRUD(t *testing.T) {
 	expectedMatch = &index.TermFieldDoc{
 		ID:   "1",
 		Freq: 1,
-		Norm: 0.5773502691896258,
 		Vectors: []*index.TermFieldVector{
 			&index.TermFieldVector{
 				Field: "desc",
@@ -126,4 +124,20 @@ func TestCRUD(t *testing.T) {
 	if !reflect.DeepEqual(expectedMatch, match) {
 		t.Errorf("got %#v, expected %#v", match, expectedMatch)
 	}
+
+	// field length is recorded for norms
+	fieldLength, err := i.FieldLength([]byte("1"), "desc")
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if fieldLength != 3 {
+		t.Errorf("expected field length 3, got %d", fieldLength)
+	}
+	avgFieldLength, err := i.AvgFieldLength("desc")
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if avgFieldLength != 3.0 {
+		t.Errorf("expected average field length 3, got %f", avgFieldLength)
+	}
 }
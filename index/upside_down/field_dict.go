@@ -0,0 +1,109 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package upside_down
+
+import (
+	"bytes"
+
+	"github.com/jmhodges/levigo"
+
+	"github.com/couchbaselabs/cbfullofit/index"
+)
+
+// UpsideDownCouchFieldDict walks the term summary rows.
+//
+// Keys are 't' term 0xff field doc, so a term sorts after any
+// longer term it is a prefix of ("beer" before "be").  The walk
+// therefore cannot stop at the first term past end; it stops
+// once no term in range can follow, and filters out the rest.
+type UpsideDownCouchFieldDict struct {
+	index    *UpsideDownCouch
+	iterator *levigo.Iterator
+	field    uint16
+	start    []byte
+	end      []byte
+	// every term in range sorts before the first term which
+	// does not start with stopPrefix and is greater than it
+	stopPrefix []byte
+}
+
+func newUpsideDownCouchFieldDict(index *UpsideDownCouch, field uint16, start, end []byte) (*UpsideDownCouchFieldDict, error) {
+	ro := defaultReadOptions()
+	it := index.db.NewIterator(ro)
+
+	seekKey := append([]byte{'t'}, start...)
+	it.Seek(seekKey)
+
+	var stopPrefix []byte
+	if len(end) > 0 {
+		stopPrefix = commonPrefix(start, end)
+		if len(stopPrefix) == 0 {
+			stopPrefix = end[:1]
+		}
+	}
+
+	return &UpsideDownCouchFieldDict{
+		index:      index,
+		iterator:   it,
+		field:      field,
+		start:      start,
+		end:        end,
+		stopPrefix: stopPrefix,
+	}, it.GetError()
+}
+
+func (r *UpsideDownCouchFieldDict) Next() (*index.DictEntry, error) {
+	for r.iterator.Valid() {
+		key := r.iterator.Key()
+		if key[0] != 't' {
+			// end of the term rows
+			return nil, nil
+		}
+		tfr := NewTermFrequencyRowKV(key, r.iterator.Value())
+		if r.stopPrefix != nil && !bytes.HasPrefix(tfr.term, r.stopPrefix) && bytes.Compare(tfr.term, r.stopPrefix) > 0 {
+			// no more terms in range
+			return nil, nil
+		}
+
+		// skip the doc rows of this term and field
+		skipKey := NewTermFrequencyRow(tfr.term, tfr.field, []byte{BYTE_SEPARATOR}, 0).Key()
+		isSummary := len(tfr.doc) == 0
+		r.iterator.Seek(skipKey)
+
+		if isSummary && tfr.field == r.field && r.inRange(tfr.term) {
+			return &index.DictEntry{
+				Term:  string(tfr.term),
+				Count: tfr.freq,
+			}, nil
+		}
+	}
+	return nil, r.iterator.GetError()
+}
+
+func (r *UpsideDownCouchFieldDict) inRange(term []byte) bool {
+	if bytes.Compare(term, r.start) < 0 {
+		return false
+	}
+	if len(r.end) > 0 && bytes.Compare(term, r.end) > 0 {
+		return false
+	}
+	return true
+}
+
+func (r *UpsideDownCouchFieldDict) Close() {
+	r.iterator.Close()
+}
+
+func commonPrefix(a, b []byte) []byte {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return a[:i]
+}
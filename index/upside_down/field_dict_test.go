@@ -0,0 +1,140 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package upside_down
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/couchbaselabs/cbfullofit/index"
+)
+
+func TestIndexFieldDict(t *testing.T) {
+	defer os.RemoveAll("test")
+
+	schema := []*index.Field{
+		&index.Field{
+			Name:     "name",
+			Path:     "/name",
+			Analyzer: "standard",
+		},
+		&index.Field{
+			Name:     "desc",
+			Path:     "/desc",
+			Analyzer: "standard",
+		},
+	}
+	idx := NewUpsideDownCouch("test", schema)
+	err := idx.Open()
+	if err != nil {
+		t.Errorf("error opening index: %v", err)
+	}
+	defer idx.Close()
+
+	docs := map[string]string{
+		"1": `{"name":"ba bark bar","desc":"bark barn"}`,
+		"2": `{"name":"bark bf","desc":"ale"}`,
+		"3": `{"name":"ale c","desc":"barks"}`,
+	}
+	for id, doc := range docs {
+		err = idx.Update([]byte(id), []byte(doc))
+		if err != nil {
+			t.Errorf("error updating index: %v", err)
+		}
+	}
+
+	tests := []struct {
+		field string
+		start string
+		end   string
+		terms []string
+	}{
+		{
+			field: "name",
+			terms: []string{"ale", "ba", "bar", "bark", "bf", "c"},
+		},
+		{
+			field: "desc",
+			terms: []string{"ale", "bark", "barks", "barn"},
+		},
+		// a prefix sorts after the longer terms in the index (ba after bark),
+		// make sure it is neither missed nor ends the walk early
+		{
+			field: "name",
+			start: "ba",
+			end:   "ba\xff",
+			terms: []string{"ba", "bar", "bark"},
+		},
+		{
+			field: "name",
+			start: "b",
+			end:   "bar",
+			terms: []string{"ba", "bar"},
+		},
+		{
+			field: "name",
+			start: "a",
+			end:   "bf",
+			terms: []string{"ale", "ba", "bar", "bark", "bf"},
+		},
+		{
+			field: "name",
+			start: "baz",
+			terms: []string{"bf", "c"},
+		},
+		{
+			field: "desc",
+			start: "c",
+			terms: []string{},
+		},
+	}
+
+	for testIndex, test := range tests {
+		dict, err := idx.FieldDict(test.field, []byte(test.start), []byte(test.end))
+		if err != nil {
+			t.Fatalf("error opening field dict: %v", err)
+		}
+		terms := make([]string, 0)
+		entry, err := dict.Next()
+		for err == nil && entry != nil {
+			terms = append(terms, entry.Term)
+			entry, err = dict.Next()
+		}
+		if err != nil {
+			t.Errorf("error iterating field dict: %v", err)
+		}
+		dict.Close()
+		sort.Strings(terms)
+		if !reflect.DeepEqual(terms, test.terms) {
+			t.Errorf("expected terms %v got %v for test %d", test.terms, terms, testIndex)
+		}
+	}
+
+	// counts come from the summary rows
+	dict, err := idx.FieldDict("name", []byte("bark"), []byte("bark"))
+	if err != nil {
+		t.Fatalf("error opening field dict: %v", err)
+	}
+	defer dict.Close()
+	entry, err := dict.Next()
+	if err != nil {
+		t.Errorf("error iterating field dict: %v", err)
+	}
+	expectedEntry := &index.DictEntry{Term: "bark", Count: 2}
+	if !reflect.DeepEqual(entry, expectedEntry) {
+		t.Errorf("expected %v got %v", expectedEntry, entry)
+	}
+
+	_, err = idx.FieldDict("style", nil, nil)
+	if err == nil {
+		t.Errorf("expected error for unknown field")
+	}
+}
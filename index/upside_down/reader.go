@@ -28,7 +28,7 @@ func newUpsideDownCouchTermFieldReader(index *UpsideDownCouch, term []byte, fiel
 	ro := defaultReadOptions()
 	it := index.db.NewIterator(ro)
 
-	tfr := NewTermFrequencyRow(term, field, nil, 0, 0)
+	tfr := NewTermFrequencyRow(term, field, nil, 0)
 	it.Seek(tfr.Key())
 
 	var count uint64 = 0
@@ -58,7 +58,7 @@ func (r *UpsideDownCouchTermFieldReader) Count() uint64 {
 func (r *UpsideDownCouchTermFieldReader) Next() (*index.TermFieldDoc, error) {
 	r.iterator.Next()
 	if r.iterator.Valid() {
-		tfr := NewTermFrequencyRow(r.term, r.field, nil, 0, 0)
+		tfr := NewTermFrequencyRow(r.term, r.field, nil, 0)
 		if !bytes.HasPrefix(r.iterator.Key(), tfr.Key()) {
 			// end of the line
 			return nil, nil
@@ -67,7 +67,6 @@ func (r *UpsideDownCouchTermFieldReader) Next() (*index.TermFieldDoc, error) {
 		return &index.TermFieldDoc{
 			ID:      string(tfr.doc),
 			Freq:    tfr.freq,
-			Norm:    float64(tfr.norm),
 			Vectors: r.index.termFieldVectorsFromTermVectors(tfr.vectors),
 		}, nil
 	} else {
@@ -76,10 +75,10 @@ func (r *UpsideDownCouchTermFieldReader) Next() (*index.TermFieldDoc, error) {
 }
 
 func (r *UpsideDownCouchTermFieldReader) Advance(docId []byte) (*index.TermFieldDoc, error) {
-	tfr := NewTermFrequencyRow(r.term, r.field, docId, 0, 0)
+	tfr := NewTermFrequencyRow(r.term, r.field, docId, 0)
 	r.iterator.Seek(tfr.Key())
 	if r.iterator.Valid() {
-		tfr := NewTermFrequencyRow(r.term, r.field, nil, 0, 0)
+		tfr := NewTermFrequencyRow(r.term, r.field, nil, 0)
 		if !bytes.HasPrefix(r.iterator.Key(), tfr.Key()) {
 			// end of the line
 			return nil, nil
@@ -88,7 +87,6 @@ func (r *UpsideDownCouchTermFieldReader) Advance(docId []byte) (*index.TermField
 		return &index.TermFieldDoc{
 			ID:      string(tfr.doc),
 			Freq:    tfr.freq,
-			Norm:    float64(tfr.norm),
 			Vectors: r.index.termFieldVectorsFromTermVectors(tfr.vectors),
 		}, nil
 	} else {
@@ -95,7 +95,6 @@ func TestIndexReader(t *testing.T) {
 	expectedMatch := &index.TermFieldDoc{
 		ID:   "2",
 		Freq: 1,
-		Norm: 0.5773502588272095,
 		Vectors: []*index.TermFieldVector{
 			&index.TermFieldVector{
 				Field: "desc",
@@ -116,4 +115,13 @@ func TestIndexReader(t *testing.T) {
 	if !reflect.DeepEqual(expectedMatch, match) {
 		t.Errorf("got %#v, expected %#v", match, expectedMatch)
 	}
+
+	// field length is recorded for norms
+	fieldLength, err := idx.FieldLength([]byte{'2'}, "desc")
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if fieldLength != 3 {
+		t.Errorf("expected field length 3, got %d", fieldLength)
+	}
 }
@@ -36,10 +36,20 @@ func ParseFromKeyValue(key, value []byte) UpsideDownCouchRow {
 	// 	return NewInverseFrequencyRowKV(key, value)
 	case 't':
 		return NewTermFrequencyRowKV(key, value)
-	// case 'n':
-	// 	return NewNormalizationRowKV(key, value)
+	case 'n':
+		return NewNormalizationRowKV(key, value)
+	case 's':
+		return NewStoredRowKV(key, value)
+	case 'd':
+		return NewDocValueRowKV(key, value)
 	case 'b':
 		return NewBackIndexRowKV(key, value)
+	case 'c':
+		row, err := NewCheckpointRowKV(key, value)
+		if err != nil {
+			return nil
+		}
+		return row
 	}
 	return nil
 }
@@ -89,8 +99,12 @@ type FieldRow struct {
 	index              uint16
 	name               string
 	path               string
+	fieldType          string
 	analyzer           string
 	includeTermVectors bool
+	store              bool
+	sortable           bool
+	dateTimeLayouts    []string
 }
 
 func (f *FieldRow) Key() []byte {
@@ -124,6 +138,14 @@ func (f *FieldRow) Value() []byte {
 	if err != nil {
 		panic(fmt.Sprintf("Buffer.WriteByte failed: %v", err))
 	}
+	_, err = buf.WriteString(f.fieldType)
+	if err != nil {
+		panic(fmt.Sprintf("Buffer.WriteString failed: %v", err))
+	}
+	err = buf.WriteByte(BYTE_SEPARATOR)
+	if err != nil {
+		panic(fmt.Sprintf("Buffer.WriteByte failed: %v", err))
+	}
 	_, err = buf.WriteString(f.analyzer)
 	if err != nil {
 		panic(fmt.Sprintf("Buffer.WriteString failed: %v", err))
@@ -141,6 +163,39 @@ func (f *FieldRow) Value() []byte {
 	if err != nil {
 		panic(fmt.Sprintf("binary.Write failed: %v", err))
 	}
+
+	var storeByte byte = 0
+	if f.store {
+		storeByte = 1
+	}
+	err = binary.Write(buf, binary.LittleEndian, storeByte)
+	if err != nil {
+		panic(fmt.Sprintf("binary.Write failed: %v", err))
+	}
+
+	var sortableByte byte = 0
+	if f.sortable {
+		sortableByte = 1
+	}
+	err = binary.Write(buf, binary.LittleEndian, sortableByte)
+	if err != nil {
+		panic(fmt.Sprintf("binary.Write failed: %v", err))
+	}
+
+	err = binary.Write(buf, binary.LittleEndian, uint16(len(f.dateTimeLayouts)))
+	if err != nil {
+		panic(fmt.Sprintf("binary.Write failed: %v", err))
+	}
+	for _, layout := range f.dateTimeLayouts {
+		_, err = buf.WriteString(layout)
+		if err != nil {
+			panic(fmt.Sprintf("Buffer.WriteString failed: %v", err))
+		}
+		err = buf.WriteByte(BYTE_SEPARATOR)
+		if err != nil {
+			panic(fmt.Sprintf("Buffer.WriteByte failed: %v", err))
+		}
+	}
 	return buf.Bytes()
 }
 
@@ -148,22 +203,30 @@ func (f *FieldRow) Field() *index.Field {
 	return &index.Field{
 		Name:               f.name,
 		Path:               f.path,
+		Type:               f.fieldType,
 		Analyzer:           f.analyzer,
 		IncludeTermVectors: f.includeTermVectors,
+		Store:              f.store,
+		Sortable:           f.sortable,
+		DateTimeLayouts:    f.dateTimeLayouts,
 	}
 }
 
 func (f *FieldRow) String() string {
-	return fmt.Sprintf("Field: %d Name: %s Path: %s Analyzer: %s IncludeTermVectors: %v", f.index, f.name, f.path, f.analyzer, f.includeTermVectors)
+	return fmt.Sprintf("Field: %d Name: %s Path: %s Type: %s Analyzer: %s IncludeTermVectors: %v Store: %v Sortable: %v DateTimeLayouts: %v", f.index, f.name, f.path, f.fieldType, f.analyzer, f.includeTermVectors, f.store, f.sortable, f.dateTimeLayouts)
 }
 
-func NewFieldRow(index uint16, name, path, analyzer string, includeTermVectors bool) *FieldRow {
+func NewFieldRow(index uint16, name, path, fieldType, analyzer string, includeTermVectors, store, sortable bool, dateTimeLayouts []string) *FieldRow {
 	return &FieldRow{
 		index:              index,
 		name:               name,
 		path:               path,
+		fieldType:          fieldType,
 		analyzer:           analyzer,
 		includeTermVectors: includeTermVectors,
+		store:              store,
+		sortable:           sortable,
+		dateTimeLayouts:    dateTimeLayouts,
 	}
 }
 
@@ -188,6 +251,11 @@ func NewFieldRowKV(key, value []byte) *FieldRow {
 		panic(fmt.Sprintf("Buffer.ReadString failed: %v", err))
 	}
 	rv.path = rv.path[:len(rv.path)-1] // trim off separator byte
+	rv.fieldType, err = buf.ReadString(BYTE_SEPARATOR)
+	if err != nil {
+		panic(fmt.Sprintf("Buffer.ReadString failed: %v", err))
+	}
+	rv.fieldType = rv.fieldType[:len(rv.fieldType)-1] // trim off separator byte
 	rv.analyzer, err = buf.ReadString(BYTE_SEPARATOR)
 	if err != nil {
 		panic(fmt.Sprintf("Buffer.ReadString failed: %v", err))
@@ -203,6 +271,37 @@ func NewFieldRowKV(key, value []byte) *FieldRow {
 		rv.includeTermVectors = true
 	}
 
+	var storeByte byte
+	err = binary.Read(buf, binary.LittleEndian, &storeByte)
+	if err != nil {
+		panic(fmt.Sprintf("binary.Read failed: %v", err))
+	}
+	if storeByte == 1 {
+		rv.store = true
+	}
+
+	var sortableByte byte
+	err = binary.Read(buf, binary.LittleEndian, &sortableByte)
+	if err != nil {
+		panic(fmt.Sprintf("binary.Read failed: %v", err))
+	}
+	if sortableByte == 1 {
+		rv.sortable = true
+	}
+
+	var layoutCount uint16
+	err = binary.Read(buf, binary.LittleEndian, &layoutCount)
+	if err != nil {
+		panic(fmt.Sprintf("binary.Read failed: %v", err))
+	}
+	for i := uint16(0); i < layoutCount; i++ {
+		layout, err := buf.ReadString(BYTE_SEPARATOR)
+		if err != nil {
+			panic(fmt.Sprintf("Buffer.ReadString failed: %v", err))
+		}
+		rv.dateTimeLayouts = append(rv.dateTimeLayouts, layout[:len(layout)-1]) // trim off separator byte
+	}
+
 	return &rv
 }
 
@@ -224,7 +323,6 @@ type TermFrequencyRow struct {
 	field   uint16
 	doc     []byte
 	freq    uint64
-	norm    float32
 	vectors []*TermVector
 }
 
@@ -259,10 +357,6 @@ func (tfr *TermFrequencyRow) Value() []byte {
 	if err != nil {
 		panic(fmt.Sprintf("binary.Write failed: %v", err))
 	}
-	err = binary.Write(buf, binary.LittleEndian, tfr.norm)
-	if err != nil {
-		panic(fmt.Sprintf("binary.Write failed: %v", err))
-	}
 	for _, vector := range tfr.vectors {
 		err = binary.Write(buf, binary.LittleEndian, vector.field)
 		if err != nil {
@@ -285,26 +379,24 @@ func (tfr *TermFrequencyRow) Value() []byte {
 }
 
 func (tfr *TermFrequencyRow) String() string {
-	return fmt.Sprintf("Term: `%s` Field: %d DocId: `%s` Frequency: %d Norm: %f Vectors: %v", string(tfr.term), tfr.field, string(tfr.doc), tfr.freq, tfr.norm, tfr.vectors)
+	return fmt.Sprintf("Term: `%s` Field: %d DocId: `%s` Frequency: %d Vectors: %v", string(tfr.term), tfr.field, string(tfr.doc), tfr.freq, tfr.vectors)
 }
 
-func NewTermFrequencyRow(term []byte, field uint16, doc []byte, freq uint64, norm float32) *TermFrequencyRow {
+func NewTermFrequencyRow(term []byte, field uint16, doc []byte, freq uint64) *TermFrequencyRow {
 	return &TermFrequencyRow{
 		term:  term,
 		field: field,
 		doc:   doc,
 		freq:  freq,
-		norm:  norm,
 	}
 }
 
-func NewTermFrequencyRowWithTermVectors(term []byte, field uint16, doc []byte, freq uint64, norm float32, vectors []*TermVector) *TermFrequencyRow {
+func NewTermFrequencyRowWithTermVectors(term []byte, field uint16, doc []byte, freq uint64, vectors []*TermVector) *TermFrequencyRow {
 	return &TermFrequencyRow{
 		term:    term,
 		field:   field,
 		doc:     doc,
 		freq:    freq,
-		norm:    norm,
 		vectors: vectors,
 	}
 }
@@ -336,11 +428,6 @@ func NewTermFrequencyRowKV(key, value []byte) *TermFrequencyRow {
 	if err != nil {
 		panic(fmt.Sprintf("binary.Read failed: %v", err))
 	}
-	err = binary.Read(buf, binary.LittleEndian, &rv.norm)
-	if err != nil {
-		panic(fmt.Sprintf("binary.Read failed: %v", err))
-	}
-
 	var field uint16
 	err = binary.Read(buf, binary.LittleEndian, &field)
 	if err != nil && err != io.EOF {
@@ -375,6 +462,222 @@ func NewTermFrequencyRowKV(key, value []byte) *TermFrequencyRow {
 
 }
 
+// FIELD LENGTH NORMALIZATION
+
+type NormalizationRow struct {
+	field  uint16
+	doc    []byte
+	length uint64
+}
+
+func (nr *NormalizationRow) Key() []byte {
+	buf := new(bytes.Buffer)
+	err := buf.WriteByte('n')
+	if err != nil {
+		panic(fmt.Sprintf("Buffer.WriteByte failed: %v", err))
+	}
+	err = binary.Write(buf, binary.LittleEndian, nr.field)
+	if err != nil {
+		panic(fmt.Sprintf("binary.Write failed: %v", err))
+	}
+	_, err = buf.Write(nr.doc)
+	if err != nil {
+		panic(fmt.Sprintf("Buffer.Write failed: %v", err))
+	}
+	return buf.Bytes()
+}
+
+func (nr *NormalizationRow) Value() []byte {
+	buf := new(bytes.Buffer)
+	err := binary.Write(buf, binary.LittleEndian, nr.length)
+	if err != nil {
+		panic(fmt.Sprintf("binary.Write failed: %v", err))
+	}
+	return buf.Bytes()
+}
+
+func (nr *NormalizationRow) String() string {
+	return fmt.Sprintf("Field: %d DocId: `%s` Length: %d", nr.field, string(nr.doc), nr.length)
+}
+
+func NewNormalizationRow(field uint16, doc []byte, length uint64) *NormalizationRow {
+	return &NormalizationRow{
+		field:  field,
+		doc:    doc,
+		length: length,
+	}
+}
+
+func NewNormalizationRowKV(key, value []byte) *NormalizationRow {
+	rv := NormalizationRow{}
+
+	buf := bytes.NewBuffer(key)
+	buf.ReadByte() // type
+
+	err := binary.Read(buf, binary.LittleEndian, &rv.field)
+	if err != nil {
+		panic(fmt.Sprintf("binary.Read failed: %v", err))
+	}
+
+	rv.doc, err = buf.ReadBytes(BYTE_SEPARATOR)
+	if err != io.EOF {
+		panic(fmt.Sprintf("expected binary.ReadString to end in EOF: %v", err))
+	}
+
+	buf = bytes.NewBuffer(value)
+	err = binary.Read(buf, binary.LittleEndian, &rv.length)
+	if err != nil {
+		panic(fmt.Sprintf("binary.Read failed: %v", err))
+	}
+
+	return &rv
+}
+
+// DOC VALUE, THE VALUE DOCUMENTS ARE SORTED BY
+
+type DocValueRow struct {
+	field uint16
+	doc   []byte
+	value []byte
+}
+
+func (dv *DocValueRow) Key() []byte {
+	buf := new(bytes.Buffer)
+	err := buf.WriteByte('d')
+	if err != nil {
+		panic(fmt.Sprintf("Buffer.WriteByte failed: %v", err))
+	}
+	err = binary.Write(buf, binary.LittleEndian, dv.field)
+	if err != nil {
+		panic(fmt.Sprintf("binary.Write failed: %v", err))
+	}
+	_, err = buf.Write(dv.doc)
+	if err != nil {
+		panic(fmt.Sprintf("Buffer.Write failed: %v", err))
+	}
+	return buf.Bytes()
+}
+
+func (dv *DocValueRow) Value() []byte {
+	return dv.value
+}
+
+func (dv *DocValueRow) String() string {
+	return fmt.Sprintf("Field: %d DocId: `%s` Value: % x", dv.field, string(dv.doc), dv.value)
+}
+
+func NewDocValueRow(field uint16, doc []byte, value []byte) *DocValueRow {
+	return &DocValueRow{
+		field: field,
+		doc:   doc,
+		value: value,
+	}
+}
+
+func NewDocValueRowKV(key, value []byte) *DocValueRow {
+	rv := DocValueRow{}
+
+	buf := bytes.NewBuffer(key)
+	buf.ReadByte() // type
+
+	err := binary.Read(buf, binary.LittleEndian, &rv.field)
+	if err != nil {
+		panic(fmt.Sprintf("binary.Read failed: %v", err))
+	}
+
+	rv.doc = buf.Bytes()
+	rv.value = value
+
+	return &rv
+}
+
+// STORED FIELD VALUE
+
+type StoredRow struct {
+	doc   []byte
+	field uint16
+	value []byte
+}
+
+func (s *StoredRow) Key() []byte {
+	buf := new(bytes.Buffer)
+	err := buf.WriteByte('s')
+	if err != nil {
+		panic(fmt.Sprintf("Buffer.WriteByte failed: %v", err))
+	}
+	_, err = buf.Write(s.doc)
+	if err != nil {
+		panic(fmt.Sprintf("Buffer.Write failed: %v", err))
+	}
+	err = buf.WriteByte(BYTE_SEPARATOR)
+	if err != nil {
+		panic(fmt.Sprintf("Buffer.WriteByte failed: %v", err))
+	}
+	err = binary.Write(buf, binary.LittleEndian, s.field)
+	if err != nil {
+		panic(fmt.Sprintf("binary.Write failed: %v", err))
+	}
+	return buf.Bytes()
+}
+
+func (s *StoredRow) Value() []byte {
+	return s.value
+}
+
+func (s *StoredRow) String() string {
+	return fmt.Sprintf("Document: %s Field %d, Value: %s", s.doc, s.field, s.value)
+}
+
+// StoredRowDocPrefix is the prefix shared by the keys
+// of all the stored rows of a document
+func StoredRowDocPrefix(doc []byte) []byte {
+	buf := new(bytes.Buffer)
+	err := buf.WriteByte('s')
+	if err != nil {
+		panic(fmt.Sprintf("Buffer.WriteByte failed: %v", err))
+	}
+	_, err = buf.Write(doc)
+	if err != nil {
+		panic(fmt.Sprintf("Buffer.Write failed: %v", err))
+	}
+	err = buf.WriteByte(BYTE_SEPARATOR)
+	if err != nil {
+		panic(fmt.Sprintf("Buffer.WriteByte failed: %v", err))
+	}
+	return buf.Bytes()
+}
+
+func NewStoredRow(doc []byte, field uint16, value []byte) *StoredRow {
+	return &StoredRow{
+		doc:   doc,
+		field: field,
+		value: value,
+	}
+}
+
+func NewStoredRowKV(key, value []byte) *StoredRow {
+	rv := StoredRow{}
+
+	buf := bytes.NewBuffer(key)
+	buf.ReadByte() // type
+
+	var err error
+	rv.doc, err = buf.ReadBytes(BYTE_SEPARATOR)
+	if err != nil {
+		panic(fmt.Sprintf("Buffer.ReadBytes failed: %v", err))
+	}
+	rv.doc = rv.doc[:len(rv.doc)-1] // trim off separator byte
+
+	err = binary.Read(buf, binary.LittleEndian, &rv.field)
+	if err != nil {
+		panic(fmt.Sprintf("binary.Read failed: %v", err))
+	}
+
+	rv.value = value
+
+	return &rv
+}
+
 type BackIndexEntry struct {
 	term  []byte
 	field uint16
@@ -470,3 +773,84 @@ func NewBackIndexRowKV(key, value []byte) *BackIndexRow {
 
 	return &rv
 }
+
+// FEED CHECKPOINT
+
+type CheckpointRow struct {
+	vbucket   uint16
+	vbuuid    uint64
+	seq       uint64
+	snapStart uint64
+	snapEnd   uint64
+}
+
+func (c *CheckpointRow) Key() []byte {
+	buf := new(bytes.Buffer)
+	err := buf.WriteByte('c')
+	if err != nil {
+		panic(fmt.Sprintf("Buffer.WriteByte failed: %v", err))
+	}
+	err = binary.Write(buf, binary.LittleEndian, c.vbucket)
+	if err != nil {
+		panic(fmt.Sprintf("binary.Write failed: %v", err))
+	}
+	return buf.Bytes()
+}
+
+func (c *CheckpointRow) Value() []byte {
+	buf := new(bytes.Buffer)
+	err := binary.Write(buf, binary.LittleEndian, c.seq)
+	if err != nil {
+		panic(fmt.Sprintf("binary.Write failed: %v", err))
+	}
+	err = binary.Write(buf, binary.LittleEndian, c.vbuuid)
+	if err != nil {
+		panic(fmt.Sprintf("binary.Write failed: %v", err))
+	}
+	err = binary.Write(buf, binary.LittleEndian, c.snapStart)
+	if err != nil {
+		panic(fmt.Sprintf("binary.Write failed: %v", err))
+	}
+	err = binary.Write(buf, binary.LittleEndian, c.snapEnd)
+	if err != nil {
+		panic(fmt.Sprintf("binary.Write failed: %v", err))
+	}
+	return buf.Bytes()
+}
+
+func (c *CheckpointRow) String() string {
+	return fmt.Sprintf("VBucket: %d VBuuid: %d Seq: %d Snapshot: %d-%d", c.vbucket, c.vbuuid, c.seq, c.snapStart, c.snapEnd)
+}
+
+func NewCheckpointRow(vbucket uint16, vbuuid, seq, snapStart, snapEnd uint64) *CheckpointRow {
+	return &CheckpointRow{
+		vbucket:   vbucket,
+		vbuuid:    vbuuid,
+		seq:       seq,
+		snapStart: snapStart,
+		snapEnd:   snapEnd,
+	}
+}
+
+func NewCheckpointRowKV(key, value []byte) (*CheckpointRow, error) {
+	rv := CheckpointRow{}
+
+	buf := bytes.NewBuffer(key)
+	buf.ReadByte() // type
+
+	err := binary.Read(buf, binary.LittleEndian, &rv.vbucket)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(value) != 32 {
+		return nil, fmt.Errorf("checkpoint of vbucket %d has %d bytes, expected 32", rv.vbucket, len(value))
+	}
+	buf = bytes.NewBuffer(value)
+	binary.Read(buf, binary.LittleEndian, &rv.seq)
+	binary.Read(buf, binary.LittleEndian, &rv.vbuuid)
+	binary.Read(buf, binary.LittleEndian, &rv.snapStart)
+	binary.Read(buf, binary.LittleEndian, &rv.snapEnd)
+
+	return &rv, nil
+}
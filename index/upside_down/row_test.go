@@ -25,34 +25,64 @@ func TestRows(t *testing.T) {
 			[]byte{0x1},
 		},
 		{
-			NewFieldRow(0, "name", "/name", "standard", false),
+			NewFieldRow(0, "name", "/name", "", "standard", false, false, false, nil),
 			[]byte{'f', 0, 0},
-			[]byte{'n', 'a', 'm', 'e', BYTE_SEPARATOR, '/', 'n', 'a', 'm', 'e', BYTE_SEPARATOR, 's', 't', 'a', 'n', 'd', 'a', 'r', 'd', BYTE_SEPARATOR, 0},
+			[]byte{'n', 'a', 'm', 'e', BYTE_SEPARATOR, '/', 'n', 'a', 'm', 'e', BYTE_SEPARATOR, BYTE_SEPARATOR, 's', 't', 'a', 'n', 'd', 'a', 'r', 'd', BYTE_SEPARATOR, 0, 0, 0, 0, 0},
 		},
 		{
-			NewFieldRow(1, "desc", "/description", "standard", true),
+			NewFieldRow(1, "desc", "/description", "text", "standard", true, false, false, nil),
 			[]byte{'f', 1, 0},
-			[]byte{'d', 'e', 's', 'c', BYTE_SEPARATOR, '/', 'd', 'e', 's', 'c', 'r', 'i', 'p', 't', 'i', 'o', 'n', BYTE_SEPARATOR, 's', 't', 'a', 'n', 'd', 'a', 'r', 'd', BYTE_SEPARATOR, 1},
+			[]byte{'d', 'e', 's', 'c', BYTE_SEPARATOR, '/', 'd', 'e', 's', 'c', 'r', 'i', 'p', 't', 'i', 'o', 'n', BYTE_SEPARATOR, 't', 'e', 'x', 't', BYTE_SEPARATOR, 's', 't', 'a', 'n', 'd', 'a', 'r', 'd', BYTE_SEPARATOR, 1, 0, 0, 0, 0},
 		},
 		{
-			NewFieldRow(513, "style", "/style", "keyword", false),
+			NewFieldRow(513, "style", "/style", "", "keyword", false, true, true, nil),
 			[]byte{'f', 1, 2},
-			[]byte{'s', 't', 'y', 'l', 'e', BYTE_SEPARATOR, '/', 's', 't', 'y', 'l', 'e', BYTE_SEPARATOR, 'k', 'e', 'y', 'w', 'o', 'r', 'd', BYTE_SEPARATOR, 0},
+			[]byte{'s', 't', 'y', 'l', 'e', BYTE_SEPARATOR, '/', 's', 't', 'y', 'l', 'e', BYTE_SEPARATOR, BYTE_SEPARATOR, 'k', 'e', 'y', 'w', 'o', 'r', 'd', BYTE_SEPARATOR, 0, 1, 1, 0, 0},
 		},
 		{
-			NewTermFrequencyRow([]byte{'b', 'e', 'e', 'r'}, 0, nil, 3, 3.14),
+			NewFieldRow(2, "abv", "/abv", "numeric", "", false, false, true, nil),
+			[]byte{'f', 2, 0},
+			[]byte{'a', 'b', 'v', BYTE_SEPARATOR, '/', 'a', 'b', 'v', BYTE_SEPARATOR, 'n', 'u', 'm', 'e', 'r', 'i', 'c', BYTE_SEPARATOR, BYTE_SEPARATOR, 0, 0, 1, 0, 0},
+		},
+		{
+			NewFieldRow(3, "created", "/created", "datetime", "", false, true, false, []string{"2006", "01/02"}),
+			[]byte{'f', 3, 0},
+			[]byte{'c', 'r', 'e', 'a', 't', 'e', 'd', BYTE_SEPARATOR, '/', 'c', 'r', 'e', 'a', 't', 'e', 'd', BYTE_SEPARATOR, 'd', 'a', 't', 'e', 't', 'i', 'm', 'e', BYTE_SEPARATOR, BYTE_SEPARATOR, 0, 1, 0, 2, 0, '2', '0', '0', '6', BYTE_SEPARATOR, '0', '1', '/', '0', '2', BYTE_SEPARATOR},
+		},
+		{
+			NewTermFrequencyRow([]byte{'b', 'e', 'e', 'r'}, 0, nil, 3),
 			[]byte{'t', 'b', 'e', 'e', 'r', BYTE_SEPARATOR, 0, 0},
-			[]byte{3, 0, 0, 0, 0, 0, 0, 0, 195, 245, 72, 64},
+			[]byte{3, 0, 0, 0, 0, 0, 0, 0},
 		},
 		{
-			NewTermFrequencyRow([]byte{'b', 'e', 'e', 'r'}, 0, []byte{'b', 'u', 'd', 'w', 'e', 'i', 's', 'e', 'r'}, 3, 3.14),
+			NewTermFrequencyRow([]byte{'b', 'e', 'e', 'r'}, 0, []byte{'b', 'u', 'd', 'w', 'e', 'i', 's', 'e', 'r'}, 3),
 			[]byte{'t', 'b', 'e', 'e', 'r', BYTE_SEPARATOR, 0, 0, 'b', 'u', 'd', 'w', 'e', 'i', 's', 'e', 'r'},
-			[]byte{3, 0, 0, 0, 0, 0, 0, 0, 195, 245, 72, 64},
+			[]byte{3, 0, 0, 0, 0, 0, 0, 0},
 		},
 		{
-			NewTermFrequencyRowWithTermVectors([]byte{'b', 'e', 'e', 'r'}, 0, []byte{'b', 'u', 'd', 'w', 'e', 'i', 's', 'e', 'r'}, 3, 3.14, []*TermVector{&TermVector{field: 0, pos: 1, start: 3, end: 11}, &TermVector{field: 0, pos: 2, start: 23, end: 31}, &TermVector{field: 0, pos: 3, start: 43, end: 51}}),
+			NewTermFrequencyRowWithTermVectors([]byte{'b', 'e', 'e', 'r'}, 0, []byte{'b', 'u', 'd', 'w', 'e', 'i', 's', 'e', 'r'}, 3, []*TermVector{&TermVector{field: 0, pos: 1, start: 3, end: 11}, &TermVector{field: 0, pos: 2, start: 23, end: 31}, &TermVector{field: 0, pos: 3, start: 43, end: 51}}),
 			[]byte{'t', 'b', 'e', 'e', 'r', BYTE_SEPARATOR, 0, 0, 'b', 'u', 'd', 'w', 'e', 'i', 's', 'e', 'r'},
-			[]byte{3, 0, 0, 0, 0, 0, 0, 0, 195, 245, 72, 64, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 3, 0, 0, 0, 0, 0, 0, 0, 11, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0, 23, 0, 0, 0, 0, 0, 0, 0, 31, 0, 0, 0, 0, 0, 0, 0, 0, 0, 3, 0, 0, 0, 0, 0, 0, 0, 43, 0, 0, 0, 0, 0, 0, 0, 51, 0, 0, 0, 0, 0, 0, 0},
+			[]byte{3, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 3, 0, 0, 0, 0, 0, 0, 0, 11, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0, 23, 0, 0, 0, 0, 0, 0, 0, 31, 0, 0, 0, 0, 0, 0, 0, 0, 0, 3, 0, 0, 0, 0, 0, 0, 0, 43, 0, 0, 0, 0, 0, 0, 0, 51, 0, 0, 0, 0, 0, 0, 0},
+		},
+		{
+			NewNormalizationRow(1, []byte{'b', 'u', 'd', 'w', 'e', 'i', 's', 'e', 'r'}, 9),
+			[]byte{'n', 1, 0, 'b', 'u', 'd', 'w', 'e', 'i', 's', 'e', 'r'},
+			[]byte{9, 0, 0, 0, 0, 0, 0, 0},
+		},
+		{
+			NewStoredRow([]byte{'b', 'u', 'd', 'w', 'e', 'i', 's', 'e', 'r'}, 513, []byte{'"', 'a', 'l', 'e', '"'}),
+			[]byte{'s', 'b', 'u', 'd', 'w', 'e', 'i', 's', 'e', 'r', BYTE_SEPARATOR, 1, 2},
+			[]byte{'"', 'a', 'l', 'e', '"'},
+		},
+		{
+			NewDocValueRow(1, []byte{'b', 'u', 'd', 'w', 'e', 'i', 's', 'e', 'r'}, []byte{'a', 'l', 'e'}),
+			[]byte{'d', 1, 0, 'b', 'u', 'd', 'w', 'e', 'i', 's', 'e', 'r'},
+			[]byte{'a', 'l', 'e'},
+		},
+		{
+			NewCheckpointRow(513, 258, 7, 5, 9),
+			[]byte{'c', 1, 2},
+			[]byte{7, 0, 0, 0, 0, 0, 0, 0, 2, 1, 0, 0, 0, 0, 0, 0, 5, 0, 0, 0, 0, 0, 0, 0, 9, 0, 0, 0, 0, 0, 0, 0},
 		},
 		{
 			NewBackIndexRow([]byte{'b', 'u', 'd', 'w', 'e', 'i', 's', 'e', 'r'}, []*BackIndexEntry{&BackIndexEntry{[]byte{'b', 'e', 'e', 'r'}, 0}}),
@@ -87,3 +117,14 @@ func TestRows(t *testing.T) {
 	}
 
 }
+
+func TestCheckpointRowKVLength(t *testing.T) {
+	_, err := NewCheckpointRowKV([]byte{'c', 1, 2}, []byte{7, 0, 0, 0, 0, 0, 0, 0})
+	if err == nil {
+		t.Errorf("expected error for a checkpoint without a vbuuid and snapshot")
+	}
+	row := ParseFromKeyValue([]byte{'c', 1, 2}, []byte{7, 0, 0, 0, 0, 0, 0, 0})
+	if row != nil {
+		t.Errorf("expected no row for a malformed checkpoint, got %v", row)
+	}
+}
@@ -12,7 +12,7 @@ import (
 	"bytes"
 	"fmt"
 	"log"
-	"math"
+	"runtime"
 
 	"github.com/couchbaselabs/cbfullofit/analysis"
 	"github.com/dustin/go-jsonpointer"
@@ -23,7 +23,9 @@ import (
 
 var VERSION_KEY []byte = []byte{'v'}
 
-const VERSION uint8 = 1
+const VERSION uint8 = 7
+
+var IncompatibleVersion = fmt.Errorf("incompatible version, %d is supported", VERSION)
 
 type UpsideDownCouch struct {
 	version  uint8
@@ -31,8 +33,19 @@ type UpsideDownCouch struct {
 	opts     *levigo.Options
 	db       *levigo.DB
 	schema   []*index.Field
-	analyzer map[string]*analysis.Analyzer
+	analyzer map[string]*analysis.Analyzer // key is field name
 	docCount uint64
+	// sum of the field lengths of all docs, indexed like the schema
+	fieldTotals []uint64
+	// whether writes wait for the disk
+	sync bool
+	// analyzers can't be shared, each batch worker gets its own
+	analysisWorkers int
+	workerAnalyzers []map[string]*analysis.Analyzer
+	// with a discriminator only documents of the types are indexed,
+	// key is type, inner key is field name and value is its path
+	discriminator *index.TypeDiscriminator
+	types         map[string]map[string]string
 }
 
 func NewUpsideDownCouch(path string, schema []*index.Field) *UpsideDownCouch {
@@ -45,7 +58,33 @@ func NewUpsideDownCouch(path string, schema []*index.Field) *UpsideDownCouch {
 		opts:     opts,
 		schema:   schema,
 		analyzer: make(map[string]*analysis.Analyzer),
+		sync:     true,
+
+		analysisWorkers: runtime.NumCPU(),
+	}
+}
+
+// SetSync says whether writes wait for the disk, without it a crash
+// may lose the last writes but the index stays consistent
+func (udc *UpsideDownCouch) SetSync(sync bool) {
+	udc.sync = sync
+}
+
+// SetTypeMappings indexes documents of each type with the fields of
+// the schema its mapping gives a path for, documents of other types
+// are not indexed
+func (udc *UpsideDownCouch) SetTypeMappings(discriminator *index.TypeDiscriminator, types map[string]map[string]string) {
+	udc.discriminator = discriminator
+	udc.types = types
+}
+
+// SetAnalysisWorkers sets how many documents of a batch are analyzed
+// at the same time
+func (udc *UpsideDownCouch) SetAnalysisWorkers(workers int) {
+	if workers < 1 {
+		workers = 1
 	}
+	udc.analysisWorkers = workers
 }
 
 func (udc *UpsideDownCouch) init() (err error) {
@@ -57,19 +96,16 @@ func (udc *UpsideDownCouch) init() (err error) {
 
 	// schema
 	for i, field := range udc.schema {
-		row := NewFieldRow(uint16(i), field.Name, field.Path, field.Analyzer, field.IncludeTermVectors)
+		row := NewFieldRow(uint16(i), field.Name, field.Path, field.Type, field.Analyzer, field.IncludeTermVectors, field.Store, field.Sortable, field.DateTimeLayouts)
 		rows = append(rows, row)
 
-		// instantiate the indexer for this field (if necessary)
-		_, ok := udc.analyzer[field.Analyzer]
-		if !ok {
-			var fieldAnalyzer *analysis.Analyzer
-			fieldAnalyzer, err = analysis.AnalyzerInstance(field.Analyzer)
-			if err != nil {
-				return
-			}
-			udc.analyzer[field.Analyzer] = fieldAnalyzer
+		// instantiate the analyzer for this field
+		var fieldAnalyzer *analysis.Analyzer
+		fieldAnalyzer, err = field.NewAnalyzer()
+		if err != nil {
+			return
 		}
+		udc.analyzer[field.Name] = fieldAnalyzer
 	}
 
 	return udc.batchRows(nil, rows, nil)
@@ -93,16 +129,13 @@ func (udc *UpsideDownCouch) loadSchema() (err error) {
 		field := fieldRow.Field()
 		schema = append(schema, field)
 
-		// instantiate the indexer for this field (if necessary)
-		_, ok := udc.analyzer[field.Analyzer]
-		if !ok {
-			var fieldAnalyzer *analysis.Analyzer
-			fieldAnalyzer, err = analysis.AnalyzerInstance(field.Analyzer)
-			if err != nil {
-				return
-			}
-			udc.analyzer[field.Analyzer] = fieldAnalyzer
+		// instantiate the analyzer for this field
+		var fieldAnalyzer *analysis.Analyzer
+		fieldAnalyzer, err = field.NewAnalyzer()
+		if err != nil {
+			return
 		}
+		udc.analyzer[field.Name] = fieldAnalyzer
 	}
 	err = it.GetError()
 	if err != nil {
@@ -119,25 +152,23 @@ func (udc *UpsideDownCouch) batchRows(addRows []UpsideDownCouchRow, updateRows [
 	// prepare batch
 	wb := levigo.NewWriteBatch()
 
+	// the term counters change once per batch, documents of the
+	// same batch sharing a term would overwrite each other's count
+	counters := make(map[string]*TermFrequencyRow)
+	counterDeltas := make(map[string]int64)
+	countTerm := func(tfr *TermFrequencyRow, delta int64) {
+		tr := NewTermFrequencyRow(tfr.term, tfr.field, nil, 0)
+		key := string(tr.Key())
+		counters[key] = tr
+		counterDeltas[key] += delta
+	}
+
 	// add
 	for _, row := range addRows {
 		tfr, ok := row.(*TermFrequencyRow)
 		if ok {
 			// need to increment counter
-			tr := NewTermFrequencyRow(tfr.term, tfr.field, nil, 0, 0)
-			val, err := udc.db.Get(ro, tr.Key())
-			if err != nil {
-				return err
-			}
-			if val != nil {
-				tr = ParseFromKeyValue(tr.Key(), val).(*TermFrequencyRow)
-				tr.freq += 1 // incr
-			} else {
-				tr = NewTermFrequencyRow(tfr.term, tfr.field, nil, 1, 0)
-			}
-
-			// now add this to the batch
-			wb.Put(tr.Key(), tr.Value())
+			countTerm(tfr, 1)
 		}
 		wb.Put(row.Key(), row.Value())
 	}
@@ -152,31 +183,43 @@ func (udc *UpsideDownCouch) batchRows(addRows []UpsideDownCouchRow, updateRows [
 		tfr, ok := row.(*TermFrequencyRow)
 		if ok {
 			// need to decrement counter
-			tr := NewTermFrequencyRow(tfr.term, tfr.field, nil, 0, 0)
-			val, err := udc.db.Get(ro, tr.Key())
-			if err != nil {
-				return err
-			}
-			if val != nil {
-				tr = ParseFromKeyValue(tr.Key(), val).(*TermFrequencyRow)
-				tr.freq -= 1 // incr
-			} else {
-				log.Panic(fmt.Sprintf("unexpected missing row, deleting term, expected count row to exit: %v", tr.Key()))
-			}
+			countTerm(tfr, -1)
+		}
+		wb.Delete(row.Key())
+	}
 
-			if tr.freq == 0 {
-				wb.Delete(tr.Key())
-			} else {
-				// now add this to the batch
-				wb.Put(tr.Key(), tr.Value())
-			}
+	// now apply the counter changes
+	for key, delta := range counterDeltas {
+		if delta == 0 {
+			continue
+		}
+		tr := counters[key]
+		val, err := udc.db.Get(ro, tr.Key())
+		if err != nil {
+			return err
+		}
+		var count int64
+		if val != nil {
+			tr = ParseFromKeyValue(tr.Key(), val).(*TermFrequencyRow)
+			count = int64(tr.freq)
+		}
+		count += delta
+		if count < 0 {
+			log.Panic(fmt.Sprintf("unexpected missing row, deleting term, expected count row to exit: %v", tr.Key()))
+		}
 
+		if count == 0 {
+			wb.Delete(tr.Key())
+		} else {
+			// now add this to the batch
+			tr.freq = uint64(count)
+			wb.Put(tr.Key(), tr.Value())
 		}
-		wb.Delete(row.Key())
 	}
 
 	// write out the batch
 	wo := defaultWriteOptions()
+	wo.SetSync(udc.sync)
 	err = udc.db.Write(wo, wb)
 	return
 }
@@ -185,11 +228,43 @@ func (udc *UpsideDownCouch) DocCount() uint64 {
 	return udc.docCount
 }
 
+func (udc *UpsideDownCouch) DocIDs(match func(id []byte) bool) ([]string, error) {
+	ro := defaultReadOptions()
+	ro.SetFillCache(false)
+	it := udc.db.NewIterator(ro)
+	defer it.Close()
+
+	// the back index is keyed by document id
+	rv := make([]string, 0)
+	it.Seek([]byte{'b'})
+	for it = it; it.Valid(); it.Next() {
+		if !bytes.HasPrefix(it.Key(), []byte{'b'}) {
+			break
+		}
+		id := it.Key()[1:]
+		if match == nil || match(id) {
+			rv = append(rv, string(id))
+		}
+	}
+	return rv, it.GetError()
+}
+
+func (udc *UpsideDownCouch) Fields() []*index.Field {
+	return udc.schema
+}
+
 func (udc *UpsideDownCouch) Open() (err error) {
 	udc.db, err = levigo.Open(udc.path, udc.opts)
 	if err != nil {
 		return
 	}
+	defer func() {
+		// an index which failed to open is closed, so that it can
+		// be removed and built again
+		if err != nil {
+			udc.Close()
+		}
+	}()
 
 	ro := defaultReadOptions()
 	var value []byte
@@ -205,6 +280,11 @@ func (udc *UpsideDownCouch) Open() (err error) {
 			return
 		}
 	} else {
+		versionRow := ParseFromKeyValue(VERSION_KEY, value).(*VersionRow)
+		if versionRow.version != udc.version {
+			err = IncompatibleVersion
+			return
+		}
 		err = udc.loadSchema()
 		if err != nil {
 			return
@@ -212,6 +292,8 @@ func (udc *UpsideDownCouch) Open() (err error) {
 	}
 	// set doc count
 	udc.docCount = udc.countDocs()
+	// set field length totals
+	udc.fieldTotals, err = udc.sumFieldLengths()
 	return
 }
 
@@ -234,6 +316,28 @@ func (udc *UpsideDownCouch) countDocs() uint64 {
 	return rv
 }
 
+func (udc *UpsideDownCouch) sumFieldLengths() ([]uint64, error) {
+	ro := defaultReadOptions()
+	ro.SetFillCache(false) // dont fill the cache with this
+	it := udc.db.NewIterator(ro)
+	defer it.Close()
+
+	rv := make([]uint64, len(udc.schema))
+
+	// begining of the field lengths
+	it.Seek([]byte{'n'})
+	for it = it; it.Valid(); it.Next() {
+		if !bytes.HasPrefix(it.Key(), []byte{'n'}) {
+			break
+		}
+		normRow := NewNormalizationRowKV(it.Key(), it.Value())
+		if int(normRow.field) < len(rv) {
+			rv[normRow.field] += normRow.length
+		}
+	}
+	return rv, it.GetError()
+}
+
 func (udc *UpsideDownCouch) rowCount() uint64 {
 	ro := defaultReadOptions()
 	ro.SetFillCache(false) // dont fill the cache with this
@@ -250,23 +354,268 @@ func (udc *UpsideDownCouch) rowCount() uint64 {
 }
 
 func (udc *UpsideDownCouch) Close() {
-	udc.db.Close()
+	if udc.db != nil {
+		udc.db.Close()
+		udc.db = nil
+	}
 }
 
 func (udc *UpsideDownCouch) Update(key, doc []byte) error {
+	return udc.UpdateWithCheckpoint(key, doc, nil)
+}
+
+func (udc *UpsideDownCouch) UpdateWithCheckpoint(key, doc []byte, checkpoint *index.Checkpoint) error {
+	fields, err := udc.analyzeDoc(udc.analyzer, key, doc)
+	if err != nil {
+		return err
+	}
+	if fields == nil {
+		// not a type we index, it may have been one before
+		return udc.DeleteWithCheckpoint(key, checkpoint)
+	}
+	changes, err := udc.updateChanges(key, fields)
+	if err != nil {
+		return err
+	}
+	return udc.applyChanges([]*docChanges{changes}, checkpointRows(checkpoint), nil)
+}
+
+func (udc *UpsideDownCouch) Delete(id []byte) error {
+	return udc.DeleteWithCheckpoint(id, nil)
+}
+
+func (udc *UpsideDownCouch) DeleteWithCheckpoint(id []byte, checkpoint *index.Checkpoint) error {
+	changes, err := udc.deleteChanges(id)
+	if err != nil {
+		return err
+	}
+	// a doc we never saw has nothing to delete, but the feed still moved on
+	rv := make([]*docChanges, 0, 1)
+	if changes != nil {
+		rv = append(rv, changes)
+	}
+	return udc.applyChanges(rv, checkpointRows(checkpoint), nil)
+}
+
+func (udc *UpsideDownCouch) Batch(batch *index.Batch) error {
+	fields, failed := udc.analyzeBatch(batch)
+
+	// the rows depend on what is already indexed for the document,
+	// every document is in the batch once so they don't interfere
+	changes := make([]*docChanges, 0, len(batch.Docs))
+	for id, doc := range batch.Docs {
+		var docChanges *docChanges
+		var err error
+		_, analysisFailed := failed[id]
+		if doc == nil || analysisFailed || fields[id] == nil {
+			// what was indexed for a failed document is out of date,
+			// and documents of other types may have been indexed before
+			docChanges, err = udc.deleteChanges([]byte(id))
+		} else {
+			docChanges, err = udc.updateChanges([]byte(id), fields[id])
+		}
+		if err != nil {
+			return err
+		}
+		if docChanges != nil {
+			changes = append(changes, docChanges)
+		}
+	}
+
+	checkpoints := make([]*index.Checkpoint, 0, len(batch.Checkpoints))
+	removedCheckpoints := make([]UpsideDownCouchRow, 0)
+	for vbucket, checkpoint := range batch.Checkpoints {
+		if checkpoint == nil {
+			removedCheckpoints = append(removedCheckpoints, NewCheckpointRow(vbucket, 0, 0, 0, 0))
+			continue
+		}
+		checkpoints = append(checkpoints, checkpoint)
+	}
+
+	err := udc.applyChanges(changes, checkpointRows(checkpoints...), removedCheckpoints)
+	if err != nil {
+		return err
+	}
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
+}
+
+type analysisWork struct {
+	id  string
+	doc []byte
+}
+
+type analysisResult struct {
+	id     string
+	fields []*analyzedField
+	err    error
+}
+
+// analyzeBatch analyzes the updated documents of the batch on a pool of
+// workers, returning the fields of each document and those that failed
+func (udc *UpsideDownCouch) analyzeBatch(batch *index.Batch) (map[string][]*analyzedField, index.DocErrors) {
+	rv := make(map[string][]*analyzedField)
+	failed := make(index.DocErrors)
+
+	work := make(chan *analysisWork)
+	results := make(chan *analysisResult)
+	for worker := 0; worker < udc.analysisWorkers; worker++ {
+		analyzers := udc.analyzersForWorker(worker)
+		go func() {
+			for item := range work {
+				fields, err := udc.analyzeDoc(analyzers, []byte(item.id), item.doc)
+				results <- &analysisResult{item.id, fields, err}
+			}
+		}()
+	}
+
+	updates := make([]*analysisWork, 0, len(batch.Docs))
+	for id, doc := range batch.Docs {
+		if doc != nil {
+			updates = append(updates, &analysisWork{id, doc})
+		}
+	}
+	go func() {
+		for _, item := range updates {
+			work <- item
+		}
+		close(work)
+	}()
+
+	for _ = range updates {
+		result := <-results
+		if result.err != nil {
+			failed[result.id] = result.err
+		} else {
+			rv[result.id] = result.fields
+		}
+	}
+	return rv, failed
+}
+
+func (udc *UpsideDownCouch) analyzersForWorker(worker int) map[string]*analysis.Analyzer {
+	for len(udc.workerAnalyzers) <= worker {
+		analyzers := make(map[string]*analysis.Analyzer)
+		for _, field := range udc.schema {
+			// the schema was checked when the index was opened
+			fieldAnalyzer, err := field.NewAnalyzer()
+			if err != nil {
+				log.Panic(fmt.Sprintf("unexpected analyzer error for field %s: %v", field.Name, err))
+			}
+			analyzers[field.Name] = fieldAnalyzer
+		}
+		udc.workerAnalyzers = append(udc.workerAnalyzers, analyzers)
+	}
+	return udc.workerAnalyzers[worker]
+}
+
+// analyzedField is a field of a document after analysis
+type analyzedField struct {
+	value      []byte
+	length     uint64
+	sortValue  []byte
+	tokenFreqs []*analysis.TokenFreq
+}
+
+// fieldsOfDoc returns the fields the document indexes, nil for those
+// its type has no path for, or no fields when the type isn't indexed
+func (udc *UpsideDownCouch) fieldsOfDoc(key, doc []byte) ([]*index.Field, error) {
+	if udc.discriminator == nil {
+		return udc.schema, nil
+	}
+	docType, err := udc.discriminator.DocType(key, doc)
+	if err != nil {
+		return nil, err
+	}
+	paths, ok := udc.types[docType]
+	if !ok {
+		return nil, nil
+	}
+	rv := make([]*index.Field, len(udc.schema))
+	for fieldIndex, field := range udc.schema {
+		path, ok := paths[field.Name]
+		if ok {
+			typeField := *field
+			typeField.Path = path
+			rv[fieldIndex] = &typeField
+		}
+	}
+	return rv, nil
+}
+
+// analyzeDoc returns nil fields for documents of types not indexed, it
+// only reads the index settings so documents can be analyzed in parallel
+func (udc *UpsideDownCouch) analyzeDoc(analyzers map[string]*analysis.Analyzer, key, doc []byte) (rv []*analyzedField, err error) {
+	// the JSON scanner can panic on malformed documents, that is a
+	// failure of the document and not of the index
+	defer func() {
+		if r := recover(); r != nil {
+			rv = nil
+			err = fmt.Errorf("malformed document: %v", r)
+		}
+	}()
+
+	fields, err := udc.fieldsOfDoc(key, doc)
+	if err != nil || fields == nil {
+		return nil, err
+	}
+
+	rv = make([]*analyzedField, len(fields))
+	for fieldIndex, field := range fields {
+		if field == nil {
+			rv[fieldIndex] = &analyzedField{}
+			continue
+		}
+		fieldValue, err := jsonpointer.Find(doc, field.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		tokens := analyzers[field.Name].Analyze(fieldValue)
+		rv[fieldIndex] = &analyzedField{
+			value:      fieldValue,
+			length:     uint64(len(tokens)), // number of tokens in this doc field
+			sortValue:  field.SortValue(fieldValue, tokens),
+			tokenFreqs: analysis.TokenFrequency(tokens),
+		}
+	}
+	return rv, nil
+}
+
+// docChanges are the rows to write for a change to one document, and
+// how it moves the doc count and field totals once written
+type docChanges struct {
+	addRows         []UpsideDownCouchRow
+	updateRows      []UpsideDownCouchRow
+	deleteRows      []UpsideDownCouchRow
+	docCountDelta   int
+	oldFieldLengths []uint64
+	newFieldLengths []uint64
+}
+
+func (udc *UpsideDownCouch) updateChanges(key []byte, fields []*analyzedField) (*docChanges, error) {
 
 	// first we lookup the backindex row for the doc id if it exists
 	// lookup the back index row
 	backIndexRow, err := udc.backIndexRowForDoc(key)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	var isAdd = true
 	// a map for each field, map key is term (string) bool true for existence
 	existingTermFieldMaps := make([]map[string]bool, len(udc.schema))
+	// the old and new field lengths, to maintain the field totals
+	oldFieldLengths := make([]uint64, len(udc.schema))
+	newFieldLengths := make([]uint64, len(udc.schema))
 	if backIndexRow != nil {
 		isAdd = false
+		oldFieldLengths, err = udc.fieldLengthsForDoc(key)
+		if err != nil {
+			return nil, err
+		}
 		for _, entry := range backIndexRow.entries {
 			existingTermFieldMap := existingTermFieldMaps[entry.field]
 			if existingTermFieldMap == nil {
@@ -280,6 +629,7 @@ func (udc *UpsideDownCouch) Update(key, doc []byte) error {
 	// prepare a list of rows
 	updateRows := make([]UpsideDownCouchRow, 0)
 	addRows := make([]UpsideDownCouchRow, 0)
+	deleteRows := make([]UpsideDownCouchRow, 0)
 
 	// track our back index entries
 	backIndexEntries := make([]*BackIndexEntry, 0)
@@ -287,24 +637,41 @@ func (udc *UpsideDownCouch) Update(key, doc []byte) error {
 	for fieldIndex, field := range udc.schema {
 
 		existingTermFieldMap := existingTermFieldMaps[fieldIndex]
+		analyzed := fields[fieldIndex]
+
+		if field.Store {
+			if analyzed.value != nil {
+				storedRow := NewStoredRow(key, uint16(fieldIndex), analyzed.value)
+				updateRows = append(updateRows, storedRow)
+			} else if !isAdd {
+				// the field may have been stored last time
+				storedRow := NewStoredRow(key, uint16(fieldIndex), nil)
+				deleteRows = append(deleteRows, storedRow)
+			}
+		}
 
-		fieldValue, err := jsonpointer.Find(doc, field.Path)
-		if err != nil {
-			return err
+		newFieldLengths[fieldIndex] = analyzed.length
+
+		// record the value the field sorts by
+		if analyzed.sortValue != nil {
+			docValueRow := NewDocValueRow(uint16(fieldIndex), key, analyzed.sortValue)
+			updateRows = append(updateRows, docValueRow)
+		} else if field.Sortable && !isAdd {
+			docValueRow := NewDocValueRow(uint16(fieldIndex), key, nil)
+			deleteRows = append(deleteRows, docValueRow)
 		}
 
-		analyzer := udc.analyzer[field.Analyzer]
-		tokens := analyzer.Analyze(fieldValue)
-		fieldLength := len(tokens) // number of tokens in this doc field
-		fieldNorm := float32(1.0 / math.Sqrt(float64(fieldLength)))
-		tokenFreqs := analysis.TokenFrequency(tokens)
-		for _, tf := range tokenFreqs {
+		// record the field length, norms are computed from it at search time
+		normRow := NewNormalizationRow(uint16(fieldIndex), key, analyzed.length)
+		updateRows = append(updateRows, normRow)
+
+		for _, tf := range analyzed.tokenFreqs {
 			var termFreqRow *TermFrequencyRow
 			if field.IncludeTermVectors {
 				tv := termVectorsFromTokenFreq(uint16(fieldIndex), tf)
-				termFreqRow = NewTermFrequencyRowWithTermVectors(tf.Term, uint16(fieldIndex), key, uint64(frequencyFromTokenFreq(tf)), fieldNorm, tv)
+				termFreqRow = NewTermFrequencyRowWithTermVectors(tf.Term, uint16(fieldIndex), key, uint64(frequencyFromTokenFreq(tf)), tv)
 			} else {
-				termFreqRow = NewTermFrequencyRow(tf.Term, uint16(fieldIndex), key, uint64(frequencyFromTokenFreq(tf)), fieldNorm)
+				termFreqRow = NewTermFrequencyRow(tf.Term, uint16(fieldIndex), key, uint64(frequencyFromTokenFreq(tf)))
 			}
 
 			// record the back index entry
@@ -337,50 +704,144 @@ func (udc *UpsideDownCouch) Update(key, doc []byte) error {
 	updateRows = append(updateRows, backIndexRow)
 
 	// any of the existing rows that weren't updated need to be deleted
-	deleteRows := make([]UpsideDownCouchRow, 0)
 	for fieldIndex, existingTermFieldMap := range existingTermFieldMaps {
 		if existingTermFieldMap != nil {
 			for termString, _ := range existingTermFieldMap {
-				termFreqRow := NewTermFrequencyRow([]byte(termString), uint16(fieldIndex), key, 0, 0)
+				termFreqRow := NewTermFrequencyRow([]byte(termString), uint16(fieldIndex), key, 0)
 				deleteRows = append(deleteRows, termFreqRow)
 			}
 		}
 	}
 
-	err = udc.batchRows(addRows, updateRows, deleteRows)
-	if err == nil && isAdd {
-		udc.docCount += 1
+	rv := docChanges{
+		addRows:         addRows,
+		updateRows:      updateRows,
+		deleteRows:      deleteRows,
+		oldFieldLengths: oldFieldLengths,
+		newFieldLengths: newFieldLengths,
 	}
-	return err
+	if isAdd {
+		rv.docCountDelta = 1
+	}
+	return &rv, nil
 }
 
-func (udc *UpsideDownCouch) Delete(id []byte) error {
+// deleteChanges returns nil when the doc is not in the index
+func (udc *UpsideDownCouch) deleteChanges(id []byte) (*docChanges, error) {
 	// lookup the back index row
 	backIndexRow, err := udc.backIndexRowForDoc(id)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if backIndexRow == nil {
-		return nil
+		return nil, nil
 	}
 
 	// prepare a list of rows to delete
 	rows := make([]UpsideDownCouchRow, 0)
 	for _, backIndexEntry := range backIndexRow.entries {
-		tfr := NewTermFrequencyRow(backIndexEntry.term, backIndexEntry.field, id, 0, 0)
+		tfr := NewTermFrequencyRow(backIndexEntry.term, backIndexEntry.field, id, 0)
 		rows = append(rows, tfr)
 	}
 
+	// delete the field lengths
+	oldFieldLengths, err := udc.fieldLengthsForDoc(id)
+	if err != nil {
+		return nil, err
+	}
+	for fieldIndex, field := range udc.schema {
+		rows = append(rows, NewNormalizationRow(uint16(fieldIndex), id, 0))
+		if field.Sortable {
+			rows = append(rows, NewDocValueRow(uint16(fieldIndex), id, nil))
+		}
+		if field.Store {
+			rows = append(rows, NewStoredRow(id, uint16(fieldIndex), nil))
+		}
+	}
+
 	// also delete the back entry itself
 	rows = append(rows, backIndexRow)
 
-	err = udc.batchRows(nil, nil, rows)
+	return &docChanges{
+		deleteRows:      rows,
+		docCountDelta:   -1,
+		oldFieldLengths: oldFieldLengths,
+		newFieldLengths: make([]uint64, len(udc.schema)),
+	}, nil
+}
+
+// applyChanges writes the changes to the documents in one batch, along
+// with the checkpoints
+func (udc *UpsideDownCouch) applyChanges(changes []*docChanges, checkpointRows []UpsideDownCouchRow, removedCheckpointRows []UpsideDownCouchRow) error {
+	addRows := make([]UpsideDownCouchRow, 0)
+	updateRows := make([]UpsideDownCouchRow, 0)
+	deleteRows := make([]UpsideDownCouchRow, 0)
+	for _, docChanges := range changes {
+		addRows = append(addRows, docChanges.addRows...)
+		updateRows = append(updateRows, docChanges.updateRows...)
+		deleteRows = append(deleteRows, docChanges.deleteRows...)
+	}
+	updateRows = append(updateRows, checkpointRows...)
+	deleteRows = append(deleteRows, removedCheckpointRows...)
+
+	err := udc.batchRows(addRows, updateRows, deleteRows)
 	if err == nil {
-		udc.docCount -= 1
+		for _, docChanges := range changes {
+			if docChanges.docCountDelta > 0 {
+				udc.docCount += 1
+			} else if docChanges.docCountDelta < 0 {
+				udc.docCount -= 1
+			}
+			for fieldIndex, _ := range udc.schema {
+				udc.fieldTotals[fieldIndex] -= docChanges.oldFieldLengths[fieldIndex]
+				udc.fieldTotals[fieldIndex] += docChanges.newFieldLengths[fieldIndex]
+			}
+		}
 	}
 	return err
 }
 
+func checkpointRows(checkpoints ...*index.Checkpoint) []UpsideDownCouchRow {
+	rv := make([]UpsideDownCouchRow, 0, len(checkpoints))
+	for _, checkpoint := range checkpoints {
+		if checkpoint != nil {
+			rv = append(rv, NewCheckpointRow(checkpoint.VBucket, checkpoint.VBuuid, checkpoint.Seq, checkpoint.SnapStart, checkpoint.SnapEnd))
+		}
+	}
+	return rv
+}
+
+func (udc *UpsideDownCouch) SetCheckpoint(checkpoint *index.Checkpoint) error {
+	row := NewCheckpointRow(checkpoint.VBucket, checkpoint.VBuuid, checkpoint.Seq, checkpoint.SnapStart, checkpoint.SnapEnd)
+	return udc.batchRows(nil, []UpsideDownCouchRow{row}, nil)
+}
+
+func (udc *UpsideDownCouch) Checkpoints() ([]*index.Checkpoint, error) {
+	ro := defaultReadOptions()
+	it := udc.db.NewIterator(ro)
+	defer it.Close()
+
+	rv := make([]*index.Checkpoint, 0)
+	it.Seek([]byte{'c'})
+	for it = it; it.Valid(); it.Next() {
+		if !bytes.HasPrefix(it.Key(), []byte{'c'}) {
+			break
+		}
+		checkpointRow, err := NewCheckpointRowKV(it.Key(), it.Value())
+		if err != nil {
+			return nil, err
+		}
+		rv = append(rv, &index.Checkpoint{
+			VBucket:   checkpointRow.vbucket,
+			VBuuid:    checkpointRow.vbuuid,
+			Seq:       checkpointRow.seq,
+			SnapStart: checkpointRow.snapStart,
+			SnapEnd:   checkpointRow.snapEnd,
+		})
+	}
+	return rv, it.GetError()
+}
+
 func (udc *UpsideDownCouch) backIndexRowForDoc(docId []byte) (*BackIndexRow, error) {
 	ro := defaultReadOptions()
 
@@ -429,6 +890,129 @@ func (udc *UpsideDownCouch) TermFieldReader(term []byte, fieldName string) (inde
 	return nil, fmt.Errorf("No field named `%s` in the schema", fieldName)
 }
 
+func (udc *UpsideDownCouch) FieldDict(fieldName string, start, end []byte) (index.FieldDict, error) {
+	for fieldIndex, field := range udc.schema {
+		if field.Name == fieldName {
+			return newUpsideDownCouchFieldDict(udc, uint16(fieldIndex), start, end)
+		}
+	}
+	return nil, fmt.Errorf("No field named `%s` in the schema", fieldName)
+}
+
+func (udc *UpsideDownCouch) FieldLength(id []byte, fieldName string) (uint64, error) {
+	for fieldIndex, field := range udc.schema {
+		if field.Name == fieldName {
+			return udc.fieldLength(uint16(fieldIndex), id)
+		}
+	}
+	return 0, fmt.Errorf("No field named `%s` in the schema", fieldName)
+}
+
+func (udc *UpsideDownCouch) AvgFieldLength(fieldName string) (float64, error) {
+	for fieldIndex, field := range udc.schema {
+		if field.Name == fieldName {
+			if udc.docCount == 0 {
+				return 0, nil
+			}
+			return float64(udc.fieldTotals[fieldIndex]) / float64(udc.docCount), nil
+		}
+	}
+	return 0, fmt.Errorf("No field named `%s` in the schema", fieldName)
+}
+
+func (udc *UpsideDownCouch) Document(id []byte) (map[string][]byte, error) {
+	backIndexRow, err := udc.backIndexRowForDoc(id)
+	if err != nil {
+		return nil, err
+	}
+	if backIndexRow == nil {
+		return nil, nil
+	}
+
+	ro := defaultReadOptions()
+	it := udc.db.NewIterator(ro)
+	defer it.Close()
+
+	rv := make(map[string][]byte)
+
+	keyPrefix := StoredRowDocPrefix(id)
+	it.Seek(keyPrefix)
+	for it = it; it.Valid(); it.Next() {
+		if !bytes.HasPrefix(it.Key(), keyPrefix) {
+			break
+		}
+		storedRow := NewStoredRowKV(it.Key(), it.Value())
+		if int(storedRow.field) < len(udc.schema) {
+			rv[udc.schema[storedRow.field].Name] = storedRow.value
+		}
+	}
+	err = it.GetError()
+	if err != nil {
+		return nil, err
+	}
+
+	return rv, nil
+}
+
+func (udc *UpsideDownCouch) DocumentFieldTerms(id []byte) (index.FieldTerms, error) {
+	backIndexRow, err := udc.backIndexRowForDoc(id)
+	if err != nil {
+		return nil, err
+	}
+	if backIndexRow == nil {
+		return nil, nil
+	}
+
+	rv := make(index.FieldTerms)
+	for _, entry := range backIndexRow.entries {
+		if int(entry.field) < len(udc.schema) {
+			fieldName := udc.schema[entry.field].Name
+			rv[fieldName] = append(rv[fieldName], string(entry.term))
+		}
+	}
+	return rv, nil
+}
+
+func (udc *UpsideDownCouch) SortValue(id []byte, fieldName string) ([]byte, error) {
+	for fieldIndex, field := range udc.schema {
+		if field.Name == fieldName {
+			if !field.Sortable {
+				return nil, fmt.Errorf("Field `%s` is not sortable", fieldName)
+			}
+			ro := defaultReadOptions()
+			docValueRow := NewDocValueRow(uint16(fieldIndex), id, nil)
+			return udc.db.Get(ro, docValueRow.Key())
+		}
+	}
+	return nil, fmt.Errorf("No field named `%s` in the schema", fieldName)
+}
+
+func (udc *UpsideDownCouch) fieldLength(field uint16, id []byte) (uint64, error) {
+	ro := defaultReadOptions()
+	normRow := NewNormalizationRow(field, id, 0)
+	value, err := udc.db.Get(ro, normRow.Key())
+	if err != nil {
+		return 0, err
+	}
+	if value == nil {
+		return 0, nil
+	}
+	normRow = ParseFromKeyValue(normRow.Key(), value).(*NormalizationRow)
+	return normRow.length, nil
+}
+
+func (udc *UpsideDownCouch) fieldLengthsForDoc(id []byte) ([]uint64, error) {
+	rv := make([]uint64, len(udc.schema))
+	for fieldIndex, _ := range udc.schema {
+		fieldLength, err := udc.fieldLength(uint16(fieldIndex), id)
+		if err != nil {
+			return nil, err
+		}
+		rv[fieldIndex] = fieldLength
+	}
+	return rv, nil
+}
+
 func defaultWriteOptions() *levigo.WriteOptions {
 	wo := levigo.NewWriteOptions()
 	// request fsync on write for safety
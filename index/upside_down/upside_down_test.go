@@ -11,10 +11,12 @@ package upside_down
 import (
 	"os"
 	"reflect"
+	"sort"
 	"testing"
 
 	_ "github.com/couchbaselabs/cbfullofit/analysis/analyzers/standard_analyzer"
 	"github.com/couchbaselabs/cbfullofit/index"
+	"github.com/couchbaselabs/cbfullofit/numeric"
 )
 
 func TestIndexOpenReopen(t *testing.T) {
@@ -73,6 +75,49 @@ func TestIndexOpenReopen(t *testing.T) {
 	idx.Close()
 }
 
+func TestIndexOpenIncompatibleVersion(t *testing.T) {
+	defer os.RemoveAll("test")
+
+	schema := []*index.Field{
+		&index.Field{
+			Name:     "name",
+			Path:     "/name",
+			Analyzer: "standard",
+		},
+	}
+	idx := NewUpsideDownCouch("test", schema)
+	err := idx.Open()
+	if err != nil {
+		t.Errorf("error opening index: %v", err)
+	}
+
+	// overwrite the version marker with an older version
+	versionRow := NewVersionRow(VERSION - 1)
+	err = idx.db.Put(defaultWriteOptions(), versionRow.Key(), versionRow.Value())
+	if err != nil {
+		t.Errorf("error writing version: %v", err)
+	}
+	idx.Close()
+
+	idx = NewUpsideDownCouch("test", schema)
+	err = idx.Open()
+	if err != IncompatibleVersion {
+		t.Errorf("expected incompatible version error, got: %v", err)
+	}
+	idx.Close()
+
+	// the failed index was closed, so it can be removed and rebuilt
+	err = os.RemoveAll("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Open()
+	if err != nil {
+		t.Errorf("error opening rebuilt index: %v", err)
+	}
+	idx.Close()
+}
+
 func TestIndexInsert(t *testing.T) {
 	defer os.RemoveAll("test")
 
@@ -109,8 +154,8 @@ func TestIndexInsert(t *testing.T) {
 		t.Errorf("Expected document count to be %d got %d", expectedCount, docCount)
 	}
 
-	// should have 4 rows (1 for version, 1 for schema field, and 1 for single term, and 1 for the term count,  and 1 for the back index entry)
-	expectedLength := uint64(1 + len(schema) + 1 + 1 + 1)
+	// should have 6 rows (1 for version, 1 for schema field, and 1 for single term, and 1 for the term count, 1 for the field length, and 1 for the back index entry)
+	expectedLength := uint64(1 + len(schema) + 1 + 1 + 1 + 1)
 	rowCount := idx.rowCount()
 	if rowCount != expectedLength {
 		t.Errorf("expected %d rows, got: %d", expectedLength, rowCount)
@@ -203,8 +248,8 @@ func TestIndexInsertThenUpdate(t *testing.T) {
 		t.Errorf("Error deleting entry from index: %v", err)
 	}
 
-	// should have 2 row (1 for version, 1 for schema field, and 2 for the two term, and 2 for the term counts, and 1 for the back index entry)
-	expectedLength := uint64(1 + len(schema) + 2 + 2 + 1)
+	// should have 2 row (1 for version, 1 for schema field, and 2 for the two term, and 2 for the term counts, 1 for the field length, and 1 for the back index entry)
+	expectedLength := uint64(1 + len(schema) + 2 + 2 + 1 + 1)
 	rowCount := idx.rowCount()
 	if rowCount != expectedLength {
 		t.Errorf("expected %d rows, got: %d", expectedLength, rowCount)
@@ -217,8 +262,8 @@ func TestIndexInsertThenUpdate(t *testing.T) {
 		t.Errorf("Error deleting entry from index: %v", err)
 	}
 
-	// should have 2 row (1 for version, 1 for schema field, and 1 for the remaining term, and 1 for the term count, and 1 for the back index entry)
-	expectedLength = uint64(1 + len(schema) + 1 + 1 + 1)
+	// should have 2 row (1 for version, 1 for schema field, and 1 for the remaining term, and 1 for the term count, 1 for the field length, and 1 for the back index entry)
+	expectedLength = uint64(1 + len(schema) + 1 + 1 + 1 + 1)
 	rowCount = idx.rowCount()
 	if rowCount != expectedLength {
 		t.Errorf("expected %d rows, got: %d", expectedLength, rowCount)
@@ -254,10 +299,608 @@ func TestIndexInsertMultiple(t *testing.T) {
 		t.Errorf("Error updating index: %v", err)
 	}
 
-	// should have 4 rows (1 for version, 1 for schema field, and 2 for single term, and 1 for the term count,  and 2 for the back index entries)
-	expectedLength := uint64(1 + len(schema) + 2 + 1 + 2)
+	// should have 4 rows (1 for version, 1 for schema field, and 2 for single term, and 1 for the term count, 2 for the field lengths, and 2 for the back index entries)
+	expectedLength := uint64(1 + len(schema) + 2 + 1 + 2 + 2)
+	rowCount := idx.rowCount()
+	if rowCount != expectedLength {
+		t.Errorf("expected %d rows, got: %d", expectedLength, rowCount)
+	}
+
+	ids, err := idx.DocIDs(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ids, []string{"1", "2"}) {
+		t.Errorf("expected ids 1 and 2, got %v", ids)
+	}
+	ids, err = idx.DocIDs(func(id []byte) bool {
+		return id[0] == '2'
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ids, []string{"2"}) {
+		t.Errorf("expected id 2, got %v", ids)
+	}
+}
+
+func TestIndexCheckpoints(t *testing.T) {
+	defer os.RemoveAll("test")
+
+	schema := []*index.Field{
+		&index.Field{
+			Name:     "name",
+			Path:     "/name",
+			Analyzer: "standard",
+		},
+	}
+	idx := NewUpsideDownCouch("test", schema)
+
+	err := idx.Open()
+	if err != nil {
+		t.Errorf("error opening index: %v", err)
+	}
+
+	doc := []byte(`{"name": "test"}`)
+	err = idx.UpdateWithCheckpoint([]byte{'1'}, doc, &index.Checkpoint{VBucket: 3, Seq: 5})
+	if err != nil {
+		t.Errorf("Error updating index: %v", err)
+	}
+	err = idx.UpdateWithCheckpoint([]byte{'2'}, doc, &index.Checkpoint{VBucket: 3, VBuuid: 42, Seq: 6, SnapStart: 4, SnapEnd: 8})
+	if err != nil {
+		t.Errorf("Error updating index: %v", err)
+	}
+	// deleting a doc the index never saw still moves the checkpoint
+	err = idx.DeleteWithCheckpoint([]byte{'3'}, &index.Checkpoint{VBucket: 1, Seq: 9})
+	if err != nil {
+		t.Errorf("Error deleting entry from index: %v", err)
+	}
+	err = idx.SetCheckpoint(&index.Checkpoint{VBucket: 7, Seq: 2})
+	if err != nil {
+		t.Errorf("Error setting checkpoint: %v", err)
+	}
+	idx.Close()
+
+	// checkpoints must survive reopening the index
+	idx = NewUpsideDownCouch("test", schema)
+	err = idx.Open()
+	if err != nil {
+		t.Errorf("error opening index: %v", err)
+	}
+	defer idx.Close()
+
+	checkpoints, err := idx.Checkpoints()
+	if err != nil {
+		t.Errorf("error reading checkpoints: %v", err)
+	}
+	expected := []*index.Checkpoint{
+		&index.Checkpoint{VBucket: 1, Seq: 9},
+		&index.Checkpoint{VBucket: 3, VBuuid: 42, Seq: 6, SnapStart: 4, SnapEnd: 8},
+		&index.Checkpoint{VBucket: 7, Seq: 2},
+	}
+	if !reflect.DeepEqual(checkpoints, expected) {
+		t.Errorf("expected checkpoints %v, got %v", expected, checkpoints)
+	}
+
+	// same rows as TestIndexInsertMultiple, plus 3 for the checkpoints
+	expectedLength := uint64(1 + len(schema) + 2 + 1 + 2 + 2 + 3)
+	rowCount := idx.rowCount()
+	if rowCount != expectedLength {
+		t.Errorf("expected %d rows, got: %d", expectedLength, rowCount)
+	}
+}
+
+// indexRows returns every row of the index, back index entries are
+// sorted as the order terms are found in isn't stable
+func indexRows(idx *UpsideDownCouch) map[string]string {
+	ro := defaultReadOptions()
+	it := idx.db.NewIterator(ro)
+	defer it.Close()
+
+	rv := make(map[string]string)
+	for it.Seek([]byte{0}); it.Valid(); it.Next() {
+		value := it.Value()
+		if it.Key()[0] == 'b' {
+			backIndexRow := NewBackIndexRowKV(it.Key(), it.Value())
+			sort.Sort(backIndexEntries(backIndexRow.entries))
+			value = backIndexRow.Value()
+		}
+		rv[string(it.Key())] = string(value)
+	}
+	return rv
+}
+
+type backIndexEntries []*BackIndexEntry
+
+func (e backIndexEntries) Len() int      { return len(e) }
+func (e backIndexEntries) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
+func (e backIndexEntries) Less(i, j int) bool {
+	if e[i].field != e[j].field {
+		return e[i].field < e[j].field
+	}
+	return string(e[i].term) < string(e[j].term)
+}
+
+func TestIndexBatch(t *testing.T) {
+	defer os.RemoveAll("test")
+	defer os.RemoveAll("test_batch")
+
+	schema := []*index.Field{
+		&index.Field{
+			Name:     "name",
+			Path:     "/name",
+			Analyzer: "standard",
+			Store:    true,
+		},
+	}
+
+	// the same changes, one at a time and in a batch
+	idx := NewUpsideDownCouch("test", schema)
+	err := idx.Open()
+	if err != nil {
+		t.Errorf("error opening index: %v", err)
+	}
+	defer idx.Close()
+	batchIdx := NewUpsideDownCouch("test_batch", schema)
+	batchIdx.SetSync(false)
+	batchIdx.SetAnalysisWorkers(2)
+	err = batchIdx.Open()
+	if err != nil {
+		t.Errorf("error opening index: %v", err)
+	}
+	defer batchIdx.Close()
+
+	for _, i := range []*UpsideDownCouch{idx, batchIdx} {
+		err = i.Update([]byte{'1'}, []byte(`{"name": "pale ale"}`))
+		if err != nil {
+			t.Errorf("Error updating index: %v", err)
+		}
+		err = i.Update([]byte{'2'}, []byte(`{"name": "brown ale"}`))
+		if err != nil {
+			t.Errorf("Error updating index: %v", err)
+		}
+	}
+
+	idx.Update([]byte{'1'}, []byte(`{"name": "pale lager"}`))
+	idx.Delete([]byte{'2'})
+	idx.Update([]byte{'3'}, []byte(`{"name": "amber ale"}`))
+	idx.Update([]byte{'4'}, []byte(`{"name": "amber lager"}`))
+	idx.SetCheckpoint(&index.Checkpoint{VBucket: 2, Seq: 8})
+
+	batch := index.NewBatch()
+	batch.Update([]byte{'1'}, []byte(`{"name": "pale stout"}`))
+	batch.Update([]byte{'1'}, []byte(`{"name": "pale lager"}`))
+	batch.Delete([]byte{'2'})
+	batch.Update([]byte{'3'}, []byte(`{"name": "amber ale"}`))
+	batch.Update([]byte{'4'}, []byte(`{"name": "amber lager"}`))
+	batch.Delete([]byte{'5'})
+	batch.SetCheckpoint(&index.Checkpoint{VBucket: 2, Seq: 7})
+	batch.SetCheckpoint(&index.Checkpoint{VBucket: 2, Seq: 8})
+	if batch.Size() != 5 {
+		t.Errorf("expected 5 documents in the batch, got %d", batch.Size())
+	}
+	err = batchIdx.Batch(batch)
+	if err != nil {
+		t.Errorf("Error applying batch: %v", err)
+	}
+
+	expectedRows := indexRows(idx)
+	rows := indexRows(batchIdx)
+	if !reflect.DeepEqual(rows, expectedRows) {
+		t.Errorf("expected batch to write rows %v, got %v", expectedRows, rows)
+	}
+	if batchIdx.DocCount() != 3 {
+		t.Errorf("expected document count to be 3 got %d", batchIdx.DocCount())
+	}
+	if !reflect.DeepEqual(batchIdx.fieldTotals, idx.fieldTotals) {
+		t.Errorf("expected field totals %v, got %v", idx.fieldTotals, batchIdx.fieldTotals)
+	}
+
+	// bad documents are removed, the rest is indexed
+	batch.Reset()
+	batch.Update([]byte{'6'}, []byte(`{"name": "porter"}`))
+	batch.Update([]byte{'3'}, []byte(`{"name": `))
+	err = batchIdx.Batch(batch)
+	docErrors, ok := err.(index.DocErrors)
+	if !ok || len(docErrors) != 1 || docErrors["3"] == nil {
+		t.Errorf("expected an error for document 3, got %v", err)
+	}
+	if batchIdx.DocCount() != 3 {
+		t.Errorf("expected document count to be 3 got %d", batchIdx.DocCount())
+	}
+	doc, err := batchIdx.Document([]byte{'3'})
+	if err != nil || doc != nil {
+		t.Errorf("expected document 3 to be removed, got %v, %v", doc, err)
+	}
+}
+
+func TestIndexTypeMappings(t *testing.T) {
+	defer os.RemoveAll("test")
+
+	schema := []*index.Field{
+		&index.Field{
+			Name:     "name",
+			Path:     "/name",
+			Analyzer: "standard",
+		},
+		&index.Field{
+			Name:     "city",
+			Path:     "/city",
+			Analyzer: "standard",
+		},
+	}
+
+	tests := []struct {
+		discriminator *index.TypeDiscriminator
+		docs          map[string]string
+		terms         map[string]index.FieldTerms
+	}{
+		{
+			discriminator: &index.TypeDiscriminator{Path: "/type"},
+			docs: map[string]string{
+				"1": `{"type": "beer", "name": "pale ale", "city": "ignored"}`,
+				"2": `{"type": "brewery", "brewery_name": "abbey", "city": "leuven"}`,
+				"3": `{"type": "user", "name": "marty"}`,
+				"4": `{"name": "untyped"}`,
+				"5": `{"type": 5, "name": "not a type"}`,
+			},
+			terms: map[string]index.FieldTerms{
+				"1": index.FieldTerms{"name": []string{"ale", "pale"}},
+				"2": index.FieldTerms{"name": []string{"abbey"}, "city": []string{"leuven"}},
+			},
+		},
+		{
+			discriminator: &index.TypeDiscriminator{KeyDelimiter: "::"},
+			docs: map[string]string{
+				"beer::1":    `{"name": "pale ale"}`,
+				"brewery::2": `{"brewery_name": "abbey", "city": "leuven"}`,
+				"user::3":    `{"name": "marty"}`,
+				"beer":       `{"name": "untyped"}`,
+			},
+			terms: map[string]index.FieldTerms{
+				"beer::1":    index.FieldTerms{"name": []string{"ale", "pale"}},
+				"brewery::2": index.FieldTerms{"name": []string{"abbey"}, "city": []string{"leuven"}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		idx := NewUpsideDownCouch("test", schema)
+		idx.SetTypeMappings(test.discriminator, map[string]map[string]string{
+			"beer":    map[string]string{"name": "/name"},
+			"brewery": map[string]string{"name": "/brewery_name", "city": "/city"},
+		})
+		err := idx.Open()
+		if err != nil {
+			t.Errorf("error opening index: %v", err)
+		}
+
+		for id, doc := range test.docs {
+			err = idx.Update([]byte(id), []byte(doc))
+			if err != nil {
+				t.Errorf("Error updating index: %v", err)
+			}
+		}
+		if idx.DocCount() != uint64(len(test.terms)) {
+			t.Errorf("expected %d documents, got %d", len(test.terms), idx.DocCount())
+		}
+		for id, _ := range test.docs {
+			terms, err := idx.DocumentFieldTerms([]byte(id))
+			if err != nil {
+				t.Errorf("error reading terms of %s: %v", id, err)
+			}
+			for _, fieldTerms := range terms {
+				sort.Strings(fieldTerms)
+			}
+			if !reflect.DeepEqual(terms, test.terms[id]) {
+				t.Errorf("expected %s to index %v, got %v", id, test.terms[id], terms)
+			}
+		}
+
+		// a document becoming a type which isn't indexed is removed
+		if test.discriminator.Path != "" {
+			err = idx.Update([]byte("1"), []byte(`{"type": "user", "name": "pale ale"}`))
+			if err != nil {
+				t.Errorf("Error updating index: %v", err)
+			}
+			if idx.DocCount() != uint64(len(test.terms)-1) {
+				t.Errorf("expected %d documents, got %d", len(test.terms)-1, idx.DocCount())
+			}
+		}
+
+		idx.Close()
+		os.RemoveAll("test")
+	}
+}
+
+func TestIndexAvgFieldLength(t *testing.T) {
+	defer os.RemoveAll("test")
+
+	schema := []*index.Field{
+		&index.Field{
+			Name:     "name",
+			Path:     "/name",
+			Analyzer: "standard",
+		},
+	}
+	idx := NewUpsideDownCouch("test", schema)
+	err := idx.Open()
+	if err != nil {
+		t.Errorf("error opening index: %v", err)
+	}
+
+	tests := []struct {
+		id     string
+		doc    string
+		delete bool
+		avg    float64
+	}{
+		{id: "1", doc: `{"name":"marty schoch"}`, avg: 2.0},
+		{id: "2", doc: `{"name":"steve"}`, avg: 1.5},
+		{id: "1", doc: `{"name":"marty alan schoch jr"}`, avg: 2.5},
+		{id: "2", delete: true, avg: 4.0},
+	}
+
+	for i, test := range tests {
+		if test.delete {
+			err = idx.Delete([]byte(test.id))
+		} else {
+			err = idx.Update([]byte(test.id), []byte(test.doc))
+		}
+		if err != nil {
+			t.Errorf("error updating index: %v", err)
+		}
+		avg, err := idx.AvgFieldLength("name")
+		if err != nil {
+			t.Errorf("error getting average field length: %v", err)
+		}
+		if avg != test.avg {
+			t.Errorf("expected average field length %f, got %f for test %d", test.avg, avg, i)
+		}
+	}
+	idx.Close()
+
+	// the totals are rebuilt when the index is reopened
+	idx = NewUpsideDownCouch("test", schema)
+	err = idx.Open()
+	if err != nil {
+		t.Errorf("error opening index: %v", err)
+	}
+	avg, err := idx.AvgFieldLength("name")
+	if err != nil {
+		t.Errorf("error getting average field length: %v", err)
+	}
+	if avg != 4.0 {
+		t.Errorf("expected average field length 4, got %f", avg)
+	}
+
+	_, err = idx.AvgFieldLength("desc")
+	if err == nil {
+		t.Errorf("expected error for unknown field")
+	}
+	idx.Close()
+}
+
+func TestIndexDocument(t *testing.T) {
+	defer os.RemoveAll("test")
+
+	schema := []*index.Field{
+		&index.Field{
+			Name:     "name",
+			Path:     "/name",
+			Analyzer: "standard",
+			Store:    true,
+		},
+		&index.Field{
+			Name:     "desc",
+			Path:     "/desc",
+			Analyzer: "standard",
+		},
+	}
+	idx := NewUpsideDownCouch("test", schema)
+	err := idx.Open()
+	if err != nil {
+		t.Errorf("error opening index: %v", err)
+	}
+	defer idx.Close()
+
+	err = idx.Update([]byte("1"), []byte(`{"name":"marty schoch","desc":"the man"}`))
+	if err != nil {
+		t.Errorf("error updating index: %v", err)
+	}
+
+	// only the stored field comes back
+	doc, err := idx.Document([]byte("1"))
+	if err != nil {
+		t.Errorf("error reading document: %v", err)
+	}
+	expectedDoc := map[string][]byte{
+		"name": []byte(`"marty schoch"`),
+	}
+	if !reflect.DeepEqual(doc, expectedDoc) {
+		t.Errorf("expected %s, got %s", expectedDoc, doc)
+	}
+
+	// version, schema, 3 terms with their counts, 2 field lengths, 1 stored value and the back index
+	expectedLength := uint64(1 + len(schema) + 3 + 3 + 2 + 1 + 1)
 	rowCount := idx.rowCount()
 	if rowCount != expectedLength {
 		t.Errorf("expected %d rows, got: %d", expectedLength, rowCount)
 	}
+
+	// an update without the field removes the stored value
+	err = idx.Update([]byte("1"), []byte(`{"desc":"the man"}`))
+	if err != nil {
+		t.Errorf("error updating index: %v", err)
+	}
+	doc, err = idx.Document([]byte("1"))
+	if err != nil {
+		t.Errorf("error reading document: %v", err)
+	}
+	if len(doc) != 0 {
+		t.Errorf("expected no stored fields, got %s", doc)
+	}
+
+	err = idx.Update([]byte("1"), []byte(`{"name":"marty"}`))
+	if err != nil {
+		t.Errorf("error updating index: %v", err)
+	}
+	err = idx.Delete([]byte("1"))
+	if err != nil {
+		t.Errorf("error deleting entry from index: %v", err)
+	}
+	doc, err = idx.Document([]byte("1"))
+	if err != nil {
+		t.Errorf("error reading document: %v", err)
+	}
+	if doc != nil {
+		t.Errorf("expected nil document after delete, got %s", doc)
+	}
+
+	// only the version and schema remain
+	expectedLength = uint64(1 + len(schema))
+	rowCount = idx.rowCount()
+	if rowCount != expectedLength {
+		t.Errorf("expected %d rows, got: %d", expectedLength, rowCount)
+	}
+}
+
+func TestIndexDocumentFieldTerms(t *testing.T) {
+	defer os.RemoveAll("test")
+
+	schema := []*index.Field{
+		&index.Field{
+			Name:     "name",
+			Path:     "/name",
+			Analyzer: "standard",
+		},
+		&index.Field{
+			Name:     "desc",
+			Path:     "/desc",
+			Analyzer: "standard",
+		},
+	}
+	idx := NewUpsideDownCouch("test", schema)
+	err := idx.Open()
+	if err != nil {
+		t.Errorf("error opening index: %v", err)
+	}
+	defer idx.Close()
+
+	err = idx.Update([]byte("1"), []byte(`{"name":"marty schoch","desc":"the man"}`))
+	if err != nil {
+		t.Errorf("error updating index: %v", err)
+	}
+
+	fieldTerms, err := idx.DocumentFieldTerms([]byte("1"))
+	if err != nil {
+		t.Errorf("error reading document field terms: %v", err)
+	}
+	for _, terms := range fieldTerms {
+		sort.Strings(terms)
+	}
+	expectedFieldTerms := index.FieldTerms{
+		"name": []string{"marty", "schoch"},
+		"desc": []string{"man"},
+	}
+	if !reflect.DeepEqual(fieldTerms, expectedFieldTerms) {
+		t.Errorf("expected %v, got %v", expectedFieldTerms, fieldTerms)
+	}
+
+	fieldTerms, err = idx.DocumentFieldTerms([]byte("2"))
+	if err != nil {
+		t.Errorf("error reading document field terms: %v", err)
+	}
+	if fieldTerms != nil {
+		t.Errorf("expected no field terms for a missing document, got %v", fieldTerms)
+	}
+}
+
+func TestIndexSortValue(t *testing.T) {
+	defer os.RemoveAll("test")
+
+	schema := []*index.Field{
+		&index.Field{
+			Name:     "name",
+			Path:     "/name",
+			Analyzer: "standard",
+			Sortable: true,
+		},
+		&index.Field{
+			Name:     "price",
+			Path:     "/price",
+			Type:     index.NUMERIC_FIELD,
+			Sortable: true,
+		},
+		&index.Field{
+			Name:     "desc",
+			Path:     "/desc",
+			Analyzer: "standard",
+		},
+	}
+	idx := NewUpsideDownCouch("test", schema)
+	err := idx.Open()
+	if err != nil {
+		t.Errorf("error opening index: %v", err)
+	}
+	defer idx.Close()
+
+	err = idx.Update([]byte("1"), []byte(`{"name":"Marty Schoch","price":3.5}`))
+	if err != nil {
+		t.Errorf("error updating index: %v", err)
+	}
+
+	sortValue, err := idx.SortValue([]byte("1"), "name")
+	if err != nil {
+		t.Errorf("error reading sort value: %v", err)
+	}
+	if string(sortValue) != "Marty Schoch" {
+		t.Errorf("expected sort value `Marty Schoch`, got `%s`", sortValue)
+	}
+
+	sortValue, err = idx.SortValue([]byte("1"), "price")
+	if err != nil {
+		t.Errorf("error reading sort value: %v", err)
+	}
+	expectedSortValue := numeric.MustNewPrefixCodedInt64(numeric.Float64ToInt64(3.5), 0)
+	if !reflect.DeepEqual(sortValue, []byte(expectedSortValue)) {
+		t.Errorf("expected sort value %v, got %v", expectedSortValue, sortValue)
+	}
+
+	// removing the price removes its sort value
+	err = idx.Update([]byte("1"), []byte(`{"name":"Marty Schoch"}`))
+	if err != nil {
+		t.Errorf("error updating index: %v", err)
+	}
+	sortValue, err = idx.SortValue([]byte("1"), "price")
+	if err != nil {
+		t.Errorf("error reading sort value: %v", err)
+	}
+	if sortValue != nil {
+		t.Errorf("expected no sort value, got %v", sortValue)
+	}
+
+	_, err = idx.SortValue([]byte("1"), "missing")
+	if err == nil {
+		t.Errorf("expected error for a field not in the schema")
+	}
+
+	// only sortable fields keep doc values
+	err = idx.Update([]byte("1"), []byte(`{"name":"Marty Schoch","desc":"the man"}`))
+	if err != nil {
+		t.Errorf("error updating index: %v", err)
+	}
+	_, err = idx.SortValue([]byte("1"), "desc")
+	if err == nil {
+		t.Errorf("expected error for a field which is not sortable")
+	}
+	docValues := 0
+	for key, _ := range indexRows(idx) {
+		if key[0] == 'd' {
+			docValues++
+		}
+	}
+	if docValues != 1 {
+		t.Errorf("expected 1 doc value, got %d", docValues)
+	}
 }
@@ -10,78 +10,378 @@ package main
 
 import (
 	"log"
+	"os"
+	"sync"
+	"time"
 
 	"github.com/couchbaselabs/cbfullofit/index"
 	"github.com/couchbaselabs/cbfullofit/index/upside_down"
-	"github.com/dustin/gomemcached/client"
+	"github.com/couchbaselabs/cbfullofit/search"
 )
 
+const (
+	INDEXER_STARTING = "starting"
+	INDEXER_BUILDING = "building"
+	INDEXER_LIVE     = "live"
+	INDEXER_STOPPED  = "stopped"
+)
+
+// IndexerStatus reports how far the indexer of a partition got, while
+// building DocsProcessed counts up to roughly EstimatedTotal
+type IndexerStatus struct {
+	Index          string `json:"index"`
+	Node           string `json:"node"`
+	Partition      string `json:"partition,omitempty"`
+	State          string `json:"state"`
+	DocsProcessed  uint64 `json:"docs_processed"`
+	EstimatedTotal uint64 `json:"estimated_total"`
+	DocCount       uint64 `json:"doc_count"`
+	DocErrors      uint64 `json:"doc_errors"`
+}
+
 type Indexer struct {
-	name   string
-	bucket string
-	index  index.Index
-	stop   StopChannel
+	name       string
+	bucket     string
+	path       string
+	partition  string
+	index      index.Index
+	schema     map[string]Field
+	similarity *search.SimilarityConfig
+	startFeed  FeedStarter
+	errors     *DeadLetters
+	stop       StopChannel
+	done       StopChannel
+
+	statusLock sync.Mutex
+	status     IndexerStatus
 }
 
-func NewIndexer(indexName string, bucket string, schema map[string]Field) *Indexer {
+// NewIndexer indexes the documents of the bucket of the index in the
+// vbuckets of the partition, all of them when the partition is empty
+func NewIndexer(indexDef *Index, partition string) (*Indexer, error) {
+	indexName := indexDef.Name
+	schema, err := indexDef.Fields()
+	if err != nil {
+		return nil, err
+	}
+
 	usdschema := make([]*index.Field, 0)
 	for fn, f := range schema {
 		usdschema = append(usdschema,
 			&index.Field{
-				Name:     fn,
-				Path:     f.Path,
-				Analyzer: f.Analyzer,
+				Name:               fn,
+				Path:               f.Path,
+				Type:               f.Type,
+				Analyzer:           f.Analyzer,
+				Store:              f.Store,
+				Sortable:           f.Sortable,
+				IncludeTermVectors: f.IncludeTermVectors,
+				DateTimeLayouts:    f.DateTimeLayouts,
 			},
 		)
 	}
-	return &Indexer{
-		name:   indexName,
-		bucket: bucket,
-		stop:   make(StopChannel),
-		index:  upside_down.NewUpsideDownCouch(*dataDir+"/"+indexName, usdschema),
+	path := *dataDir + "/" + indexName
+	udc := upside_down.NewUpsideDownCouch(path, usdschema)
+	udc.SetSync(*syncWrites)
+	if indexDef.TypeDiscriminator != nil {
+		udc.SetTypeMappings(indexDef.TypeDiscriminator.indexDiscriminator(), indexDef.typePaths())
 	}
+	return &Indexer{
+		name:       indexName,
+		bucket:     indexDef.Bucket,
+		path:       path,
+		partition:  partition,
+		schema:     schema,
+		similarity: indexDef.Similarity,
+		startFeed:  feedStarter,
+		errors:     NewDeadLetters(*maxDocErrors),
+		stop:       make(StopChannel),
+		done:       make(StopChannel),
+		index:      udc,
+		status: IndexerStatus{
+			Index:     indexName,
+			Node:      nodeID,
+			Partition: partition,
+			State:     INDEXER_STARTING,
+		},
+	}, nil
 }
 
 func (i *Indexer) Run() {
-	i.index.Open()
+	defer close(i.done)
+	defer i.setState(INDEXER_STOPPED)
+
+	err := i.index.Open()
+	if err == upside_down.IncompatibleVersion {
+		// the index was built by an older version, build it again
+		log.Printf("Indexer '%s' found an incompatible index, rebuilding", i.name)
+		err = os.RemoveAll(i.path)
+		if err == nil {
+			err = i.index.Open()
+		}
+	}
+	if err != nil {
+		log.Printf("unable to open index '%s': %v", i.name, err)
+		return
+	}
 	defer i.index.Close()
 
-	args := memcached.DefaultTapArguments()
-	args.Backfill = 0
-	args.Checkpoint = true
+	vbuckets, err := ParseVBucketRanges(i.partition)
+	if err != nil {
+		log.Printf("unable to index partition: %v", err)
+		return
+	}
+
+	checkpoints, err := i.index.Checkpoints()
+	if err != nil {
+		log.Printf("unable to read checkpoints: %v", err)
+		return
+	}
+	resumeFrom := make(map[uint16]*index.Checkpoint)
+	for _, checkpoint := range checkpoints {
+		resumeFrom[checkpoint.VBucket] = checkpoint
+	}
 
-	bucketDb, err := dbConnect(*cbServ, *cbPool, i.bucket)
+	// a rebalance may have moved vbuckets to other nodes, their
+	// documents go and they start over if they ever come back
+	err = i.dropMovedVBuckets(vbuckets, resumeFrom)
 	if err != nil {
-		log.Printf("unable to find bucket to index: %v", err)
+		log.Printf("unable to drop documents of moved vbuckets: %v", err)
 		return
 	}
 
-	feed, err := bucketDb.StartTapFeed(&args)
+	// the feed is named after the node, index and partition
+	feedName := "cbfullofit-" + nodeID + "-" + i.name + "-" + i.partition
+	feed, err := i.startFeed(feedName, i.bucket, vbuckets, resumeFrom)
 	if err != nil {
-		log.Fatalf("Error starting tap feed: %v", err)
+		log.Printf("unable to start feed of '%s': %v", i.bucket, err)
+		return
+	}
+	defer feed.Close()
+
+	// vbuckets still streaming the documents they had before the
+	// feed started, their checkpoints are only recorded once done
+	// so that a restart in the middle builds again
+	backfilling := make(map[uint16]bool)
+	for _, vbucket := range feed.Backfilling() {
+		backfilling[vbucket] = true
 	}
+	if len(backfilling) > 0 {
+		log.Printf("Indexer '%s' building %d vbuckets", i.name, len(backfilling))
+		i.startBuilding(feed.EstimatedItems(), i.index.DocCount())
+	} else {
+		log.Printf("Indexer '%s' resuming from checkpoints", i.name)
+		i.resume(i.index.DocCount())
+	}
+
+	// the snapshot each vbucket is streaming, a checkpoint taken in
+	// the middle of one has to resume it as a whole
+	snapshots := make(map[uint16][2]uint64)
+
+	// changes are written a batch at a time, when the batch is full
+	// or has waited long enough; checkpoints go in the same batch
+	batch := index.NewBatch()
+	var batchChanges uint64
+	ticker := time.NewTicker(*batchInterval)
+	defer ticker.Stop()
 
 OUTER:
 	for {
 		select {
-		case cbEvent, ok := <-feed.C:
-			if ok {
-				switch cbEvent.Opcode {
-				case memcached.TapMutation:
-					i.index.Update(cbEvent.Key, cbEvent.Value)
-				case memcached.TapDeletion:
-					i.index.Delete(cbEvent.Key)
+		case event, ok := <-feed.Events():
+			if !ok {
+				log.Printf("Indexer '%s' feed closed", i.name)
+				break OUTER
+			}
+			checkpoint := &index.Checkpoint{
+				VBucket:   event.VBucket,
+				VBuuid:    event.VBuuid,
+				Seq:       event.Seq,
+				SnapStart: event.Seq,
+				SnapEnd:   event.Seq,
+			}
+			if snapshot, ok := snapshots[event.VBucket]; ok && snapshot[0] <= event.Seq && event.Seq <= snapshot[1] {
+				checkpoint.SnapStart, checkpoint.SnapEnd = snapshot[0], snapshot[1]
+			}
+			switch event.Type {
+			case FEED_MUTATION:
+				batch.Update(event.Key, event.Value)
+				batchChanges += 1
+			case FEED_DELETION:
+				batch.Delete(event.Key)
+				batchChanges += 1
+			case FEED_SNAPSHOT:
+				snapshots[event.VBucket] = [2]uint64{event.Seq, event.SnapEnd}
+				continue
+			case FEED_BACKFILL_END:
+				if backfilling[event.VBucket] {
+					delete(backfilling, event.VBucket)
+					batch.SetCheckpoint(checkpoint)
+					if len(backfilling) == 0 {
+						i.flush(batch, batchChanges)
+						batchChanges = 0
+						log.Printf("Indexer '%s' built, indexing live mutations", i.name)
+						i.setState(INDEXER_LIVE)
+					}
+				}
+				continue
+			case FEED_ROLLBACK:
+				// the vbucket is indexed again from the start
+				log.Printf("Indexer '%s' vbucket %d rolled back, reindexing it", i.name, event.VBucket)
+				delete(snapshots, event.VBucket)
+				i.flush(batch, batchChanges)
+				batchChanges = 0
+				err = i.dropVBucket(batch, event.VBucket)
+				if err != nil {
+					log.Printf("unable to drop documents of vbucket %d: %v", event.VBucket, err)
+					break OUTER
 				}
+			default:
+				continue
+			}
+			if !backfilling[event.VBucket] {
+				batch.SetCheckpoint(checkpoint)
+			}
+			if batch.Size() >= *batchSize {
+				i.flush(batch, batchChanges)
+				batchChanges = 0
 			}
+		case <-ticker.C:
+			i.flush(batch, batchChanges)
+			batchChanges = 0
 		case <-i.stop:
 			log.Printf("Indexer '%s' asked to stop", i.name)
 			break OUTER
 		}
 	}
+	i.flush(batch, batchChanges)
 	log.Printf("Indexer '%s' stoped", i.name)
 }
 
+// dropVBucket deletes the documents of the vbucket in the batch
+func (i *Indexer) dropVBucket(batch *index.Batch, vbucket uint16) error {
+	ids, err := i.index.DocIDs(func(id []byte) bool {
+		return vbucketOf(string(id)) == vbucket
+	})
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		batch.Delete([]byte(id))
+	}
+	return nil
+}
+
+// dropMovedVBuckets deletes the documents and checkpoints of the
+// vbuckets outside the partition
+func (i *Indexer) dropMovedVBuckets(vbuckets VBucketRanges, checkpoints map[uint16]*index.Checkpoint) error {
+	if vbuckets == nil {
+		return nil
+	}
+	ids, err := i.index.DocIDs(func(id []byte) bool {
+		return !vbuckets.Contains(vbucketOf(string(id)))
+	})
+	if err != nil {
+		return err
+	}
+	batch := index.NewBatch()
+	for _, id := range ids {
+		batch.Delete([]byte(id))
+	}
+	for vbucket := range checkpoints {
+		if !vbuckets.Contains(vbucket) {
+			batch.RemoveCheckpoint(vbucket)
+			delete(checkpoints, vbucket)
+		}
+	}
+	if batch.Size() == 0 && len(batch.Checkpoints) == 0 {
+		return nil
+	}
+	log.Printf("Indexer '%s' dropping %d documents of moved vbuckets", i.name, len(ids))
+	return i.index.Batch(batch)
+}
+
+// flush writes the batch and starts the next one, changes counts the
+// feed events the batch holds before repeated keys were merged
+func (i *Indexer) flush(batch *index.Batch, changes uint64) {
+	if changes == 0 && len(batch.Checkpoints) == 0 {
+		return
+	}
+	err := i.index.Batch(batch)
+	if docErrors, ok := err.(index.DocErrors); ok {
+		for id, docErr := range docErrors {
+			i.errors.Record(id, docErr)
+		}
+	} else if err != nil {
+		// none of the batch made it, keep going with the next one
+		log.Printf("error indexing batch of %d documents: %v", batch.Size(), err)
+		for id, _ := range batch.Docs {
+			i.errors.Record(id, err)
+		}
+	}
+	i.processed(changes, i.index.DocCount())
+	batch.Reset()
+}
+
+func (i *Indexer) resume(docCount uint64) {
+	i.statusLock.Lock()
+	defer i.statusLock.Unlock()
+	i.status.State = INDEXER_LIVE
+	i.status.DocCount = docCount
+}
+
+func (i *Indexer) setState(state string) {
+	i.statusLock.Lock()
+	defer i.statusLock.Unlock()
+	i.status.State = state
+}
+
+func (i *Indexer) startBuilding(estimatedTotal uint64, docCount uint64) {
+	i.statusLock.Lock()
+	defer i.statusLock.Unlock()
+	i.status.State = INDEXER_BUILDING
+	i.status.DocsProcessed = 0
+	i.status.EstimatedTotal = estimatedTotal
+	i.status.DocCount = docCount
+}
+
+// processed counts changes, only the goroutine running the indexer
+// touches the index so it passes the document count along
+func (i *Indexer) processed(changes uint64, docCount uint64) {
+	i.statusLock.Lock()
+	defer i.statusLock.Unlock()
+	i.status.DocsProcessed += changes
+	i.status.DocCount = docCount
+}
+
+// Status is a snapshot of the progress of the indexer
+func (i *Indexer) Status() IndexerStatus {
+	i.statusLock.Lock()
+	defer i.statusLock.Unlock()
+	rv := i.status
+	rv.DocErrors = i.errors.Count()
+	return rv
+}
+
+// Errors returns the latest documents which failed to index
+func (i *Indexer) Errors() []*DocError {
+	return i.errors.Errors()
+}
+
+// Stopped tells if the indexer is no longer running, either asked to
+// stop or because its index or feed failed
+func (i *Indexer) Stopped() bool {
+	select {
+	case <-i.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Stop returns once the indexer has stopped and closed its index
 func (i *Indexer) Stop() {
 	log.Printf("Asking indexer '%s' to stop", i.name)
 	close(i.stop)
+	<-i.done
 }
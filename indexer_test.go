@@ -0,0 +1,475 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/couchbaselabs/cbfullofit/index"
+)
+
+var testSchema = map[string]Field{
+	"name": Field{
+		Path:     "/name",
+		Analyzer: "standard",
+	},
+}
+
+func startTestIndexer(bucket *memBucket, partition string) *Indexer {
+	return startTestIndexerOf(bucket, &Index{
+		Name:   "beers",
+		Bucket: "beer-sample",
+		Schema: testSchema,
+	}, partition)
+}
+
+func startTestIndexerOf(bucket *memBucket, indexDef *Index, partition string) *Indexer {
+	indexer, err := NewIndexer(indexDef, partition)
+	if err != nil {
+		panic(err)
+	}
+	indexer.startFeed = bucket.startFeed
+	go indexer.Run()
+	return indexer
+}
+
+// waitForStatus fails the test unless the status of the indexer
+// matches within a few seconds
+func waitForStatus(t *testing.T, indexer *Indexer, matches func(status IndexerStatus) bool) IndexerStatus {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status := indexer.Status()
+		if matches(status) {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for indexer, status: %#v", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func withDataDir(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "cbfullofit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldDataDir := *dataDir
+	*dataDir = dir
+	return func() {
+		*dataDir = oldDataDir
+		os.RemoveAll(dir)
+	}
+}
+
+func TestIndexerBuildsThenIndexesLive(t *testing.T) {
+	defer withDataDir(t)()
+
+	bucket := newMemBucket()
+	bucket.set("a", `{"name": "ale"}`)
+	bucket.set("b", `{"name": "bock"}`)
+	bucket.set("c", `{"name": "cider"}`)
+	bucket.set("c", `{"name": "cream ale"}`)
+
+	indexer := startTestIndexer(bucket, "")
+	status := waitForStatus(t, indexer, func(status IndexerStatus) bool {
+		return status.State == INDEXER_LIVE
+	})
+	if status.DocCount != 3 {
+		t.Errorf("expected 3 documents after the build, got %d", status.DocCount)
+	}
+	// the backfill only sees the latest version of c
+	if status.DocsProcessed != 3 || status.EstimatedTotal != 3 {
+		t.Errorf("expected 3 of 3 changes processed, got %d of %d", status.DocsProcessed, status.EstimatedTotal)
+	}
+
+	bucket.set("d", `{"name": "dubbel"}`)
+	bucket.delete("a")
+	status = waitForStatus(t, indexer, func(status IndexerStatus) bool {
+		return status.DocsProcessed == 5
+	})
+	if status.DocCount != 3 {
+		t.Errorf("expected 3 documents after live changes, got %d", status.DocCount)
+	}
+
+	indexer.Stop()
+	if indexer.Status().State != INDEXER_STOPPED {
+		t.Errorf("expected indexer to be stopped, got %s", indexer.Status().State)
+	}
+}
+
+func TestIndexerResumesFromCheckpoints(t *testing.T) {
+	defer withDataDir(t)()
+
+	bucket := newMemBucket()
+	bucket.set("a", `{"name": "ale"}`)
+	bucket.set("b", `{"name": "bock"}`)
+
+	indexer := startTestIndexer(bucket, "")
+	waitForStatus(t, indexer, func(status IndexerStatus) bool {
+		return status.State == INDEXER_LIVE
+	})
+	bucket.set("c", `{"name": "cider"}`)
+	waitForStatus(t, indexer, func(status IndexerStatus) bool {
+		return status.DocCount == 3
+	})
+	indexer.Stop()
+
+	// changes while the indexer is down
+	bucket.delete("a")
+	bucket.set("d", `{"name": "dubbel"}`)
+
+	indexer = startTestIndexer(bucket, "")
+	defer indexer.Stop()
+	status := waitForStatus(t, indexer, func(status IndexerStatus) bool {
+		return status.DocsProcessed == 2
+	})
+	if status.State != INDEXER_LIVE {
+		t.Errorf("expected indexer to resume live, got %s", status.State)
+	}
+	if status.DocCount != 3 {
+		t.Errorf("expected 3 documents after resuming, got %d", status.DocCount)
+	}
+	for id, expected := range map[string]bool{"a": false, "b": true, "c": true, "d": true} {
+		doc, err := indexer.index.Document([]byte(id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (doc != nil) != expected {
+			t.Errorf("expected document '%s' indexed: %t, got %v", id, expected, doc)
+		}
+	}
+}
+
+func TestIndexerPartition(t *testing.T) {
+	defer withDataDir(t)()
+
+	partition := "0-255,512-767"
+	vbuckets, err := ParseVBucketRanges(partition)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bucket := newMemBucket()
+	var expectedCount uint64
+	for _, key := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		bucket.set(key, `{"name": "beer"}`)
+		vbucket := vbucketOf(key)
+		if vbuckets.Contains(vbucket) {
+			expectedCount += 1
+		}
+	}
+
+	indexer := startTestIndexer(bucket, partition)
+	defer indexer.Stop()
+	status := waitForStatus(t, indexer, func(status IndexerStatus) bool {
+		return status.State == INDEXER_LIVE
+	})
+	if status.DocCount != expectedCount {
+		t.Errorf("expected %d documents in partition %s, got %d", expectedCount, partition, status.DocCount)
+	}
+}
+
+func TestIndexerDropsMovedVBuckets(t *testing.T) {
+	defer withDataDir(t)()
+
+	bucket := newMemBucket()
+	keys := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	for _, key := range keys {
+		bucket.set(key, `{"name": "beer"}`)
+	}
+
+	indexer := startTestIndexer(bucket, "")
+	waitForStatus(t, indexer, func(status IndexerStatus) bool {
+		return status.State == INDEXER_LIVE
+	})
+	indexer.Stop()
+
+	// a rebalance moved half the vbuckets away
+	partition := "0-255,512-767"
+	vbuckets, err := ParseVBucketRanges(partition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexer = startTestIndexer(bucket, partition)
+	defer indexer.Stop()
+	status := waitForStatus(t, indexer, func(status IndexerStatus) bool {
+		return status.State == INDEXER_LIVE
+	})
+	var expectedCount uint64
+	for _, key := range keys {
+		expected := vbuckets.Contains(vbucketOf(key))
+		if expected {
+			expectedCount += 1
+		}
+		doc, err := indexer.index.Document([]byte(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (doc != nil) != expected {
+			t.Errorf("expected document '%s' indexed: %t, got %v", key, expected, doc)
+		}
+	}
+	if status.DocCount != expectedCount {
+		t.Errorf("expected %d documents in partition %s, got %d", expectedCount, partition, status.DocCount)
+	}
+	checkpoints, err := indexer.index.Checkpoints()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, checkpoint := range checkpoints {
+		if !vbuckets.Contains(checkpoint.VBucket) {
+			t.Errorf("expected no checkpoint of moved vbucket %d", checkpoint.VBucket)
+		}
+	}
+}
+
+func TestIndexerBatches(t *testing.T) {
+	defer withDataDir(t)()
+
+	// only full batches and stopping write
+	oldBatchSize, oldBatchInterval := *batchSize, *batchInterval
+	*batchSize, *batchInterval = 2, time.Hour
+	defer func() {
+		*batchSize, *batchInterval = oldBatchSize, oldBatchInterval
+	}()
+
+	bucket := newMemBucket()
+	indexer := startTestIndexer(bucket, "")
+	waitForStatus(t, indexer, func(status IndexerStatus) bool {
+		return status.State == INDEXER_LIVE
+	})
+
+	bucket.set("a", `{"name": "ale"}`)
+	bucket.set("a", `{"name": "amber ale"}`)
+	bucket.set("b", `{"name": "bock"}`)
+	status := waitForStatus(t, indexer, func(status IndexerStatus) bool {
+		return status.DocsProcessed == 3
+	})
+	if status.DocCount != 2 {
+		t.Errorf("expected 2 documents, got %d", status.DocCount)
+	}
+
+	bucket.set("c", `{"name": "cider"}`)
+	time.Sleep(50 * time.Millisecond)
+	if indexer.Status().DocCount != 2 {
+		t.Errorf("expected the batch to wait for another change")
+	}
+
+	indexer.Stop()
+	if indexer.Status().DocCount != 3 {
+		t.Errorf("expected the last batch to be written on stop, got %d documents", indexer.Status().DocCount)
+	}
+}
+
+func TestIndexerRecordsBadDocuments(t *testing.T) {
+	defer withDataDir(t)()
+
+	bucket := newMemBucket()
+	bucket.set("a", `{"name": "ale"}`)
+	bucket.set("b", `not json`)
+
+	indexer := startTestIndexer(bucket, "")
+	defer indexer.Stop()
+	status := waitForStatus(t, indexer, func(status IndexerStatus) bool {
+		return status.State == INDEXER_LIVE
+	})
+	if status.DocCount != 1 || status.DocErrors != 1 {
+		t.Errorf("expected 1 document and 1 error, got %d and %d", status.DocCount, status.DocErrors)
+	}
+
+	// a good document going bad is removed, and the feed goes on
+	bucket.set("a", `{"name": `)
+	bucket.set("c", `{"name": "cider"}`)
+	status = waitForStatus(t, indexer, func(status IndexerStatus) bool {
+		return status.DocsProcessed == 4
+	})
+	if status.DocCount != 1 || status.DocErrors != 2 {
+		t.Errorf("expected 1 document and 2 errors, got %d and %d", status.DocCount, status.DocErrors)
+	}
+
+	errors := indexer.Errors()
+	if len(errors) != 2 || errors[0].Key != "b" || errors[1].Key != "a" {
+		t.Errorf("expected errors for b then a, got %v", errors)
+	}
+}
+
+func TestIndexerTypeMappings(t *testing.T) {
+	defer withDataDir(t)()
+
+	bucket := newMemBucket()
+	bucket.set("beer::1", `{"name": "pale ale"}`)
+	bucket.set("brewery::1", `{"brewery_name": "abbey"}`)
+	bucket.set("node::1", `{"name": "metadata"}`)
+
+	indexer := startTestIndexerOf(bucket, &Index{
+		Name:              "beers",
+		Bucket:            "beer-sample",
+		TypeDiscriminator: &TypeDiscriminator{KeyDelimiter: "::"},
+		Mappings: map[string]*TypeMapping{
+			"beer": &TypeMapping{Fields: testSchema},
+			"brewery": &TypeMapping{Fields: map[string]Field{
+				"name": Field{Path: "/brewery_name", Analyzer: "standard"},
+			}},
+		},
+	}, "")
+	defer indexer.Stop()
+
+	status := waitForStatus(t, indexer, func(status IndexerStatus) bool {
+		return status.State == INDEXER_LIVE
+	})
+	if status.DocCount != 2 || status.DocErrors != 0 {
+		t.Errorf("expected 2 documents and no errors, got %d and %d", status.DocCount, status.DocErrors)
+	}
+	terms, err := indexer.index.DocumentFieldTerms([]byte("brewery::1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(terms, index.FieldTerms{"name": []string{"abbey"}}) {
+		t.Errorf("expected the brewery name to be indexed, got %v", terms)
+	}
+}
+
+func TestIndexerRollsBack(t *testing.T) {
+	defer withDataDir(t)()
+
+	// another document in the vbucket of a
+	vbucket := vbucketOf("a")
+	other := ""
+	for n := 0; other == ""; n++ {
+		if key := fmt.Sprintf("k%d", n); vbucketOf(key) == vbucket {
+			other = key
+		}
+	}
+
+	bucket := newMemBucket()
+	bucket.set("a", `{"name": "ale"}`)
+
+	indexer := startTestIndexer(bucket, "")
+	waitForStatus(t, indexer, func(status IndexerStatus) bool {
+		return status.State == INDEXER_LIVE
+	})
+	bucket.set("a", `{"name": "amber ale"}`)
+	bucket.set(other, `{"name": "kolsch"}`)
+	waitForStatus(t, indexer, func(status IndexerStatus) bool {
+		return status.DocsProcessed == 3
+	})
+	indexer.Stop()
+
+	// the changes to a and the other document are lost, another
+	// change takes the sequence of the first
+	bucket.failover(vbucket, 1)
+	bucket.set("a", `{"name": "apa"}`)
+
+	indexer = startTestIndexer(bucket, "")
+	waitForStatus(t, indexer, func(status IndexerStatus) bool {
+		return status.DocsProcessed == 1
+	})
+	terms, err := indexer.index.DocumentFieldTerms([]byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(terms, index.FieldTerms{"name": []string{"apa"}}) {
+		t.Errorf("expected the change after the rollback to be indexed, got %v", terms)
+	}
+	terms, err = indexer.index.DocumentFieldTerms([]byte(other))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if terms != nil || indexer.Status().DocCount != 1 {
+		t.Errorf("expected the document created in the lost history to be dropped, got %v", terms)
+	}
+	indexer.Stop()
+
+	// the checkpoint moved to the new history, nothing is replayed
+	indexer = startTestIndexer(bucket, "")
+	defer indexer.Stop()
+	bucket.set("b", `{"name": "bock"}`)
+	status := waitForStatus(t, indexer, func(status IndexerStatus) bool {
+		return status.DocCount == 2
+	})
+	if status.DocsProcessed != 1 {
+		t.Errorf("expected only the new change to be processed, got %d", status.DocsProcessed)
+	}
+}
+
+func TestIndexerCheckpointsSnapshots(t *testing.T) {
+	defer withDataDir(t)()
+
+	bucket := newMemBucket()
+	bucket.set("a", `{"name": "ale"}`)
+
+	indexer := startTestIndexer(bucket, "")
+	waitForStatus(t, indexer, func(status IndexerStatus) bool {
+		return status.State == INDEXER_LIVE
+	})
+	indexer.Stop()
+
+	// both changes are replayed in one snapshot, only the latest is sent
+	bucket.set("a", `{"name": "amber ale"}`)
+	bucket.set("a", `{"name": "apa"}`)
+
+	indexer = startTestIndexer(bucket, "")
+	defer indexer.Stop()
+	waitForStatus(t, indexer, func(status IndexerStatus) bool {
+		return status.DocsProcessed == 1
+	})
+	checkpoints, err := indexer.index.Checkpoints()
+	if err != nil {
+		t.Fatal(err)
+	}
+	vbucket := vbucketOf("a")
+	for _, checkpoint := range checkpoints {
+		if checkpoint.VBucket != vbucket {
+			continue
+		}
+		if checkpoint.Seq != 3 || checkpoint.SnapStart != 2 || checkpoint.SnapEnd != 3 {
+			t.Errorf("expected checkpoint 3 in snapshot 2-3, got %d in %d-%d", checkpoint.Seq, checkpoint.SnapStart, checkpoint.SnapEnd)
+		}
+	}
+}
+
+func TestIndexerStopsWhenFeedEnds(t *testing.T) {
+	defer withDataDir(t)()
+
+	bucket := newMemBucket()
+	bucket.set("a", `{"name": "ale"}`)
+
+	indexer := startTestIndexer(bucket, "")
+	waitForStatus(t, indexer, func(status IndexerStatus) bool {
+		return status.State == INDEXER_LIVE
+	})
+	if indexer.Stopped() {
+		t.Errorf("expected indexer to be running")
+	}
+
+	// the assignments restart indexers which stopped on their own
+	bucket.endFeeds()
+	waitForStatus(t, indexer, func(status IndexerStatus) bool {
+		return status.State == INDEXER_STOPPED
+	})
+	<-indexer.done
+	if !indexer.Stopped() {
+		t.Errorf("expected indexer to be stopped")
+	}
+
+	indexer = startTestIndexer(bucket, "")
+	defer indexer.Stop()
+	status := waitForStatus(t, indexer, func(status IndexerStatus) bool {
+		return status.State == INDEXER_LIVE
+	})
+	if status.DocCount != 1 || status.DocsProcessed != 0 {
+		t.Errorf("expected the restarted indexer to resume from its checkpoint, got %d documents and %d processed", status.DocCount, status.DocsProcessed)
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/couchbaselabs/go-couchbase"
 	"github.com/gorilla/mux"
@@ -41,6 +42,14 @@ var cbBucket = flag.String("bucket", "cbfullofit", "couchbase bucket")
 
 var dataDir = flag.String("datadir", "data", "data storage directory")
 
+var feedType = flag.String("feed", "tap", "feed to index buckets from: tap or dcp")
+var batchSize = flag.Int("batchSize", 1000, "documents written to an index at once")
+var batchInterval = flag.Duration("batchInterval", 250*time.Millisecond, "longest a change waits to be written")
+var syncWrites = flag.Bool("sync", true, "wait for index writes to reach the disk")
+var maxDocErrors = flag.Int("maxDocErrors", 100, "document errors kept for each index")
+var maxResultWindow = flag.Int("maxResultWindow", 10000, "most hits a search may page through, from plus size")
+var feedStarter FeedStarter
+
 var dump = flag.Bool("dump", false, "dump index contents")
 
 type myFileHandler struct {
@@ -89,6 +98,11 @@ func main() {
 		log.Fatalf("error making data directory")
 	}
 
+	feedStarter, err = lookupFeedStarter(*feedType)
+	if err != nil {
+		log.Fatalf("Error choosing feed: %v", err)
+	}
+
 	// find my nodeID or generate a new one if it doesn't exist
 	nodeID = getOrGenerateNodeID()
 	log.Printf("NodeID: %s", nodeID)
@@ -117,6 +131,8 @@ func main() {
 	r.HandleFunc("/api/index/{index}", deleteIndex).Methods("DELETE")
 	r.HandleFunc("/api/index/{index}/_searchTerm", searchIndexTerm).Methods("GET")
 	r.HandleFunc("/api/index/{index}/_search", searchIndex).Methods("POST")
+	r.HandleFunc("/api/index/{index}/_status", indexStatus).Methods("GET")
+	r.HandleFunc("/api/index/{index}/_errors", indexErrors).Methods("GET")
 	//r.HandleFunc("/api/index/{index}/_searchAllTerms", searchIndexAllTerms).Methods("GET")
 	r.HandleFunc("/api/node/", serveNodesList).Methods("GET")
 
@@ -9,6 +9,7 @@
 package main
 
 import (
+	"net"
 	"time"
 )
 
@@ -21,3 +22,27 @@ type IndexerNode struct {
 	Version  string    `json:"version"`
 	Name     string    `json:"name"`
 }
+
+// URL is where the node serves the API, on the host it binds to
+// or, when it listens on all interfaces, the address it heartbeats from
+func (n *IndexerNode) URL() string {
+	host, port, err := net.SplitHostPort(n.BindAddr)
+	if err != nil {
+		return "http://" + n.BindAddr
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = n.Addr
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// lookupNode returns the last heartbeat of the node, the heartbeat
+// expires when the node stops so only live nodes are found
+func lookupNode(name string) (*IndexerNode, error) {
+	var rv IndexerNode
+	err := db.Get("node_"+name, &rv)
+	if err != nil {
+		return nil, err
+	}
+	return &rv, nil
+}
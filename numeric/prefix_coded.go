@@ -0,0 +1,83 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package numeric
+
+import (
+	"fmt"
+)
+
+// SHIFT_START_INT64 is the first byte of an int64 prefix coded
+// term shifted by zero, the shift is added to it
+const SHIFT_START_INT64 byte = 0x20
+
+// PrefixCoded is a sortable term encoding an int64 with its lower
+// shift bits dropped, 7 bits to a byte so that it never contains
+// the 0xff row separator
+type PrefixCoded []byte
+
+func NewPrefixCodedInt64(in int64, shift uint) (PrefixCoded, error) {
+	if shift > 63 {
+		return nil, fmt.Errorf("cannot shift %d, must be between 0 and 63", shift)
+	}
+
+	nChars := ((63 - shift) / 7) + 1
+	rv := make(PrefixCoded, nChars+1)
+	rv[0] = SHIFT_START_INT64 + byte(shift)
+
+	// flip the sign bit so that negative numbers sort first
+	sortableBits := (uint64(in) ^ 0x8000000000000000) >> shift
+	for nChars > 0 {
+		rv[nChars] = byte(sortableBits & 0x7f)
+		nChars--
+		sortableBits >>= 7
+	}
+	return rv, nil
+}
+
+func MustNewPrefixCodedInt64(in int64, shift uint) PrefixCoded {
+	rv, err := NewPrefixCodedInt64(in, shift)
+	if err != nil {
+		panic(err)
+	}
+	return rv
+}
+
+// Shift returns the number of lower bits dropped from the value
+func (p PrefixCoded) Shift() (uint, error) {
+	if len(p) > 0 {
+		shift := p[0] - SHIFT_START_INT64
+		if shift < 64 {
+			return uint(shift), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid prefix coded value")
+}
+
+// Int64 returns the value with its lower shift bits zeroed
+func (p PrefixCoded) Int64() (int64, error) {
+	shift, err := p.Shift()
+	if err != nil {
+		return 0, err
+	}
+	var sortableBits uint64
+	for _, b := range p[1:] {
+		sortableBits <<= 7
+		sortableBits |= uint64(b & 0x7f)
+	}
+	return int64((sortableBits << shift) ^ 0x8000000000000000), nil
+}
+
+func (p PrefixCoded) String() string {
+	shift, err := p.Shift()
+	if err != nil {
+		return fmt.Sprintf("PrefixCoded[% x]", []byte(p))
+	}
+	value, _ := p.Int64()
+	return fmt.Sprintf("PrefixCoded[shift=%d, value=%d]", shift, value)
+}
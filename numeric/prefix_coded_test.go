@@ -0,0 +1,87 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package numeric
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestPrefixCodedInt64(t *testing.T) {
+	tests := []struct {
+		input  int64
+		shift  uint
+		output PrefixCoded
+	}{
+		{
+			input:  1,
+			shift:  0,
+			output: PrefixCoded{0x20, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01},
+		},
+		{
+			input:  -1,
+			shift:  0,
+			output: PrefixCoded{0x20, 0x00, 0x7f, 0x7f, 0x7f, 0x7f, 0x7f, 0x7f, 0x7f, 0x7f, 0x7f},
+		},
+		{
+			input:  0,
+			shift:  60,
+			output: PrefixCoded{0x5c, 0x08},
+		},
+	}
+
+	for _, test := range tests {
+		actual, err := NewPrefixCodedInt64(test.input, test.shift)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(actual, test.output) {
+			t.Errorf("expected %#v got %#v for %d shift %d", test.output, actual, test.input, test.shift)
+		}
+		shift, err := actual.Shift()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if shift != test.shift {
+			t.Errorf("expected shift %d got %d", test.shift, shift)
+		}
+		value, err := actual.Int64()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectedValue := int64(uint64(test.input) >> test.shift << test.shift)
+		if value != expectedValue {
+			t.Errorf("expected value %d got %d", expectedValue, value)
+		}
+	}
+
+	_, err := NewPrefixCodedInt64(1, 64)
+	if err == nil {
+		t.Errorf("expected error shifting by 64")
+	}
+}
+
+func TestPrefixCodedSortOrder(t *testing.T) {
+	values := []float64{math.Inf(-1), -1e300, -2.5, -1, -0.5, 0, 0.25, 1, 3.75, 1e300, math.Inf(1)}
+	for _, shift := range []uint{0, 4, 32} {
+		var prev PrefixCoded
+		for _, value := range values {
+			i := Float64ToInt64(value)
+			if Int64ToFloat64(i) != value {
+				t.Errorf("expected %v to round trip, got %v", value, Int64ToFloat64(i))
+			}
+			curr := MustNewPrefixCodedInt64(i, shift)
+			if prev != nil && bytes.Compare(prev, curr) > 0 {
+				t.Errorf("expected %v to sort after %v at shift %d", value, prev, shift)
+			}
+			prev = curr
+		}
+	}
+}
@@ -0,0 +1,79 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package numeric
+
+// PRECISION_STEP is the number of bits dropped between the
+// successive terms indexed for a value, smaller steps index more
+// terms per value and expand ranges to fewer terms
+const PRECISION_STEP uint = 4
+
+// Terms lists the prefix coded terms indexed for the value, one
+// for each multiple of PRECISION_STEP
+func Terms(in int64) []PrefixCoded {
+	rv := make([]PrefixCoded, 0, 64/PRECISION_STEP)
+	for shift := uint(0); shift < 64; shift += PRECISION_STEP {
+		rv = append(rv, MustNewPrefixCodedInt64(in, shift))
+	}
+	return rv
+}
+
+// SplitInt64Range returns the smallest set of terms indexed by
+// Terms which together match the values from min to max inclusive,
+// none if min is greater than max
+func SplitInt64Range(min, max int64) []PrefixCoded {
+	rv := make([]PrefixCoded, 0)
+	if min > max {
+		return rv
+	}
+
+	for shift := uint(0); ; shift += PRECISION_STEP {
+		diff := int64(1) << (shift + PRECISION_STEP)
+		mask := ((int64(1) << PRECISION_STEP) - 1) << shift
+		hasLower := (min & mask) != 0
+		hasUpper := (max & mask) != mask
+
+		nextMin := min
+		if hasLower {
+			nextMin += diff
+		}
+		nextMin &^= mask
+		nextMax := max
+		if hasUpper {
+			nextMax -= diff
+		}
+		nextMax &^= mask
+		lowerWrapped := nextMin < min
+		upperWrapped := nextMax > max
+
+		if shift+PRECISION_STEP >= 64 || nextMin > nextMax || lowerWrapped || upperWrapped {
+			// what is left is covered by terms of this precision
+			rv = appendRange(rv, min, max, shift)
+			break
+		}
+
+		if hasLower {
+			rv = appendRange(rv, min, min|mask, shift)
+		}
+		if hasUpper {
+			rv = appendRange(rv, max&^mask, max, shift)
+		}
+		min = nextMin
+		max = nextMax
+	}
+	return rv
+}
+
+// appendRange adds the terms of the shift from min to max
+func appendRange(rv []PrefixCoded, min, max int64, shift uint) []PrefixCoded {
+	count := (uint64(max-min) >> shift) + 1
+	for i := uint64(0); i < count; i++ {
+		rv = append(rv, MustNewPrefixCodedInt64(min+int64(i<<shift), shift))
+	}
+	return rv
+}
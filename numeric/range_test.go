@@ -0,0 +1,92 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package numeric
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSplitInt64Range(t *testing.T) {
+	tests := []struct {
+		min   int64
+		max   int64
+		terms int
+	}{
+		{
+			min:   5,
+			max:   5,
+			terms: 1,
+		},
+		{
+			// 0-15 is a single term at shift 4
+			min:   0,
+			max:   15,
+			terms: 1,
+		},
+		{
+			// 1-15 at shift 0, 16-31 at shift 4, 32 at shift 0
+			min:   1,
+			max:   32,
+			terms: 17,
+		},
+		{
+			min:   math.MinInt64,
+			max:   math.MaxInt64,
+			terms: 16,
+		},
+		{
+			min:   10,
+			max:   9,
+			terms: 0,
+		},
+	}
+
+	for _, test := range tests {
+		terms := SplitInt64Range(test.min, test.max)
+		if len(terms) != test.terms {
+			t.Errorf("expected %d terms got %d for %d-%d", test.terms, len(terms), test.min, test.max)
+		}
+	}
+}
+
+func TestSplitInt64RangeMatches(t *testing.T) {
+	values := []int64{math.MinInt64, -1000, -17, -16, -1, 0, 1, 15, 16, 255, 256, 1000, 1 << 40, math.MaxInt64}
+	ranges := [][2]int64{
+		{-16, 255},
+		{-1000, -1},
+		{1, 1 << 40},
+		{0, math.MaxInt64},
+		{math.MinInt64, 0},
+		{17, 254},
+	}
+
+	for _, r := range ranges {
+		rangeTerms := make(map[string]bool)
+		for _, term := range SplitInt64Range(r[0], r[1]) {
+			rangeTerms[string(term)] = true
+		}
+		for _, value := range values {
+			// exactly one indexed term of a value in range is a range term
+			matches := 0
+			for _, term := range Terms(value) {
+				if rangeTerms[string(term)] {
+					matches++
+				}
+			}
+			inRange := value >= r[0] && value <= r[1]
+			if inRange && matches != 1 {
+				t.Errorf("expected %d in %v to match once, matched %d times", value, r, matches)
+			}
+			if !inRange && matches != 0 {
+				t.Errorf("expected %d outside %v not to match, matched %d times", value, r, matches)
+			}
+		}
+	}
+}
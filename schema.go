@@ -8,12 +8,153 @@
 //  and limitations under the License.
 package main
 
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/couchbaselabs/cbfullofit/index"
+)
+
 type Field struct {
-	Path     string `json:"path"`
-	Analyzer string `json:"analyzer"`
+	Path               string   `json:"path"`
+	Type               string   `json:"type,omitempty"`
+	Analyzer           string   `json:"analyzer"`
+	Store              bool     `json:"store,omitempty"`
+	Sortable           bool     `json:"sortable,omitempty"`
+	IncludeTermVectors bool     `json:"include_term_vectors,omitempty"`
+	DateTimeLayouts    []string `json:"datetime_layouts,omitempty"`
 }
 
 type Schema struct {
 	Name   string           `json:"name"`
 	Fields map[string]Field `json:"fields"`
 }
+
+// IsText reports whether values of the field are analyzed text
+func (f *Field) IsText() bool {
+	return f.Type == "" || f.Type == index.TEXT_FIELD
+}
+
+func (f *Field) Validate() error {
+	switch f.Type {
+	case "", index.TEXT_FIELD:
+		if f.Analyzer == "" {
+			return fmt.Errorf("text fields must specify an analyzer")
+		}
+	case index.NUMERIC_FIELD:
+	case index.DATETIME_FIELD:
+		for _, layout := range f.DateTimeLayouts {
+			if layout == "" {
+				return fmt.Errorf("datetime layouts must not be empty")
+			}
+		}
+	default:
+		return fmt.Errorf("unknown type '%s'", f.Type)
+	}
+	return nil
+}
+
+// TypeDiscriminator tells the type of documents, from the string at
+// Path or from the key up to the first KeyDelimiter
+type TypeDiscriminator struct {
+	Path         string `json:"path,omitempty"`
+	KeyDelimiter string `json:"key_delimiter,omitempty"`
+}
+
+func (d *TypeDiscriminator) Validate() error {
+	if (d.Path == "") == (d.KeyDelimiter == "") {
+		return fmt.Errorf("type discriminator must specify either a path or a key delimiter")
+	}
+	return nil
+}
+
+func (d *TypeDiscriminator) indexDiscriminator() *index.TypeDiscriminator {
+	return &index.TypeDiscriminator{
+		Path:         d.Path,
+		KeyDelimiter: d.KeyDelimiter,
+	}
+}
+
+// TypeMapping lists the fields documents of a type index
+type TypeMapping struct {
+	Fields map[string]Field `json:"fields"`
+}
+
+func (i *Index) ValidateMappings() error {
+	if i.TypeDiscriminator == nil {
+		if len(i.Mappings) > 0 {
+			return fmt.Errorf("mappings need a type discriminator")
+		}
+		return nil
+	}
+	err := i.TypeDiscriminator.Validate()
+	if err != nil {
+		return err
+	}
+	for typeName, mapping := range i.Mappings {
+		if mapping == nil {
+			return fmt.Errorf("type '%s' has no mapping", typeName)
+		}
+		for fieldName, field := range mapping.Fields {
+			err = field.Validate()
+			if err != nil {
+				return fmt.Errorf("error validating field '%s' of type '%s': %v", fieldName, typeName, err)
+			}
+		}
+	}
+	_, err = i.Fields()
+	return err
+}
+
+// Fields merges the schema with the fields of every type mapping,
+// fields of the same name may only differ in their path
+func (i *Index) Fields() (map[string]Field, error) {
+	rv := make(map[string]Field)
+	for fieldName, field := range i.Schema {
+		rv[fieldName] = field
+	}
+	for _, typeName := range i.typeNames() {
+		for fieldName, field := range i.Mappings[typeName].Fields {
+			existing, ok := rv[fieldName]
+			if !ok {
+				rv[fieldName] = field
+			} else if !sameIndexing(existing, field) {
+				return nil, fmt.Errorf("field '%s' of type '%s' is indexed differently elsewhere", fieldName, typeName)
+			}
+		}
+	}
+	return rv, nil
+}
+
+// typePaths maps each type to the paths of the fields it indexes
+func (i *Index) typePaths() map[string]map[string]string {
+	rv := make(map[string]map[string]string)
+	for typeName, mapping := range i.Mappings {
+		paths := make(map[string]string)
+		for fieldName, field := range i.Schema {
+			paths[fieldName] = field.Path
+		}
+		for fieldName, field := range mapping.Fields {
+			paths[fieldName] = field.Path
+		}
+		rv[typeName] = paths
+	}
+	return rv
+}
+
+// typeNames are sorted so merging fields doesn't depend on map order
+func (i *Index) typeNames() []string {
+	rv := make([]string, 0, len(i.Mappings))
+	for typeName, _ := range i.Mappings {
+		rv = append(rv, typeName)
+	}
+	sort.Strings(rv)
+	return rv
+}
+
+func sameIndexing(a, b Field) bool {
+	a.Path = ""
+	b.Path = ""
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,105 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIndexMappings(t *testing.T) {
+	name := Field{Path: "/name", Analyzer: "standard"}
+	breweryName := Field{Path: "/brewery_name", Analyzer: "standard"}
+	abv := Field{Path: "/abv", Type: "numeric"}
+	keywordName := Field{Path: "/name", Analyzer: "keyword"}
+
+	tests := []struct {
+		index  Index
+		valid  bool
+		fields map[string]Field
+		paths  map[string]map[string]string
+	}{
+		{
+			index: Index{
+				Schema: map[string]Field{"name": name},
+			},
+			valid:  true,
+			fields: map[string]Field{"name": name},
+			paths:  map[string]map[string]string{},
+		},
+		{
+			index: Index{
+				Schema:            map[string]Field{"name": name},
+				TypeDiscriminator: &TypeDiscriminator{Path: "/type"},
+				Mappings: map[string]*TypeMapping{
+					"beer":    &TypeMapping{Fields: map[string]Field{"abv": abv}},
+					"brewery": &TypeMapping{Fields: map[string]Field{"name": breweryName}},
+				},
+			},
+			valid:  true,
+			fields: map[string]Field{"name": name, "abv": abv},
+			paths: map[string]map[string]string{
+				"beer":    map[string]string{"name": "/name", "abv": "/abv"},
+				"brewery": map[string]string{"name": "/brewery_name"},
+			},
+		},
+		// mappings without a discriminator
+		{
+			index: Index{
+				Mappings: map[string]*TypeMapping{
+					"beer": &TypeMapping{Fields: map[string]Field{"abv": abv}},
+				},
+			},
+		},
+		// a discriminator needs exactly one of path and key delimiter
+		{
+			index: Index{
+				TypeDiscriminator: &TypeDiscriminator{Path: "/type", KeyDelimiter: "::"},
+			},
+		},
+		// a field indexed differently by two types
+		{
+			index: Index{
+				TypeDiscriminator: &TypeDiscriminator{KeyDelimiter: "::"},
+				Mappings: map[string]*TypeMapping{
+					"beer":    &TypeMapping{Fields: map[string]Field{"name": name}},
+					"brewery": &TypeMapping{Fields: map[string]Field{"name": keywordName}},
+				},
+			},
+		},
+		{
+			index: Index{
+				TypeDiscriminator: &TypeDiscriminator{KeyDelimiter: "::"},
+				Mappings:          map[string]*TypeMapping{"beer": nil},
+			},
+		},
+	}
+
+	for i, test := range tests {
+		err := test.index.ValidateMappings()
+		if (err == nil) != test.valid {
+			t.Errorf("test %d: expected valid %t, got error %v", i, test.valid, err)
+			continue
+		}
+		if !test.valid {
+			continue
+		}
+		fields, err := test.index.Fields()
+		if err != nil {
+			t.Errorf("test %d: error merging fields: %v", i, err)
+		}
+		if !reflect.DeepEqual(fields, test.fields) {
+			t.Errorf("test %d: expected fields %v, got %v", i, test.fields, fields)
+		}
+		paths := test.index.typePaths()
+		if !reflect.DeepEqual(paths, test.paths) {
+			t.Errorf("test %d: expected paths %v, got %v", i, test.paths, paths)
+		}
+	}
+}
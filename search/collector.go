@@ -9,33 +9,95 @@
 package search
 
 import (
-	"container/list"
+	"container/heap"
+	"context"
+	"sort"
 	"time"
 )
 
 type Collector interface {
-	Collect(searcher Searcher) error
+	// Collect stops at the first error, the hits collected
+	// so far remain available from Results
+	Collect(ctx context.Context, searcher Searcher) error
 	Results() DocumentMatchCollection
 	Total() uint64
 	MaxScore() float64
 	Took() time.Duration
 }
 
+// MAX_PREALLOCATED_HITS bounds the room collectors make for hits up
+// front, past it their heap grows with the hits actually found
+const MAX_PREALLOCATED_HITS = 1024
+
+// preallocatedHits is the room for the k hits after skip and the
+// one being compared against them
+func preallocatedHits(k, skip int) int {
+	if k+skip+1 > MAX_PREALLOCATED_HITS {
+		return MAX_PREALLOCATED_HITS
+	}
+	return k + skip + 1
+}
+
+// SearchAfter is a cursor on the hits ordered by score, the hits
+// following it have a lower score, or the same score and a lower ID
+type SearchAfter struct {
+	Score float64 `json:"score"`
+	ID    string  `json:"id"`
+}
+
+// NewSearchAfter is the cursor following the hit
+func NewSearchAfter(dm *DocumentMatch) *SearchAfter {
+	return &SearchAfter{
+		Score: dm.Score,
+		ID:    dm.ID,
+	}
+}
+
+// precedes tells if the hit comes before or at the cursor
+func (sa *SearchAfter) precedes(dm *DocumentMatch) bool {
+	if dm.Score != sa.Score {
+		return dm.Score > sa.Score
+	}
+	return dm.ID >= sa.ID
+}
+
+// TopScoreCollector keeps the k best scoring hits, at equal scores
+// the higher ID ranks higher. The hits are kept in a heap with the
+// worst one on top, a hit that cannot beat it is dropped right away.
+// Once the heap is full its lowest score is passed down to searchers
+// implementing MinScoreSearcher, so they can skip scoring such hits.
 type TopScoreCollector struct {
 	k        int
-	results  *list.List
+	skip     int
+	after    *SearchAfter
+	results  *scoreHeap
 	took     time.Duration
 	maxScore float64
 	total    uint64
 }
 
 func NewTopScorerCollector(k int) *TopScoreCollector {
+	return NewTopScorerSkipCollector(k, 0)
+}
+
+// NewTopScorerSkipCollector collects the k best hits
+// after skipping the skip best ones
+func NewTopScorerSkipCollector(k, skip int) *TopScoreCollector {
 	return &TopScoreCollector{
-		k:       k,
-		results: list.New(),
+		k:    k,
+		skip: skip,
+		results: &scoreHeap{
+			matches: make(DocumentMatchCollection, 0, preallocatedHits(k, skip)),
+		},
 	}
 }
 
+// SetSearchAfter only keeps the hits following the cursor,
+// the hits before it still count towards the total
+func (tksc *TopScoreCollector) SetSearchAfter(after *SearchAfter) {
+	tksc.after = after
+}
+
 func (tksc *TopScoreCollector) Total() uint64 {
 	return tksc.total
 }
@@ -48,12 +110,16 @@ func (tksc *TopScoreCollector) Took() time.Duration {
 	return tksc.took
 }
 
-func (tksc *TopScoreCollector) Collect(searcher Searcher) error {
+func (tksc *TopScoreCollector) Collect(ctx context.Context, searcher Searcher) error {
 	startTime := time.Now()
-	next, err := searcher.Next()
+	minScorer, _ := searcher.(MinScoreSearcher)
+	next, err := searcher.Next(ctx)
 	for err == nil && next != nil {
 		tksc.collectSingle(next)
-		next, err = searcher.Next()
+		if minScorer != nil && tksc.full() {
+			minScorer.SetMinScore(tksc.results.matches[0].Score)
+		}
+		next, err = searcher.Next(ctx)
 	}
 	// compute search duration
 	tksc.took = time.Since(startTime)
@@ -72,33 +138,86 @@ func (tksc *TopScoreCollector) collectSingle(dm *DocumentMatch) {
 		tksc.maxScore = dm.Score
 	}
 
-	for e := tksc.results.Front(); e != nil; e = e.Next() {
-		curr := e.Value.(*DocumentMatch)
-		if dm.Score < curr.Score {
-
-			tksc.results.InsertBefore(dm, e)
-			// if we just made the list too long
-			if tksc.results.Len() > tksc.k {
-				// remove the head
-				tksc.results.Remove(tksc.results.Front())
-			}
-			return
-		}
+	if tksc.after != nil && tksc.after.precedes(dm) {
+		return
+	}
+
+	size := tksc.k + tksc.skip
+	if size <= 0 {
+		return
+	}
+	if tksc.results.Len() < size {
+		heap.Push(tksc.results, dm)
+		return
 	}
-	// if we got to the end, we still have to add it
-	tksc.results.PushBack(dm)
-	if tksc.results.Len() > tksc.k {
-		// remove the head
-		tksc.results.Remove(tksc.results.Front())
+	// replace the worst hit if this one ranks higher
+	if scoreRanksHigher(dm, tksc.results.matches[0]) {
+		tksc.results.matches[0] = dm
+		heap.Fix(tksc.results, 0)
 	}
 }
 
+// full tells if a hit has to beat the worst one kept to be collected
+func (tksc *TopScoreCollector) full() bool {
+	size := tksc.k + tksc.skip
+	return size > 0 && tksc.results.Len() >= size
+}
+
 func (tksc *TopScoreCollector) Results() DocumentMatchCollection {
+	if tksc.results.Len() <= tksc.skip {
+		return DocumentMatchCollection{}
+	}
 	rv := make(DocumentMatchCollection, tksc.results.Len())
-	i := 0
-	for e := tksc.results.Back(); e != nil; e = e.Prev() {
-		rv[i] = e.Value.(*DocumentMatch)
-		i++
+	copy(rv, tksc.results.matches)
+	sort.Sort(sort.Reverse(&scoreHeap{matches: rv}))
+	return rv[tksc.skip:]
+}
+
+// MergeTopScores combines collections of hits ranked by score, as
+// returned by searches of different partitions of an index, keeping
+// the k best after skipping the skip best ones
+func MergeTopScores(k, skip int, collections ...DocumentMatchCollection) DocumentMatchCollection {
+	collector := NewTopScorerSkipCollector(k, skip)
+	for _, collection := range collections {
+		for _, dm := range collection {
+			collector.collectSingle(dm)
+		}
 	}
+	return collector.Results()
+}
+
+// scoreRanksHigher orders hits by score, then by ID
+func scoreRanksHigher(a, b *DocumentMatch) bool {
+	if a.Score != b.Score {
+		return a.Score > b.Score
+	}
+	return a.ID > b.ID
+}
+
+// scoreHeap is a heap.Interface with the lowest ranking hit on top
+type scoreHeap struct {
+	matches DocumentMatchCollection
+}
+
+func (h *scoreHeap) Len() int {
+	return len(h.matches)
+}
+
+func (h *scoreHeap) Less(i, j int) bool {
+	return scoreRanksHigher(h.matches[j], h.matches[i])
+}
+
+func (h *scoreHeap) Swap(i, j int) {
+	h.matches[i], h.matches[j] = h.matches[j], h.matches[i]
+}
+
+func (h *scoreHeap) Push(x interface{}) {
+	h.matches = append(h.matches, x.(*DocumentMatch))
+}
+
+func (h *scoreHeap) Pop() interface{} {
+	n := len(h.matches)
+	rv := h.matches[n-1]
+	h.matches = h.matches[:n-1]
 	return rv
 }
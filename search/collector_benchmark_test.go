@@ -0,0 +1,206 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package search
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// listTopScoreCollector is the linked list TopScoreCollector the
+// heap replaced, kept to check and benchmark against
+type listTopScoreCollector struct {
+	k        int
+	skip     int
+	after    *SearchAfter
+	results  *list.List
+	took     time.Duration
+	maxScore float64
+	total    uint64
+}
+
+func newListTopScoreCollector(k, skip int) *listTopScoreCollector {
+	return &listTopScoreCollector{
+		k:       k,
+		skip:    skip,
+		results: list.New(),
+	}
+}
+
+func (tksc *listTopScoreCollector) Total() uint64 {
+	return tksc.total
+}
+
+func (tksc *listTopScoreCollector) MaxScore() float64 {
+	return tksc.maxScore
+}
+
+func (tksc *listTopScoreCollector) Took() time.Duration {
+	return tksc.took
+}
+
+func (tksc *listTopScoreCollector) Collect(ctx context.Context, searcher Searcher) error {
+	startTime := time.Now()
+	next, err := searcher.Next(ctx)
+	for err == nil && next != nil {
+		tksc.collectSingle(next)
+		next, err = searcher.Next(ctx)
+	}
+	// compute search duration
+	tksc.took = time.Since(startTime)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (tksc *listTopScoreCollector) collectSingle(dm *DocumentMatch) {
+	// increment total hits
+	tksc.total += 1
+
+	// update max score
+	if dm.Score > tksc.maxScore {
+		tksc.maxScore = dm.Score
+	}
+
+	if tksc.after != nil && tksc.after.precedes(dm) {
+		return
+	}
+
+	for e := tksc.results.Front(); e != nil; e = e.Next() {
+		curr := e.Value.(*DocumentMatch)
+		if dm.Score < curr.Score {
+
+			tksc.results.InsertBefore(dm, e)
+			// if we just made the list too long
+			if tksc.results.Len() > tksc.k+tksc.skip {
+				// remove the head
+				tksc.results.Remove(tksc.results.Front())
+			}
+			return
+		}
+	}
+	// if we got to the end, we still have to add it
+	tksc.results.PushBack(dm)
+	if tksc.results.Len() > tksc.k+tksc.skip {
+		// remove the head
+		tksc.results.Remove(tksc.results.Front())
+	}
+}
+
+func (tksc *listTopScoreCollector) Results() DocumentMatchCollection {
+	if tksc.results.Len() <= tksc.skip {
+		return DocumentMatchCollection{}
+	}
+	rv := make(DocumentMatchCollection, tksc.results.Len()-tksc.skip)
+	i := 0
+	for e := tksc.results.Back(); e != nil; e = e.Prev() {
+		if i >= tksc.skip {
+			rv[i-tksc.skip] = e.Value.(*DocumentMatch)
+		}
+		i++
+	}
+	return rv
+}
+
+// randomMatches are n hits in ID order, scores are
+// drawn from few values so that many of them tie
+func randomMatches(n int, seed int64) DocumentMatchCollection {
+	r := rand.New(rand.NewSource(seed))
+	rv := make(DocumentMatchCollection, n)
+	for i := 0; i < n; i++ {
+		rv[i] = &DocumentMatch{
+			ID:    fmt.Sprintf("%08d", i),
+			Score: float64(r.Intn(100)) / 10,
+		}
+	}
+	return rv
+}
+
+func TestTopScoreCollectorMatchesListCollector(t *testing.T) {
+	matches := randomMatches(5000, 1)
+	tests := []struct {
+		k     int
+		skip  int
+		after *SearchAfter
+	}{
+		{k: 1},
+		{k: 10},
+		{k: 1000},
+		{k: 10, skip: 25},
+		{k: 10000},
+		{k: 10, after: &SearchAfter{Score: 5, ID: "00002500"}},
+	}
+
+	for _, test := range tests {
+		heapCollector := NewTopScorerSkipCollector(test.k, test.skip)
+		heapCollector.SetSearchAfter(test.after)
+		err := heapCollector.Collect(context.Background(), &stubSearcher{matches: matches})
+		if err != nil {
+			t.Fatal(err)
+		}
+		listCollector := newListTopScoreCollector(test.k, test.skip)
+		listCollector.after = test.after
+		err = listCollector.Collect(context.Background(), &stubSearcher{matches: matches})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(heapCollector.Results(), listCollector.Results()) {
+			t.Errorf("heap and list collectors disagree for k=%d skip=%d", test.k, test.skip)
+		}
+		if heapCollector.Total() != listCollector.Total() {
+			t.Errorf("expected total %d, got %d", listCollector.Total(), heapCollector.Total())
+		}
+		if heapCollector.MaxScore() != listCollector.MaxScore() {
+			t.Errorf("expected max score %f, got %f", listCollector.MaxScore(), heapCollector.MaxScore())
+		}
+	}
+}
+
+func benchmarkCollector(b *testing.B, newCollector func() Collector, n int) {
+	matches := randomMatches(n, 1)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		collector := newCollector()
+		err := collector.Collect(context.Background(), &stubSearcher{matches: matches})
+		if err != nil {
+			b.Fatal(err)
+		}
+		collector.Results()
+	}
+}
+
+func BenchmarkTopScoreCollector10(b *testing.B) {
+	benchmarkCollector(b, func() Collector { return NewTopScorerCollector(10) }, 100000)
+}
+
+func BenchmarkListTopScoreCollector10(b *testing.B) {
+	benchmarkCollector(b, func() Collector { return newListTopScoreCollector(10, 0) }, 100000)
+}
+
+func BenchmarkTopScoreCollector100(b *testing.B) {
+	benchmarkCollector(b, func() Collector { return NewTopScorerCollector(100) }, 100000)
+}
+
+func BenchmarkListTopScoreCollector100(b *testing.B) {
+	benchmarkCollector(b, func() Collector { return newListTopScoreCollector(100, 0) }, 100000)
+}
+
+func BenchmarkTopScoreCollector1000(b *testing.B) {
+	benchmarkCollector(b, func() Collector { return NewTopScorerCollector(1000) }, 100000)
+}
+
+func BenchmarkListTopScoreCollector1000(b *testing.B) {
+	benchmarkCollector(b, func() Collector { return newListTopScoreCollector(1000, 0) }, 100000)
+}
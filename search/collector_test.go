@@ -0,0 +1,353 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package search
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/couchbaselabs/cbfullofit/index"
+	"github.com/couchbaselabs/cbfullofit/index/mock"
+)
+
+// stubSearcher returns the given matches in order
+type stubSearcher struct {
+	matches DocumentMatchCollection
+	index   int
+}
+
+func (s *stubSearcher) Next(ctx context.Context) (*DocumentMatch, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if s.index >= len(s.matches) {
+		return nil, nil
+	}
+	rv := s.matches[s.index]
+	s.index++
+	return rv, nil
+}
+
+func (s *stubSearcher) Advance(ctx context.Context, ID string) (*DocumentMatch, error) {
+	for s.index < len(s.matches) && s.matches[s.index].ID < ID {
+		s.index++
+	}
+	return s.Next(ctx)
+}
+
+func (s *stubSearcher) Close()                     {}
+func (s *stubSearcher) Weight() float64            { return 1.0 }
+func (s *stubSearcher) SetQueryNorm(qnorm float64) {}
+func (s *stubSearcher) Count() uint64              { return uint64(len(s.matches)) }
+
+func newStubSearcher() *stubSearcher {
+	return &stubSearcher{
+		matches: DocumentMatchCollection{
+			&DocumentMatch{ID: "a", Score: 1},
+			&DocumentMatch{ID: "b", Score: 5},
+			&DocumentMatch{ID: "c", Score: 3},
+			&DocumentMatch{ID: "d", Score: 3},
+			&DocumentMatch{ID: "e", Score: 2},
+			&DocumentMatch{ID: "f", Score: 3},
+		},
+	}
+}
+
+func TestTopScoreCollectorPaging(t *testing.T) {
+	tests := []struct {
+		k           int
+		skip        int
+		after       *SearchAfter
+		expectedIDs []string
+	}{
+		// at equal scores the higher ID ranks higher
+		{
+			k:           10,
+			expectedIDs: []string{"b", "f", "d", "c", "e", "a"},
+		},
+		{
+			k:           2,
+			skip:        2,
+			expectedIDs: []string{"d", "c"},
+		},
+		{
+			k:           2,
+			skip:        10,
+			expectedIDs: []string{},
+		},
+		{
+			k:           2,
+			after:       &SearchAfter{Score: 3, ID: "d"},
+			expectedIDs: []string{"c", "e"},
+		},
+		{
+			k:           10,
+			after:       &SearchAfter{Score: 5, ID: "b"},
+			expectedIDs: []string{"f", "d", "c", "e", "a"},
+		},
+		{
+			k:           2,
+			after:       &SearchAfter{Score: 1, ID: "a"},
+			expectedIDs: []string{},
+		},
+	}
+
+	for testIndex, test := range tests {
+		collector := NewTopScorerSkipCollector(test.k, test.skip)
+		collector.SetSearchAfter(test.after)
+		err := collector.Collect(context.Background(), newStubSearcher())
+		if err != nil {
+			t.Fatal(err)
+		}
+		// total and max score ignore the paging
+		if collector.Total() != 6 {
+			t.Errorf("expected 6 total hits for test %d, got %d", testIndex, collector.Total())
+		}
+		if collector.MaxScore() != 5 {
+			t.Errorf("expected max score 5 for test %d, got %f", testIndex, collector.MaxScore())
+		}
+		results := collector.Results()
+		ids := make([]string, len(results))
+		for i, result := range results {
+			ids[i] = result.ID
+		}
+		if !reflect.DeepEqual(ids, test.expectedIDs) {
+			t.Errorf("expected ids %v for test %d, got %v", test.expectedIDs, testIndex, ids)
+		}
+	}
+}
+
+func TestSearchAfterPagesThroughAllHits(t *testing.T) {
+	all := NewTopScorerCollector(10)
+	err := all.Collect(context.Background(), newStubSearcher())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paged := make(DocumentMatchCollection, 0)
+	var after *SearchAfter
+	for {
+		collector := NewTopScorerCollector(4)
+		collector.SetSearchAfter(after)
+		err = collector.Collect(context.Background(), newStubSearcher())
+		if err != nil {
+			t.Fatal(err)
+		}
+		results := collector.Results()
+		if len(results) == 0 {
+			break
+		}
+		paged = append(paged, results...)
+		after = NewSearchAfter(results[len(results)-1])
+	}
+	if !reflect.DeepEqual(paged, all.Results()) {
+		t.Errorf("expected paging to return %v, got %v", all.Results(), paged)
+	}
+}
+
+func TestCollectorsGrowWithHits(t *testing.T) {
+	// room is made for the hits found, not the hits asked for
+	k := 1 << 40
+	topScore := NewTopScorerSkipCollector(k, k)
+	topN := NewTopNSkipCollector(k, k, twoDocIndex, SortOrder{})
+	if cap(topScore.results.matches) > MAX_PREALLOCATED_HITS || cap(topN.results.matches) > MAX_PREALLOCATED_HITS {
+		t.Errorf("expected at most %d hits preallocated", MAX_PREALLOCATED_HITS)
+	}
+	err := topScore.Collect(context.Background(), newStubSearcher())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if topScore.Total() != 6 || len(topScore.Results()) != 0 {
+		t.Errorf("expected 6 hits all skipped, got %d and %d results", topScore.Total(), len(topScore.Results()))
+	}
+}
+
+// cancellingSearcher cancels the search after n matches
+type cancellingSearcher struct {
+	Searcher
+	n      int
+	cancel context.CancelFunc
+}
+
+func (s *cancellingSearcher) Next(ctx context.Context) (*DocumentMatch, error) {
+	if s.n == 0 {
+		s.cancel()
+	}
+	s.n--
+	return s.Searcher.Next(ctx)
+}
+
+func TestCollectorCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	collector := NewTopScorerCollector(10)
+	err := collector.Collect(ctx, &cancellingSearcher{
+		Searcher: newStubSearcher(),
+		n:        3,
+		cancel:   cancel,
+	})
+	if err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	// the hits before the cancellation remain
+	if collector.Total() != 3 {
+		t.Errorf("expected 3 total hits, got %d", collector.Total())
+	}
+	if len(collector.Results()) != 3 {
+		t.Errorf("expected 3 results, got %d", len(collector.Results()))
+	}
+}
+
+func TestSearcherTimeout(t *testing.T) {
+	searcher, err := NewTermBooleanSearcher(context.Background(), twoDocIndex, DefaultSimilarity, &TermBooleanQuery{
+		Should: &TermDisjunctionQuery{
+			Terms: []Query{
+				&TermQuery{
+					Term:  "beer",
+					Field: "desc",
+					Boost: 1.0,
+				},
+				&TermQuery{
+					Term:  "marty",
+					Field: "name",
+					Boost: 1.0,
+				},
+			},
+			Min: 1,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer searcher.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+
+	_, err = searcher.Next(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestMergeTopScores(t *testing.T) {
+	partitions := []DocumentMatchCollection{
+		DocumentMatchCollection{
+			&DocumentMatch{ID: "b", Score: 5},
+			&DocumentMatch{ID: "d", Score: 3},
+			&DocumentMatch{ID: "a", Score: 1},
+		},
+		DocumentMatchCollection{
+			&DocumentMatch{ID: "f", Score: 3},
+			&DocumentMatch{ID: "c", Score: 3},
+		},
+		DocumentMatchCollection{},
+	}
+
+	tests := []struct {
+		k           int
+		skip        int
+		expectedIDs []string
+	}{
+		{
+			k:           10,
+			expectedIDs: []string{"b", "f", "d", "c", "a"},
+		},
+		{
+			k:           2,
+			skip:        1,
+			expectedIDs: []string{"f", "d"},
+		},
+	}
+
+	for testIndex, test := range tests {
+		results := MergeTopScores(test.k, test.skip, partitions...)
+		ids := make([]string, len(results))
+		for i, result := range results {
+			ids[i] = result.ID
+		}
+		if !reflect.DeepEqual(ids, test.expectedIDs) {
+			t.Errorf("expected ids %v for test %d, got %v", test.expectedIDs, testIndex, ids)
+		}
+	}
+}
+
+// fieldLengthCountingIndex counts the field lengths searchers read
+type fieldLengthCountingIndex struct {
+	index.Index
+	fieldLengths int
+}
+
+func (i *fieldLengthCountingIndex) FieldLength(id []byte, field string) (uint64, error) {
+	i.fieldLengths++
+	return i.Index.FieldLength(id, field)
+}
+
+func TestTopScoreCollectorSkipsScoring(t *testing.T) {
+	countingIndex := &fieldLengthCountingIndex{
+		Index: mock.NewMockIndexWithDocs(twoDocIndexSchema, map[string]interface{}{
+			"1": map[string]interface{}{"description": "beer beer beer"},
+			"2": map[string]interface{}{"description": "beer"},
+			"3": map[string]interface{}{"description": "more beer"},
+		}),
+	}
+	similarity := NewBM25Similarity(DEFAULT_BM25_K1, DEFAULT_BM25_B)
+	query := &TermQuery{Term: "beer", Field: "desc", Boost: 1.0}
+
+	searcher, err := NewTermSearcher(countingIndex, similarity, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer searcher.Close()
+	collector := NewTopScorerCollector(1)
+	err = collector.Collect(context.Background(), searcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// once 1 fills the collector, 2 and 3 can't beat it
+	if countingIndex.fieldLengths != 1 {
+		t.Errorf("expected 1 field length read, got %d", countingIndex.fieldLengths)
+	}
+	if collector.Total() != 3 {
+		t.Errorf("expected 3 hits, got %d", collector.Total())
+	}
+
+	// the same hit and score as collecting every hit fully scored
+	searcher, err = NewTermSearcher(countingIndex, similarity, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer searcher.Close()
+	fullCollector := NewTopScorerCollector(1)
+	err = fullCollector.Collect(context.Background(), &stubSearcher{matches: collectAll(t, searcher)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(collector.Results(), fullCollector.Results()) {
+		t.Errorf("expected %v, got %v", fullCollector.Results(), collector.Results())
+	}
+}
+
+func collectAll(t *testing.T, searcher Searcher) DocumentMatchCollection {
+	rv := make(DocumentMatchCollection, 0)
+	next, err := searcher.Next(context.Background())
+	for err == nil && next != nil {
+		rv = append(rv, next)
+		next, err = searcher.Next(context.Background())
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rv
+}
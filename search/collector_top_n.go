@@ -0,0 +1,177 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package search
+
+import (
+	"container/heap"
+	"context"
+	"sort"
+	"time"
+
+	"github.com/couchbaselabs/cbfullofit/index"
+)
+
+// TopNCollector keeps the first k documents of the sort order,
+// the kept documents are a heap with the one sorting last on top
+// so that it is cheap to find out if a new document displaces it
+type TopNCollector struct {
+	k        int
+	skip     int
+	index    index.Index
+	order    SortOrder
+	results  *docMatchHeap
+	took     time.Duration
+	maxScore float64
+	total    uint64
+}
+
+func NewTopNCollector(k int, idx index.Index, order SortOrder) *TopNCollector {
+	return NewTopNSkipCollector(k, 0, idx, order)
+}
+
+// NewTopNSkipCollector collects the first k documents
+// after skipping the first skip ones
+func NewTopNSkipCollector(k, skip int, idx index.Index, order SortOrder) *TopNCollector {
+	return &TopNCollector{
+		k:     k,
+		skip:  skip,
+		index: idx,
+		order: order,
+		results: &docMatchHeap{
+			order:   order,
+			matches: make(DocumentMatchCollection, 0, preallocatedHits(k, skip)),
+		},
+	}
+}
+
+func (tnc *TopNCollector) Total() uint64 {
+	return tnc.total
+}
+
+func (tnc *TopNCollector) MaxScore() float64 {
+	return tnc.maxScore
+}
+
+func (tnc *TopNCollector) Took() time.Duration {
+	return tnc.took
+}
+
+func (tnc *TopNCollector) Collect(ctx context.Context, searcher Searcher) error {
+	startTime := time.Now()
+	next, err := searcher.Next(ctx)
+	for err == nil && next != nil {
+		err = tnc.collectSingle(next)
+		if err != nil {
+			break
+		}
+		next, err = searcher.Next(ctx)
+	}
+	// compute search duration
+	tnc.took = time.Since(startTime)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (tnc *TopNCollector) collectSingle(dm *DocumentMatch) error {
+	// increment total hits
+	tnc.total += 1
+
+	// update max score
+	if dm.Score > tnc.maxScore {
+		tnc.maxScore = dm.Score
+	}
+
+	if tnc.k <= 0 {
+		return nil
+	}
+
+	// avoid loading the sort values of a document the score alone rules out
+	full := tnc.results.Len() >= tnc.k+tnc.skip
+	if full && tnc.order.sortsAfterOnScore(dm, tnc.results.matches[0]) {
+		return nil
+	}
+
+	err := tnc.order.loadSortValues(tnc.index, dm)
+	if err != nil {
+		return err
+	}
+
+	if !full {
+		heap.Push(tnc.results, dm)
+	} else if tnc.order.compare(dm, tnc.results.matches[0]) < 0 {
+		// replace the document sorting last
+		tnc.results.matches[0] = dm
+		heap.Fix(tnc.results, 0)
+	}
+	return nil
+}
+
+func (tnc *TopNCollector) Results() DocumentMatchCollection {
+	if tnc.results.Len() <= tnc.skip {
+		return DocumentMatchCollection{}
+	}
+	rv := make(DocumentMatchCollection, tnc.results.Len())
+	copy(rv, tnc.results.matches)
+	sort.Sort(&sortedDocMatches{tnc.order, rv})
+	rv = rv[tnc.skip:]
+	for _, dm := range rv {
+		tnc.order.formatSortValues(dm)
+	}
+	return rv
+}
+
+// docMatchHeap is a heap.Interface with the document
+// sorting last according to the order on top
+type docMatchHeap struct {
+	order   SortOrder
+	matches DocumentMatchCollection
+}
+
+func (h *docMatchHeap) Len() int {
+	return len(h.matches)
+}
+
+func (h *docMatchHeap) Less(i, j int) bool {
+	return h.order.compare(h.matches[i], h.matches[j]) > 0
+}
+
+func (h *docMatchHeap) Swap(i, j int) {
+	h.matches[i], h.matches[j] = h.matches[j], h.matches[i]
+}
+
+func (h *docMatchHeap) Push(x interface{}) {
+	h.matches = append(h.matches, x.(*DocumentMatch))
+}
+
+func (h *docMatchHeap) Pop() interface{} {
+	n := len(h.matches)
+	rv := h.matches[n-1]
+	h.matches = h.matches[:n-1]
+	return rv
+}
+
+// sortedDocMatches is a sort.Interface putting documents in order
+type sortedDocMatches struct {
+	order   SortOrder
+	matches DocumentMatchCollection
+}
+
+func (s *sortedDocMatches) Len() int {
+	return len(s.matches)
+}
+
+func (s *sortedDocMatches) Less(i, j int) bool {
+	return s.order.compare(s.matches[i], s.matches[j]) < 0
+}
+
+func (s *sortedDocMatches) Swap(i, j int) {
+	s.matches[i], s.matches[j] = s.matches[j], s.matches[i]
+}
@@ -0,0 +1,213 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package search
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/couchbaselabs/cbfullofit/index"
+	"github.com/couchbaselabs/cbfullofit/index/mock"
+)
+
+func TestTopNCollector(t *testing.T) {
+	sortIndex := mock.NewMockIndexWithDocs([]*index.Field{
+		&index.Field{
+			Name:     "name",
+			Path:     "/name",
+			Analyzer: "standard",
+			Sortable: true,
+		},
+		&index.Field{
+			Name:     "price",
+			Path:     "/price",
+			Type:     index.NUMERIC_FIELD,
+			Sortable: true,
+		},
+		&index.Field{
+			Name:     "brewed",
+			Path:     "/brewed",
+			Type:     index.DATETIME_FIELD,
+			Sortable: true,
+		},
+	}, map[string]interface{}{
+		"1": map[string]interface{}{
+			"name":   "pale ale",
+			"price":  4.5,
+			"brewed": "2013-06-01T00:00:00Z",
+		},
+		"2": map[string]interface{}{
+			"name":   "brown ale",
+			"price":  -1,
+			"brewed": "2013-01-15T00:00:00Z",
+		},
+		"3": map[string]interface{}{
+			"name":  "amber ale",
+			"price": 4.5,
+		},
+		"4": map[string]interface{}{
+			"name":   "scotch ale ale",
+			"brewed": "2012-11-30T00:00:00Z",
+		},
+		"5": map[string]interface{}{
+			"name":   "india pale ale",
+			"price":  12,
+			"brewed": "2013-03-01T00:00:00Z",
+		},
+	})
+
+	tests := []struct {
+		sort         []string
+		k            int
+		skip         int
+		expectedIDs  []string
+		expectedSort [][]string
+	}{
+		{
+			sort:        []string{"price"},
+			k:           10,
+			expectedIDs: []string{"2", "1", "3", "5", "4"},
+			expectedSort: [][]string{
+				[]string{"-1"},
+				[]string{"4.5"},
+				[]string{"4.5"},
+				[]string{"12"},
+				[]string{""},
+			},
+		},
+		// missing values still sort last when descending
+		{
+			sort:        []string{"-price", "name"},
+			k:           3,
+			expectedIDs: []string{"5", "3", "1"},
+			expectedSort: [][]string{
+				[]string{"12", "india pale ale"},
+				[]string{"4.5", "amber ale"},
+				[]string{"4.5", "pale ale"},
+			},
+		},
+		{
+			sort:        []string{"price"},
+			k:           2,
+			skip:        2,
+			expectedIDs: []string{"3", "5"},
+		},
+		{
+			sort:        []string{"brewed"},
+			k:           2,
+			expectedIDs: []string{"4", "2"},
+			expectedSort: [][]string{
+				[]string{"2012-11-30T00:00:00Z"},
+				[]string{"2013-01-15T00:00:00Z"},
+			},
+		},
+		// the best scoring document comes first
+		{
+			sort:        []string{"_score", "-_id"},
+			k:           2,
+			expectedIDs: []string{"4", "3"},
+		},
+		{
+			sort:        []string{"-_id"},
+			k:           3,
+			expectedIDs: []string{"5", "4", "3"},
+			expectedSort: [][]string{
+				[]string{"5"},
+				[]string{"4"},
+				[]string{"3"},
+			},
+		},
+	}
+
+	for testIndex, test := range tests {
+		order, err := ParseSortOrder(test.sort)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = order.Validate(sortIndex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		searcher, err := NewTermSearcher(sortIndex, DefaultSimilarity, &TermQuery{
+			Term:  "ale",
+			Field: "name",
+			Boost: 1.0,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		collector := NewTopNSkipCollector(test.k, test.skip, sortIndex, order)
+		err = collector.Collect(context.Background(), searcher)
+		searcher.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if collector.Total() != 5 {
+			t.Errorf("expected 5 total hits for test %d, got %d", testIndex, collector.Total())
+		}
+		results := collector.Results()
+		ids := make([]string, len(results))
+		for i, result := range results {
+			ids[i] = result.ID
+		}
+		if !reflect.DeepEqual(ids, test.expectedIDs) {
+			t.Errorf("expected ids %v for test %d, got %v", test.expectedIDs, testIndex, ids)
+		}
+		if test.expectedSort != nil {
+			for i, result := range results {
+				if i < len(test.expectedSort) && !reflect.DeepEqual(result.Sort, test.expectedSort[i]) {
+					t.Errorf("expected sort values %v for hit %d of test %d, got %v", test.expectedSort[i], i, testIndex, result.Sort)
+				}
+			}
+		}
+	}
+}
+
+func TestSortOrderValidate(t *testing.T) {
+	_, err := ParseSortOrder([]string{"name", "-"})
+	if err == nil {
+		t.Errorf("expected error for a sort field without a name")
+	}
+
+	sortIndex := mock.NewMockIndex([]*index.Field{
+		&index.Field{
+			Name:     "name",
+			Path:     "/name",
+			Analyzer: "standard",
+			Sortable: true,
+		},
+	})
+	order, err := ParseSortOrder([]string{"-name", "_score", "_id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !order[0].Descending || order[0].Field != "name" {
+		t.Errorf("expected descending name, got %v", order[0])
+	}
+	err = order.Validate(sortIndex)
+	if err != nil {
+		t.Errorf("unexpected error validating sort order: %v", err)
+	}
+
+	// name isn't sortable in twoDocIndex
+	err = order.Validate(twoDocIndex)
+	if err == nil {
+		t.Errorf("expected error for a sort field which is not sortable")
+	}
+
+	order, err = ParseSortOrder([]string{"price"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = order.Validate(twoDocIndex)
+	if err == nil {
+		t.Errorf("expected error for a sort field not in the schema")
+	}
+}
@@ -0,0 +1,103 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package search
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/couchbaselabs/cbfullofit/index"
+)
+
+// NewDateRangeSearcher matches the documents with a datetime in the
+// range, relative bounds are resolved against the current time
+func NewDateRangeSearcher(ctx context.Context, index index.Index, similarity Similarity, query *DateRangeQuery) (*TermDisjunctionSearcher, error) {
+	start, end, err := query.bounds(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	// datetimes are indexed as nanoseconds since the epoch
+	min := int64(math.MinInt64)
+	if query.Start != nil {
+		min = start.UnixNano()
+		if !query.inclusive() {
+			min++
+		}
+	}
+	max := int64(math.MaxInt64)
+	if query.End != nil {
+		max = end.UnixNano()
+		if !query.inclusive() {
+			max--
+		}
+	}
+
+	searcher, err := newPrefixCodedRangeSearcher(ctx, index, similarity, query.Field, min, max, query.Boost, query.Explain)
+	if err != nil {
+		if err == ctx.Err() {
+			return nil, err
+		}
+		return nil, fmt.Errorf("date range query: %v", err)
+	}
+	return searcher, nil
+}
+
+var dateMathOffset = regexp.MustCompile(`([+-])(\d+)([smhdwMy])`)
+
+// ParseDateTime parses an RFC3339 datetime, or now followed by any
+// number of offsets made of a sign, a count and one of the units
+// s, m, h, d, w, M (months) or y, as in now-1d+12h
+func ParseDateTime(input string, now time.Time) (time.Time, error) {
+	if len(input) < 3 || input[:3] != "now" {
+		rv, err := time.Parse(time.RFC3339Nano, input)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("datetime `%s` is neither RFC3339 nor relative to now", input)
+		}
+		return rv, nil
+	}
+
+	rv := now
+	offsets := input[3:]
+	for len(offsets) > 0 {
+		loc := dateMathOffset.FindStringSubmatchIndex(offsets)
+		if loc == nil || loc[0] != 0 {
+			return time.Time{}, fmt.Errorf("invalid offset `%s` in datetime `%s`", offsets, input)
+		}
+		count, err := strconv.Atoi(offsets[loc[4]:loc[5]])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid offset `%s` in datetime `%s`: %v", offsets, input, err)
+		}
+		if offsets[loc[2]:loc[3]] == "-" {
+			count = -count
+		}
+		switch offsets[loc[6]:loc[7]] {
+		case "s":
+			rv = rv.Add(time.Duration(count) * time.Second)
+		case "m":
+			rv = rv.Add(time.Duration(count) * time.Minute)
+		case "h":
+			rv = rv.Add(time.Duration(count) * time.Hour)
+		case "d":
+			rv = rv.AddDate(0, 0, count)
+		case "w":
+			rv = rv.AddDate(0, 0, 7*count)
+		case "M":
+			rv = rv.AddDate(0, count, 0)
+		case "y":
+			rv = rv.AddDate(count, 0, 0)
+		}
+		offsets = offsets[loc[1]:]
+	}
+	return rv, nil
+}
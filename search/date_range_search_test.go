@@ -0,0 +1,251 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package search
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/couchbaselabs/cbfullofit/index"
+	"github.com/couchbaselabs/cbfullofit/index/mock"
+)
+
+func TestParseDateTime(t *testing.T) {
+	now := time.Date(2013, time.December, 25, 12, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		input  string
+		output time.Time
+		err    bool
+	}{
+		{
+			input:  "2013-12-01T08:00:00Z",
+			output: time.Date(2013, time.December, 1, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			input:  "2013-12-01T08:00:00.5-05:00",
+			output: time.Date(2013, time.December, 1, 13, 0, 0, 500000000, time.UTC),
+		},
+		{
+			input:  "now",
+			output: now,
+		},
+		{
+			input:  "now-7d",
+			output: time.Date(2013, time.December, 18, 12, 30, 0, 0, time.UTC),
+		},
+		{
+			input:  "now-1d+12h-30m",
+			output: time.Date(2013, time.December, 25, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			input:  "now+2w",
+			output: time.Date(2014, time.January, 8, 12, 30, 0, 0, time.UTC),
+		},
+		{
+			input:  "now-1M-1y+90s",
+			output: time.Date(2012, time.November, 25, 12, 31, 30, 0, time.UTC),
+		},
+		{
+			input: "now-7",
+			err:   true,
+		},
+		{
+			input: "now-7x",
+			err:   true,
+		},
+		{
+			input: "now 7d",
+			err:   true,
+		},
+		{
+			input: "2013-12-01",
+			err:   true,
+		},
+	}
+
+	for _, test := range tests {
+		actual, err := ParseDateTime(test.input, now)
+		if test.err {
+			if err == nil {
+				t.Errorf("expected error for %s", test.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error: %v for %s", err, test.input)
+			continue
+		}
+		if !actual.Equal(test.output) {
+			t.Errorf("expected %v got %v for %s", test.output, actual, test.input)
+		}
+	}
+}
+
+func TestDateRangeSearch(t *testing.T) {
+	now := time.Now()
+	dateIndex := mock.NewMockIndexWithDocs([]*index.Field{
+		&index.Field{
+			Name:     "name",
+			Path:     "/name",
+			Analyzer: "standard",
+		},
+		&index.Field{
+			Name: "created",
+			Path: "/created",
+			Type: index.DATETIME_FIELD,
+		},
+		&index.Field{
+			Name:            "brewed",
+			Path:            "/brewed",
+			Type:            index.DATETIME_FIELD,
+			DateTimeLayouts: []string{"02/01/2006"},
+		},
+	}, map[string]interface{}{
+		"1": map[string]interface{}{
+			"name":    "yesterday",
+			"created": now.AddDate(0, 0, -1).Format(time.RFC3339Nano),
+			"brewed":  "01/06/2013",
+		},
+		"2": map[string]interface{}{
+			"name":    "last month",
+			"created": now.AddDate(0, -1, 0).Format(time.RFC3339Nano),
+			"brewed":  "15/06/2013",
+		},
+		"3": map[string]interface{}{
+			"name":    "launch",
+			"created": "2013-01-01T00:00:00Z",
+			"brewed":  "2013-06-30",
+		},
+		"4": map[string]interface{}{
+			"name":    "undated",
+			"created": "someday",
+		},
+	})
+
+	startOfJune := "2013-06-01T00:00:00Z"
+	midJune := "2013-06-15T00:00:00Z"
+	weekAgo := "now-7d"
+	nextWeek := "now+1w"
+	exclusive := false
+
+	tests := []struct {
+		query *DateRangeQuery
+		ids   []string
+	}{
+		{
+			query: &DateRangeQuery{
+				Start: &weekAgo,
+				Field: "created",
+				Boost: 1.0,
+			},
+			ids: []string{"1"},
+		},
+		{
+			query: &DateRangeQuery{
+				End:   &weekAgo,
+				Field: "created",
+				Boost: 1.0,
+			},
+			ids: []string{"2", "3"},
+		},
+		{
+			query: &DateRangeQuery{
+				Start: &startOfJune,
+				End:   &nextWeek,
+				Field: "created",
+				Boost: 1.0,
+			},
+			ids: []string{"1", "2"},
+		},
+		{
+			query: &DateRangeQuery{
+				Start: &startOfJune,
+				End:   &midJune,
+				Field: "brewed",
+				Boost: 1.0,
+			},
+			ids: []string{"1", "2"},
+		},
+		{
+			query: &DateRangeQuery{
+				Start:     &startOfJune,
+				End:       &midJune,
+				Inclusive: &exclusive,
+				Field:     "brewed",
+				Boost:     1.0,
+			},
+			ids: []string{},
+		},
+	}
+
+	for testIndex, test := range tests {
+		searcher, err := NewDateRangeSearcher(context.Background(), dateIndex, DefaultSimilarity, test.query)
+		if err != nil {
+			t.Fatalf("unexpected error: %v for test %d", err, testIndex)
+		}
+
+		ids := make([]string, 0)
+		next, err := searcher.Next(context.Background())
+		for err == nil && next != nil {
+			ids = append(ids, next.ID)
+			next, err = searcher.Next(context.Background())
+		}
+		searcher.Close()
+		if err != nil {
+			t.Fatalf("error iterating searcher: %v for test %d", err, testIndex)
+		}
+		if !reflect.DeepEqual(ids, test.ids) {
+			t.Errorf("expected ids %v got %v for test %d", test.ids, ids, testIndex)
+		}
+	}
+}
+
+func TestDateRangeQueryValidate(t *testing.T) {
+	weekAgo := "now-7d"
+	now := "now"
+	christmas := "2013-12-25T00:00:00Z"
+	garbage := "tomorrow"
+
+	tests := []struct {
+		query *DateRangeQuery
+		err   bool
+	}{
+		{
+			query: &DateRangeQuery{Start: &weekAgo, End: &now, Field: "created"},
+		},
+		{
+			query: &DateRangeQuery{End: &christmas, Field: "created"},
+		},
+		{
+			query: &DateRangeQuery{Start: &now, End: &weekAgo, Field: "created"},
+			err:   true,
+		},
+		{
+			query: &DateRangeQuery{Start: &garbage, Field: "created"},
+			err:   true,
+		},
+		{
+			query: &DateRangeQuery{Field: "created"},
+			err:   true,
+		},
+	}
+
+	for testIndex, test := range tests {
+		err := test.query.Validate()
+		if test.err && err == nil {
+			t.Errorf("expected error for test %d", testIndex)
+		}
+		if !test.err && err != nil {
+			t.Errorf("unexpected error: %v for test %d", err, testIndex)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package search
+
+import (
+	"context"
+	"github.com/couchbaselabs/cbfullofit/index"
+)
+
+// FacetBuilder accumulates a facet from the indexed terms of each
+// matching document
+type FacetBuilder interface {
+	Update(fieldTerms index.FieldTerms)
+	Result() *FacetResult
+}
+
+type TermFacet struct {
+	Term  string `json:"term"`
+	Count int    `json:"count"`
+}
+
+// TermFacets sort by descending count, then by term
+type TermFacets []*TermFacet
+
+func (tf TermFacets) Len() int      { return len(tf) }
+func (tf TermFacets) Swap(i, j int) { tf[i], tf[j] = tf[j], tf[i] }
+func (tf TermFacets) Less(i, j int) bool {
+	if tf[i].Count == tf[j].Count {
+		return tf[i].Term < tf[j].Term
+	}
+	return tf[i].Count > tf[j].Count
+}
+
+// FacetResult counts the terms or values of the field over the
+// matching documents, Total is the number of terms or values seen,
+// Other those not reported and Missing the documents without the field
+type FacetResult struct {
+	Field         string               `json:"field"`
+	Total         int                  `json:"total"`
+	Missing       int                  `json:"missing"`
+	Other         int                  `json:"other"`
+	Terms         TermFacets           `json:"terms,omitempty"`
+	NumericRanges []*NumericRangeFacet `json:"numeric_ranges,omitempty"`
+	DateRanges    []*DateRangeFacet    `json:"date_ranges,omitempty"`
+}
+
+// FacetResults are keyed by facet name
+type FacetResults map[string]*FacetResult
+
+// FacetsCollector wraps a collector, building facets over all the
+// documents it collects
+type FacetsCollector struct {
+	Collector
+	index    index.Index
+	builders map[string]FacetBuilder
+}
+
+func NewFacetsCollector(collector Collector, index index.Index) *FacetsCollector {
+	return &FacetsCollector{
+		Collector: collector,
+		index:     index,
+		builders:  make(map[string]FacetBuilder),
+	}
+}
+
+func (fc *FacetsCollector) AddFacet(name string, builder FacetBuilder) {
+	fc.builders[name] = builder
+}
+
+func (fc *FacetsCollector) Collect(ctx context.Context, searcher Searcher) error {
+	return fc.Collector.Collect(ctx, &facetingSearcher{
+		Searcher:  searcher,
+		collector: fc,
+	})
+}
+
+func (fc *FacetsCollector) FacetResults() FacetResults {
+	rv := make(FacetResults, len(fc.builders))
+	for name, builder := range fc.builders {
+		rv[name] = builder.Result()
+	}
+	return rv
+}
+
+func (fc *FacetsCollector) update(dm *DocumentMatch) error {
+	fieldTerms, err := fc.index.DocumentFieldTerms([]byte(dm.ID))
+	if err != nil {
+		return err
+	}
+	for _, builder := range fc.builders {
+		builder.Update(fieldTerms)
+	}
+	return nil
+}
+
+// facetingSearcher feeds each match to the facets on the way to
+// the wrapped collector
+type facetingSearcher struct {
+	Searcher
+	collector *FacetsCollector
+}
+
+func (s *facetingSearcher) Next(ctx context.Context) (*DocumentMatch, error) {
+	return s.facet(s.Searcher.Next(ctx))
+}
+
+func (s *facetingSearcher) Advance(ctx context.Context, ID string) (*DocumentMatch, error) {
+	return s.facet(s.Searcher.Advance(ctx, ID))
+}
+
+func (s *facetingSearcher) SetMinScore(minScore float64) {
+	if minScorer, ok := s.Searcher.(MinScoreSearcher); ok {
+		minScorer.SetMinScore(minScore)
+	}
+}
+
+func (s *facetingSearcher) facet(dm *DocumentMatch, err error) (*DocumentMatch, error) {
+	if err != nil || dm == nil {
+		return dm, err
+	}
+	err = s.collector.update(dm)
+	if err != nil {
+		return nil, err
+	}
+	return dm, nil
+}
@@ -0,0 +1,113 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package search
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	_ "github.com/couchbaselabs/cbfullofit/analysis/analyzers/keyword_analyzer"
+	"github.com/couchbaselabs/cbfullofit/index"
+	"github.com/couchbaselabs/cbfullofit/index/mock"
+)
+
+func TestTermsFacet(t *testing.T) {
+	facetIndex := mock.NewMockIndexWithDocs([]*index.Field{
+		&index.Field{
+			Name:     "name",
+			Path:     "/name",
+			Analyzer: "standard",
+		},
+		&index.Field{
+			Name:     "category",
+			Path:     "/category",
+			Analyzer: "keyword",
+		},
+	}, map[string]interface{}{
+		"1": map[string]interface{}{
+			"name":     "pale ale",
+			"category": "British Ale",
+		},
+		"2": map[string]interface{}{
+			"name":     "brown ale",
+			"category": "British Ale",
+		},
+		"3": map[string]interface{}{
+			"name":     "amber ale",
+			"category": "North American Ale",
+		},
+		"4": map[string]interface{}{
+			"name":     "scotch ale",
+			"category": "Scottish Ale",
+		},
+		"5": map[string]interface{}{
+			"name": "house ale",
+		},
+		"6": map[string]interface{}{
+			"name":     "pilsner",
+			"category": "Lager",
+		},
+	})
+
+	collector := NewFacetsCollector(NewTopScorerCollector(2), facetIndex)
+	collector.AddFacet("categories", NewTermsFacetBuilder("category", 2))
+	collector.AddFacet("names", NewTermsFacetBuilder("name", 1))
+	searcher, err := NewTermSearcher(facetIndex, DefaultSimilarity, &TermQuery{
+		Term:  "ale",
+		Field: "name",
+		Boost: 1.0,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer searcher.Close()
+
+	err = collector.Collect(context.Background(), searcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the facets count all matches, not just the top hits
+	if len(collector.Results()) != 2 {
+		t.Errorf("expected 2 hits, got %d", len(collector.Results()))
+	}
+	if collector.Total() != 5 {
+		t.Errorf("expected 5 total hits, got %d", collector.Total())
+	}
+
+	expected := FacetResults{
+		"categories": &FacetResult{
+			Field:   "category",
+			Total:   4,
+			Missing: 1,
+			Other:   1,
+			Terms: TermFacets{
+				&TermFacet{Term: "British Ale", Count: 2},
+				&TermFacet{Term: "North American Ale", Count: 1},
+			},
+		},
+		"names": &FacetResult{
+			Field:   "name",
+			Total:   10,
+			Missing: 0,
+			Other:   5,
+			Terms: TermFacets{
+				&TermFacet{Term: "ale", Count: 5},
+			},
+		},
+	}
+	actual := collector.FacetResults()
+	if !reflect.DeepEqual(actual, expected) {
+		for name, result := range actual {
+			t.Logf("%s: %#v", name, result)
+		}
+		t.Errorf("expected %v got %v", expected, actual)
+	}
+}
@@ -0,0 +1,63 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/couchbaselabs/cbfullofit/index"
+)
+
+// LoadFields fills in the stored values of the requested
+// fields for each hit, the field name "*" loads all of them
+func LoadFields(i index.Index, hits DocumentMatchCollection, fields []string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	all := false
+	for _, field := range fields {
+		if field == "*" {
+			all = true
+		}
+	}
+
+	for _, hit := range hits {
+		stored, err := i.Document([]byte(hit.ID))
+		if err != nil {
+			return err
+		}
+		if stored == nil {
+			continue
+		}
+		hit.Fields = make(map[string]interface{})
+		for field, value := range stored {
+			if !all && !ContainsString(fields, field) {
+				continue
+			}
+			var parsed interface{}
+			err = json.Unmarshal(value, &parsed)
+			if err != nil {
+				return fmt.Errorf("error parsing stored field `%s` of document `%s`: %v", field, hit.ID, err)
+			}
+			hit.Fields[field] = parsed
+		}
+	}
+	return nil
+}
+
+// ContainsString reports whether s is one of the strings in list
+func ContainsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
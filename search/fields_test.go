@@ -0,0 +1,98 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package search
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/couchbaselabs/cbfullofit/index"
+	"github.com/couchbaselabs/cbfullofit/index/mock"
+)
+
+func TestLoadFields(t *testing.T) {
+	schema := []*index.Field{
+		&index.Field{
+			Name:     "name",
+			Path:     "/name",
+			Analyzer: "standard",
+			Store:    true,
+		},
+		&index.Field{
+			Name:     "abv",
+			Path:     "/abv",
+			Analyzer: "standard",
+			Store:    true,
+		},
+		&index.Field{
+			Name:     "desc",
+			Path:     "/description",
+			Analyzer: "standard",
+		},
+	}
+	storedIndex := mock.NewMockIndexWithDocs(schema, map[string]interface{}{
+		"1": map[string]interface{}{
+			"name":        "pliny the elder",
+			"abv":         8.0,
+			"description": "double ipa",
+		},
+	})
+
+	tests := []struct {
+		fields []string
+		result map[string]interface{}
+	}{
+		{
+			fields: nil,
+			result: nil,
+		},
+		{
+			fields: []string{"name"},
+			result: map[string]interface{}{
+				"name": "pliny the elder",
+			},
+		},
+		{
+			fields: []string{"*"},
+			result: map[string]interface{}{
+				"name": "pliny the elder",
+				"abv":  8.0,
+			},
+		},
+		{
+			// fields which are not stored are never returned
+			fields: []string{"desc"},
+			result: map[string]interface{}{},
+		},
+	}
+
+	for testIndex, test := range tests {
+		hits := DocumentMatchCollection{
+			&DocumentMatch{
+				ID:    "1",
+				Score: 1.0,
+			},
+			// missing docs are skipped
+			&DocumentMatch{
+				ID:    "2",
+				Score: 0.5,
+			},
+		}
+		err := LoadFields(storedIndex, hits, test.fields)
+		if err != nil {
+			t.Fatalf("error loading fields: %v for test %d", err, testIndex)
+		}
+		if !reflect.DeepEqual(hits[0].Fields, test.result) {
+			t.Errorf("expected fields %v got %v for test %d", test.result, hits[0].Fields, testIndex)
+		}
+		if hits[1].Fields != nil {
+			t.Errorf("expected no fields for missing doc, got %v for test %d", hits[1].Fields, testIndex)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package search
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/couchbaselabs/cbfullofit/index"
+)
+
+const MAX_FUZZINESS = 2
+
+// NewFuzzySearcher matches the terms within query.Fuzziness edits
+// of the query term which share its first query.PrefixLength
+// characters exactly.  Closer terms score higher.
+//
+// Every term of the field sharing the prefix is run through the
+// automaton, so the cost grows with the size of the dictionary, a
+// short or empty prefix walks all of it.  Fuzziness is capped at
+// MAX_FUZZINESS, which keeps each term to a few steps before it is
+// abandoned, but a longer prefix is the only way to walk less.
+func NewFuzzySearcher(ctx context.Context, index index.Index, similarity Similarity, query *FuzzyQuery) (*TermDisjunctionSearcher, error) {
+	// nested queries are not validated by the request
+	err := query.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	runes := []rune(query.Term)
+	prefixLength := query.PrefixLength
+	if prefixLength > len(runes) {
+		prefixLength = len(runes)
+	}
+	prefix := string(runes[:prefixLength])
+	automaton := newLevenshteinAutomaton(string(runes[prefixLength:]), query.Fuzziness)
+
+	// only terms sharing the prefix need to be walked
+	distances := make(map[string]int)
+	start, end := prefixRange(prefix)
+	terms, err := expandTerms(ctx, index, query.Field, start, end, func(term string) bool {
+		if !strings.HasPrefix(term, prefix) {
+			return false
+		}
+		distance, ok := automaton.distance(term[len(prefix):])
+		if ok {
+			distances[term] = distance
+		}
+		return ok
+	}, query.MaxExpansions)
+	if err != nil {
+		return nil, expansionError(ctx, "fuzzy", query.Term, err)
+	}
+
+	searchers := make(OrderedSearcherList, len(terms))
+	for i, term := range terms {
+		distance := distances[term]
+		termQuery := TermQuery{
+			Term:    term,
+			Field:   query.Field,
+			Boost:   query.Boost * fuzzyBoost(distance, query.Fuzziness),
+			Explain: query.Explain,
+		}
+		searcher, err := NewTermSearcher(index, similarity, &termQuery)
+		if err != nil {
+			for _, opened := range searchers[:i] {
+				opened.Close()
+			}
+			return nil, err
+		}
+		searchers[i] = &fuzzyTermSearcher{
+			TermSearcher: searcher,
+			query:        query,
+			term:         term,
+			distance:     distance,
+		}
+	}
+	return newTermDisjunctionSearcher(ctx, index, similarity, searchers, 0, query.Explain)
+}
+
+// fuzzyBoost scales the boost of a matched term down
+// linearly with its distance from the query term
+func fuzzyBoost(distance, fuzziness int) float64 {
+	return 1.0 - float64(distance)/float64(fuzziness+1)
+}
+
+// fuzzyTermSearcher records which term of the dictionary
+// matched, and how far it was, in the explanation
+type fuzzyTermSearcher struct {
+	*TermSearcher
+	query    *FuzzyQuery
+	term     string
+	distance int
+}
+
+func (s *fuzzyTermSearcher) Next(ctx context.Context) (*DocumentMatch, error) {
+	return s.explain(s.TermSearcher.Next(ctx))
+}
+
+func (s *fuzzyTermSearcher) Advance(ctx context.Context, ID string) (*DocumentMatch, error) {
+	return s.explain(s.TermSearcher.Advance(ctx, ID))
+}
+
+func (s *fuzzyTermSearcher) explain(docMatch *DocumentMatch, err error) (*DocumentMatch, error) {
+	if err != nil || docMatch == nil || docMatch.Expl == nil {
+		return docMatch, err
+	}
+	docMatch.Expl = &Explanation{
+		Value:    docMatch.Score,
+		Message:  fmt.Sprintf("fuzzy(%s:%s~%d) matched term %s at distance %d, boost %f:", s.query.Field, s.query.Term, s.query.Fuzziness, s.term, s.distance, fuzzyBoost(s.distance, s.query.Fuzziness)),
+		Children: []*Explanation{docMatch.Expl},
+	}
+	return docMatch, nil
+}
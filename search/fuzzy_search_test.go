@@ -0,0 +1,183 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package search
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/couchbaselabs/cbfullofit/index/mock"
+)
+
+func TestFuzzySearch(t *testing.T) {
+
+	tests := []struct {
+		query *FuzzyQuery
+		ids   []string
+		err   bool
+	}{
+		{
+			query: &FuzzyQuery{
+				Term:      "bier",
+				Field:     "desc",
+				Fuzziness: 1,
+				Boost:     1.0,
+			},
+			ids: []string{"1", "2", "3", "4"},
+		},
+		{
+			query: &FuzzyQuery{
+				Term:      "bier",
+				Field:     "desc",
+				Fuzziness: 0,
+				Boost:     1.0,
+			},
+			ids: []string{},
+		},
+		{
+			// dank, the transposition in dnak needs 2 edits
+			query: &FuzzyQuery{
+				Term:      "dnak",
+				Field:     "desc",
+				Fuzziness: 2,
+				Boost:     1.0,
+			},
+			ids: []string{"3"},
+		},
+		{
+			// the prefix must match exactly
+			query: &FuzzyQuery{
+				Term:         "bier",
+				Field:        "desc",
+				Fuzziness:    1,
+				PrefixLength: 2,
+				Boost:        1.0,
+			},
+			ids: []string{},
+		},
+		{
+			query: &FuzzyQuery{
+				Term:         "couhc",
+				Field:        "desc",
+				Fuzziness:    2,
+				PrefixLength: 3,
+				Boost:        1.0,
+			},
+			ids: []string{"2"},
+		},
+		{
+			query: &FuzzyQuery{
+				Term:          "danst",
+				Field:         "desc",
+				Fuzziness:     2,
+				MaxExpansions: 1,
+				Boost:         1.0,
+			},
+			// dank and angst
+			err: true,
+		},
+		{
+			query: &FuzzyQuery{
+				Term:         "bier",
+				Field:        "desc",
+				Fuzziness:    1,
+				PrefixLength: -1,
+				Boost:        1.0,
+			},
+			err: true,
+		},
+		{
+			query: &FuzzyQuery{
+				Term:      "bier",
+				Field:     "desc",
+				Fuzziness: -1,
+				Boost:     1.0,
+			},
+			err: true,
+		},
+		{
+			query: &FuzzyQuery{
+				Term:      "bier",
+				Field:     "desc",
+				Fuzziness: MAX_FUZZINESS + 1,
+				Boost:     1.0,
+			},
+			err: true,
+		},
+	}
+
+	for testIndex, test := range tests {
+		searcher, err := NewFuzzySearcher(context.Background(), twoDocIndex, DefaultSimilarity, test.query)
+		if test.err {
+			if err == nil {
+				t.Errorf("expected error for test %d", testIndex)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v for test %d", err, testIndex)
+		}
+
+		ids := make([]string, 0)
+		next, err := searcher.Next(context.Background())
+		for err == nil && next != nil {
+			ids = append(ids, next.ID)
+			next, err = searcher.Next(context.Background())
+		}
+		searcher.Close()
+		if err != nil {
+			t.Fatalf("error iterating searcher: %v for test %d", err, testIndex)
+		}
+		if !reflect.DeepEqual(ids, test.ids) {
+			t.Errorf("expected ids %v got %v for test %d", test.ids, ids, testIndex)
+		}
+	}
+}
+
+func TestFuzzySearchScoresByDistance(t *testing.T) {
+	fuzzyIndex := mock.NewMockIndexWithDocs(twoDocIndexSchema, map[string]interface{}{
+		"1": map[string]interface{}{
+			"name": "beer",
+		},
+		"2": map[string]interface{}{
+			"name": "bier",
+		},
+	})
+
+	searcher, err := NewFuzzySearcher(context.Background(), fuzzyIndex, DefaultSimilarity, &FuzzyQuery{
+		Term:      "beer",
+		Field:     "name",
+		Fuzziness: 1,
+		Boost:     1.0,
+		Explain:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer searcher.Close()
+
+	exactMatch, err := searcher.Next(context.Background())
+	if err != nil || exactMatch == nil || exactMatch.ID != "1" {
+		t.Fatalf("expected exact match, got %v %v", exactMatch, err)
+	}
+	fuzzyMatch, err := searcher.Next(context.Background())
+	if err != nil || fuzzyMatch == nil || fuzzyMatch.ID != "2" {
+		t.Fatalf("expected fuzzy match, got %v %v", fuzzyMatch, err)
+	}
+	if fuzzyMatch.Score >= exactMatch.Score {
+		t.Errorf("expected fuzzy match to score %f below exact match %f", fuzzyMatch.Score, exactMatch.Score)
+	}
+
+	// the matched term is explained
+	if !strings.Contains(fuzzyMatch.Expl.String(), "matched term bier at distance 1") {
+		t.Errorf("expected explanation to contain matched term, got %s", fuzzyMatch.Expl)
+	}
+}
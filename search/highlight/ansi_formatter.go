@@ -0,0 +1,40 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package highlight
+
+const DEFAULT_ANSI_HIGHLIGHT = bgYellow
+
+const (
+	reset    = "\x1b[0m"
+	bgYellow = "\x1b[43m"
+)
+
+// ANSIFragmentFormatter colors each term location
+// for display in a terminal
+type ANSIFragmentFormatter struct {
+	color string
+}
+
+func NewANSIFragmentFormatter() *ANSIFragmentFormatter {
+	return NewANSIFragmentFormatterColor(DEFAULT_ANSI_HIGHLIGHT)
+}
+
+func NewANSIFragmentFormatterColor(color string) *ANSIFragmentFormatter {
+	return &ANSIFragmentFormatter{
+		color: color,
+	}
+}
+
+func (a *ANSIFragmentFormatter) Format(f *Fragment, locations TermLocations) string {
+	return formatFragment(f, locations, a.color, reset, noEscape)
+}
+
+func noEscape(s string) string {
+	return s
+}
@@ -0,0 +1,147 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package highlight
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSimpleFragmenter(t *testing.T) {
+	orig := []byte("this is a test of the simple fragmenter")
+
+	tests := []struct {
+		size      int
+		locations TermLocations
+		fragments [][2]int
+	}{
+		// centered on the term
+		{
+			size: 10,
+			locations: TermLocations{
+				&TermLocation{Term: "test", Start: 10, End: 14},
+			},
+			fragments: [][2]int{{7, 17}},
+		},
+		// shifted at the start
+		{
+			size: 10,
+			locations: TermLocations{
+				&TermLocation{Term: "this", Start: 0, End: 4},
+			},
+			fragments: [][2]int{{0, 10}},
+		},
+		// shifted at the end
+		{
+			size: 10,
+			locations: TermLocations{
+				&TermLocation{Term: "fragmenter", Start: 29, End: 39},
+			},
+			fragments: [][2]int{{29, 39}},
+		},
+		// terms close together share a fragment
+		{
+			size: 20,
+			locations: TermLocations{
+				&TermLocation{Term: "test", Start: 10, End: 14},
+				&TermLocation{Term: "simple", Start: 22, End: 28},
+				&TermLocation{Term: "fragmenter", Start: 29, End: 39},
+			},
+			fragments: [][2]int{{2, 22}, {15, 35}, {19, 39}},
+		},
+		{
+			size: 30,
+			locations: TermLocations{
+				&TermLocation{Term: "test", Start: 10, End: 14},
+				&TermLocation{Term: "simple", Start: 22, End: 28},
+			},
+			fragments: [][2]int{{0, 30}},
+		},
+	}
+
+	for testIndex, test := range tests {
+		fragmenter := NewSimpleFragmenter(test.size)
+		fragments := fragmenter.Fragment(orig, test.locations)
+		offsets := make([][2]int, len(fragments))
+		for i, fragment := range fragments {
+			offsets[i] = [2]int{fragment.Start, fragment.End}
+		}
+		if !reflect.DeepEqual(offsets, test.fragments) {
+			t.Errorf("expected fragments %v got %v for test %d", test.fragments, offsets, testIndex)
+		}
+	}
+}
+
+func TestSentenceFragmenter(t *testing.T) {
+	orig := []byte("First one. Second, v1.2 is here!  Third?")
+
+	tests := []struct {
+		locations TermLocations
+		fragments []string
+	}{
+		{
+			locations: TermLocations{
+				&TermLocation{Term: "first", Start: 0, End: 5},
+			},
+			fragments: []string{"First one."},
+		},
+		{
+			locations: TermLocations{
+				&TermLocation{Term: "here", Start: 27, End: 31},
+				&TermLocation{Term: "third", Start: 34, End: 39},
+			},
+			fragments: []string{"Second, v1.2 is here!", "Third?"},
+		},
+		{
+			locations: TermLocations{},
+			fragments: []string{},
+		},
+	}
+
+	fragmenter := NewSentenceFragmenter()
+	for testIndex, test := range tests {
+		fragments := fragmenter.Fragment(orig, test.locations)
+		texts := make([]string, len(fragments))
+		for i, fragment := range fragments {
+			texts[i] = string(fragment.Orig[fragment.Start:fragment.End])
+		}
+		if !reflect.DeepEqual(texts, test.fragments) {
+			t.Errorf("expected fragments %q got %q for test %d", test.fragments, texts, testIndex)
+		}
+	}
+}
+
+func TestHTMLFragmentFormatter(t *testing.T) {
+	orig := []byte("fish & chips <3")
+	fragment := &Fragment{
+		Orig:  orig,
+		Start: 0,
+		End:   len(orig),
+	}
+	locations := TermLocations{
+		&TermLocation{Term: "fish", Start: 0, End: 4},
+		&TermLocation{Term: "chips", Start: 7, End: 12},
+	}
+
+	formatter := NewHTMLFragmentFormatter()
+	expected := "<b>fish</b> &amp; <b>chips</b> &lt;3"
+	actual := formatter.Format(fragment, locations)
+	if actual != expected {
+		t.Errorf("expected %q got %q", expected, actual)
+	}
+
+	// locations outside the fragment are ignored
+	fragment.Start = 5
+	formatter = NewHTMLFragmentFormatterCustom("<em>", "</em>")
+	expected = "&amp; <em>chips</em> &lt;3"
+	actual = formatter.Format(fragment, locations)
+	if actual != expected {
+		t.Errorf("expected %q got %q", expected, actual)
+	}
+}
@@ -0,0 +1,174 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package highlight
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/couchbaselabs/cbfullofit/search"
+)
+
+const DEFAULT_FRAGMENT_SIZE = 100
+
+// Fragment is a section of the original field value,
+// scored by the number of term locations it contains
+type Fragment struct {
+	Orig  []byte
+	Start int
+	End   int
+	Score float64
+}
+
+func (f *Fragment) String() string {
+	return fmt.Sprintf("Fragment[start=%d, end=%d, score=%f]: %s", f.Start, f.End, f.Score, f.Orig[f.Start:f.End])
+}
+
+// Fragmenter breaks the original field value into
+// fragments around the term locations
+type Fragmenter interface {
+	Fragment(orig []byte, locations TermLocations) []*Fragment
+}
+
+// FragmentFormatter marks the term locations inside a fragment
+type FragmentFormatter interface {
+	Format(f *Fragment, locations TermLocations) string
+}
+
+type TermLocation struct {
+	Term  string
+	Pos   int
+	Start int
+	End   int
+}
+
+// TermLocations sorts by start offset
+type TermLocations []*TermLocation
+
+func (t TermLocations) Len() int           { return len(t) }
+func (t TermLocations) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t TermLocations) Less(i, j int) bool { return t[i].Start < t[j].Start }
+
+// OrderTermLocations flattens the locations of all the terms
+// into a single list, in the order they occur in the field
+func OrderTermLocations(tlm search.TermLocationMap) TermLocations {
+	rv := make(TermLocations, 0)
+	for term, locations := range tlm {
+		for _, location := range locations {
+			tl := TermLocation{
+				Term:  term,
+				Pos:   int(location.Pos),
+				Start: int(location.Start),
+				End:   int(location.End),
+			}
+			rv = append(rv, &tl)
+		}
+	}
+	sort.Sort(rv)
+	return rv
+}
+
+// score counts the locations which lie entirely in the fragment
+func (t TermLocations) score(f *Fragment) float64 {
+	var rv float64
+	for _, location := range t {
+		if location.Start >= f.Start && location.End <= f.End {
+			rv += 1.0
+		}
+	}
+	return rv
+}
+
+type Highlighter struct {
+	fragmenter Fragmenter
+	formatter  FragmentFormatter
+}
+
+func NewHighlighter(fragmenter Fragmenter, formatter FragmentFormatter) *Highlighter {
+	return &Highlighter{
+		fragmenter: fragmenter,
+		formatter:  formatter,
+	}
+}
+
+// HighlighterInstance builds a highlighter from the style and
+// fragmenter names accepted in search requests
+func HighlighterInstance(style, fragmenter string) (*Highlighter, error) {
+	var fragmentFormatter FragmentFormatter
+	switch style {
+	case "", "html":
+		fragmentFormatter = NewHTMLFragmentFormatter()
+	case "ansi":
+		fragmentFormatter = NewANSIFragmentFormatter()
+	default:
+		return nil, fmt.Errorf("Unknown highlight style '%s'", style)
+	}
+
+	var fieldFragmenter Fragmenter
+	switch fragmenter {
+	case "", "simple":
+		fieldFragmenter = NewSimpleFragmenter(DEFAULT_FRAGMENT_SIZE)
+	case "sentence":
+		fieldFragmenter = NewSentenceFragmenter()
+	default:
+		return nil, fmt.Errorf("Unknown fragmenter '%s'", fragmenter)
+	}
+
+	return NewHighlighter(fieldFragmenter, fragmentFormatter), nil
+}
+
+// BestFragmentsInField returns up to num formatted fragments of
+// the original field value, best first.  orig must be the value
+// exactly as the analyzer tokenized it, so that the term vector
+// offsets line up.
+func (h *Highlighter) BestFragmentsInField(dm *search.DocumentMatch, field string, orig []byte, num int) []string {
+	tlm, ok := dm.Locations[field]
+	if !ok {
+		return nil
+	}
+	locations := OrderTermLocations(tlm)
+
+	fragments := h.fragmenter.Fragment(orig, locations)
+	for _, fragment := range fragments {
+		fragment.Score = locations.score(fragment)
+	}
+	sort.Stable(fragmentsByScore(fragments))
+
+	// pick the best fragments which do not overlap
+	// one already picked
+	rv := make([]string, 0, num)
+	chosen := make([]*Fragment, 0, num)
+	for _, fragment := range fragments {
+		if len(chosen) >= num {
+			break
+		}
+		if fragment.Score <= 0 || overlapsAny(fragment, chosen) {
+			continue
+		}
+		chosen = append(chosen, fragment)
+		rv = append(rv, h.formatter.Format(fragment, locations))
+	}
+	return rv
+}
+
+func overlapsAny(f *Fragment, others []*Fragment) bool {
+	for _, other := range others {
+		if f.Start < other.End && other.Start < f.End {
+			return true
+		}
+	}
+	return false
+}
+
+// fragmentsByScore sorts the highest scoring fragments first
+type fragmentsByScore []*Fragment
+
+func (f fragmentsByScore) Len() int           { return len(f) }
+func (f fragmentsByScore) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
+func (f fragmentsByScore) Less(i, j int) bool { return f[i].Score > f[j].Score }
@@ -0,0 +1,134 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package highlight
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	_ "github.com/couchbaselabs/cbfullofit/analysis/analyzers/standard_analyzer"
+	"github.com/couchbaselabs/cbfullofit/index"
+	"github.com/couchbaselabs/cbfullofit/index/mock"
+	"github.com/couchbaselabs/cbfullofit/search"
+)
+
+func TestHighlighter(t *testing.T) {
+	schema := []*index.Field{
+		&index.Field{
+			Name:               "desc",
+			Path:               "/description",
+			Analyzer:           "standard",
+			IncludeTermVectors: true,
+			Store:              true,
+		},
+	}
+	desc := "Water is wet. Beer is better than water. Nothing beats a cold beer!"
+	highlightIndex := mock.NewMockIndexWithDocs(schema, map[string]interface{}{
+		"1": map[string]interface{}{
+			"description": desc,
+		},
+	})
+
+	tests := []struct {
+		highlighter *Highlighter
+		query       search.Query
+		fragments   []string
+	}{
+		{
+			highlighter: NewHighlighter(NewSentenceFragmenter(), NewHTMLFragmentFormatter()),
+			query: &search.TermQuery{
+				Term:  "beer",
+				Field: "desc",
+				Boost: 1.0,
+			},
+			fragments: []string{
+				"<b>Beer</b> is better than water.",
+				"Nothing beats a cold <b>beer</b>!",
+			},
+		},
+		{
+			highlighter: NewHighlighter(NewSentenceFragmenter(), NewHTMLFragmentFormatter()),
+			query: &search.TermDisjunctionQuery{
+				Terms: []search.Query{
+					&search.TermQuery{
+						Term:  "beer",
+						Field: "desc",
+						Boost: 1.0,
+					},
+					&search.TermQuery{
+						Term:  "water",
+						Field: "desc",
+						Boost: 1.0,
+					},
+				},
+				Min: 0,
+			},
+			fragments: []string{
+				"<b>Beer</b> is better than <b>water</b>.",
+				"<b>Water</b> is wet.",
+				"Nothing beats a cold <b>beer</b>!",
+			},
+		},
+		{
+			highlighter: NewHighlighter(NewSimpleFragmenter(20), NewANSIFragmentFormatter()),
+			query: &search.TermQuery{
+				Term:  "wet",
+				Field: "desc",
+				Boost: 1.0,
+			},
+			fragments: []string{
+				"ater is " + bgYellow + "wet" + reset + ". Beer is",
+			},
+		},
+	}
+
+	for testIndex, test := range tests {
+		searcher, err := test.query.Searcher(context.Background(), highlightIndex, search.DefaultSimilarity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hit, err := searcher.Next(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		searcher.Close()
+		if hit == nil {
+			t.Fatalf("expected a hit for test %d", testIndex)
+		}
+
+		fragments := test.highlighter.BestFragmentsInField(hit, "desc", []byte(desc), 3)
+		if !reflect.DeepEqual(fragments, test.fragments) {
+			t.Errorf("expected fragments %q got %q for test %d", test.fragments, fragments, testIndex)
+		}
+	}
+}
+
+func TestHighlighterInstance(t *testing.T) {
+	tests := []struct {
+		style      string
+		fragmenter string
+		err        bool
+	}{
+		{style: "", fragmenter: ""},
+		{style: "html", fragmenter: "simple"},
+		{style: "ansi", fragmenter: "sentence"},
+		{style: "pdf", fragmenter: "simple", err: true},
+		{style: "html", fragmenter: "paragraph", err: true},
+	}
+
+	for testIndex, test := range tests {
+		_, err := HighlighterInstance(test.style, test.fragmenter)
+		if test.err && err == nil {
+			t.Errorf("expected error for test %d", testIndex)
+		} else if !test.err && err != nil {
+			t.Errorf("unexpected error %v for test %d", err, testIndex)
+		}
+	}
+}
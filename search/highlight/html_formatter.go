@@ -0,0 +1,58 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package highlight
+
+import (
+	"bytes"
+	"html"
+)
+
+const DEFAULT_HTML_HIGHLIGHT_BEFORE = "<b>"
+const DEFAULT_HTML_HIGHLIGHT_AFTER = "</b>"
+
+// HTMLFragmentFormatter escapes the fragment for HTML
+// and wraps each term location in tags
+type HTMLFragmentFormatter struct {
+	before string
+	after  string
+}
+
+func NewHTMLFragmentFormatter() *HTMLFragmentFormatter {
+	return NewHTMLFragmentFormatterCustom(DEFAULT_HTML_HIGHLIGHT_BEFORE, DEFAULT_HTML_HIGHLIGHT_AFTER)
+}
+
+func NewHTMLFragmentFormatterCustom(before, after string) *HTMLFragmentFormatter {
+	return &HTMLFragmentFormatter{
+		before: before,
+		after:  after,
+	}
+}
+
+func (a *HTMLFragmentFormatter) Format(f *Fragment, locations TermLocations) string {
+	return formatFragment(f, locations, a.before, a.after, html.EscapeString)
+}
+
+// formatFragment wraps the term locations lying entirely inside
+// the fragment with before and after, escaping the rest of the text
+func formatFragment(f *Fragment, locations TermLocations, before, after string, escape func(string) string) string {
+	var buf bytes.Buffer
+	curr := f.Start
+	for _, location := range locations {
+		if location.Start < curr || location.End > f.End {
+			continue
+		}
+		buf.WriteString(escape(string(f.Orig[curr:location.Start])))
+		buf.WriteString(before)
+		buf.WriteString(escape(string(f.Orig[location.Start:location.End])))
+		buf.WriteString(after)
+		curr = location.End
+	}
+	buf.WriteString(escape(string(f.Orig[curr:f.End])))
+	return buf.String()
+}
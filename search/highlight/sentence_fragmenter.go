@@ -0,0 +1,77 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package highlight
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// SentenceFragmenter produces one fragment for
+// each sentence containing a term location
+type SentenceFragmenter struct {
+}
+
+func NewSentenceFragmenter() *SentenceFragmenter {
+	return &SentenceFragmenter{}
+}
+
+func (s *SentenceFragmenter) Fragment(orig []byte, locations TermLocations) []*Fragment {
+	rv := make([]*Fragment, 0)
+
+	start := 0
+	for start < len(orig) {
+		end := sentenceEnd(orig, start)
+
+		// trim the whitespace between sentences
+		fragmentStart := start
+		for fragmentStart < end {
+			r, size := utf8.DecodeRune(orig[fragmentStart:])
+			if !unicode.IsSpace(r) {
+				break
+			}
+			fragmentStart += size
+		}
+
+		for _, location := range locations {
+			if location.Start >= fragmentStart && location.End <= end {
+				rv = append(rv, &Fragment{
+					Orig:  orig,
+					Start: fragmentStart,
+					End:   end,
+				})
+				break
+			}
+		}
+
+		start = end
+	}
+
+	return rv
+}
+
+// sentenceEnd finds the end of the sentence beginning at start,
+// which is just past the terminating punctuation when it is
+// followed by whitespace or the end of the input
+func sentenceEnd(orig []byte, start int) int {
+	for i := start; i < len(orig); {
+		r, size := utf8.DecodeRune(orig[i:])
+		i += size
+		if r == '.' || r == '!' || r == '?' {
+			if i >= len(orig) {
+				return i
+			}
+			next, _ := utf8.DecodeRune(orig[i:])
+			if unicode.IsSpace(next) {
+				return i
+			}
+		}
+	}
+	return len(orig)
+}
@@ -0,0 +1,83 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package highlight
+
+import (
+	"unicode/utf8"
+)
+
+// SimpleFragmenter produces fixed size fragments
+// centered on the term locations
+type SimpleFragmenter struct {
+	size int
+}
+
+func NewSimpleFragmenter(size int) *SimpleFragmenter {
+	return &SimpleFragmenter{
+		size: size,
+	}
+}
+
+func (s *SimpleFragmenter) Fragment(orig []byte, locations TermLocations) []*Fragment {
+	rv := make([]*Fragment, 0)
+
+	var prev *Fragment
+	for _, location := range locations {
+		if location.End > len(orig) {
+			// offsets do not belong to this value
+			continue
+		}
+		// already covered by the previous fragment
+		if prev != nil && location.Start >= prev.Start && location.End <= prev.End {
+			continue
+		}
+
+		// spread the remaining space evenly on both sides
+		context := (s.size - (location.End - location.Start)) / 2
+		if context < 0 {
+			context = 0
+		}
+		start := location.Start - context
+		if start < 0 {
+			start = 0
+		}
+		end := start + s.size
+		if end < location.End {
+			end = location.End
+		}
+		if end > len(orig) {
+			end = len(orig)
+			// use the space left over at the end
+			start = end - s.size
+			if start < 0 {
+				start = 0
+			}
+			if start > location.Start {
+				start = location.Start
+			}
+		}
+
+		// do not split multi-byte characters
+		for start > 0 && !utf8.RuneStart(orig[start]) {
+			start--
+		}
+		for end < len(orig) && !utf8.RuneStart(orig[end]) {
+			end++
+		}
+
+		prev = &Fragment{
+			Orig:  orig,
+			Start: start,
+			End:   end,
+		}
+		rv = append(rv, prev)
+	}
+
+	return rv
+}
@@ -0,0 +1,102 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package search
+
+import (
+	"unicode/utf8"
+)
+
+// levenshteinAutomaton accepts the strings within max edits
+// (insertions, deletions and substitutions) of the target.
+//
+// A state is the last row of the edit distance matrix for the
+// input consumed so far, with values capped at max+1, so states
+// can be stepped one rune at a time and a walk abandoned as soon
+// as no continuation can match.
+type levenshteinAutomaton struct {
+	target []rune
+	max    int
+}
+
+func newLevenshteinAutomaton(target string, max int) *levenshteinAutomaton {
+	return &levenshteinAutomaton{
+		target: []rune(target),
+		max:    max,
+	}
+}
+
+func (a *levenshteinAutomaton) start() []int {
+	rv := make([]int, len(a.target)+1)
+	for i := range rv {
+		rv[i] = a.cap(i)
+	}
+	return rv
+}
+
+func (a *levenshteinAutomaton) step(state []int, r rune) []int {
+	rv := make([]int, len(state))
+	rv[0] = a.cap(state[0] + 1)
+	for i := 1; i < len(state); i++ {
+		cost := 1
+		if a.target[i-1] == r {
+			cost = 0
+		}
+		dist := state[i-1] + cost // substitute or match
+		if state[i]+1 < dist {
+			dist = state[i] + 1 // insert
+		}
+		if rv[i-1]+1 < dist {
+			dist = rv[i-1] + 1 // delete
+		}
+		rv[i] = a.cap(dist)
+	}
+	return rv
+}
+
+func (a *levenshteinAutomaton) isMatch(state []int) bool {
+	return state[len(state)-1] <= a.max
+}
+
+func (a *levenshteinAutomaton) canMatch(state []int) bool {
+	for _, dist := range state {
+		if dist <= a.max {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *levenshteinAutomaton) cap(dist int) int {
+	if dist > a.max {
+		return a.max + 1
+	}
+	return dist
+}
+
+// distance runs the automaton over s, returning the edit
+// distance to the target and whether it is within max
+func (a *levenshteinAutomaton) distance(s string) (int, bool) {
+	// strings too long or short to match need not be walked
+	lengthDiff := utf8.RuneCountInString(s) - len(a.target)
+	if lengthDiff > a.max || -lengthDiff > a.max {
+		return a.max + 1, false
+	}
+
+	state := a.start()
+	for _, r := range s {
+		state = a.step(state, r)
+		if !a.canMatch(state) {
+			return a.max + 1, false
+		}
+	}
+	if !a.isMatch(state) {
+		return a.max + 1, false
+	}
+	return state[len(state)-1], true
+}
@@ -0,0 +1,50 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package search
+
+import (
+	"testing"
+)
+
+func TestLevenshteinAutomaton(t *testing.T) {
+	tests := []struct {
+		target   string
+		max      int
+		input    string
+		distance int
+		match    bool
+	}{
+		{target: "beer", max: 0, input: "beer", distance: 0, match: true},
+		{target: "beer", max: 0, input: "bier", match: false},
+		{target: "beer", max: 1, input: "bier", distance: 1, match: true},
+		{target: "beer", max: 1, input: "beers", distance: 1, match: true},
+		{target: "beer", max: 1, input: "ber", distance: 1, match: true},
+		{target: "beer", max: 1, input: "ebre", match: false},
+		{target: "beer", max: 2, input: "ebre", match: false},
+		{target: "beer", max: 3, input: "ebre", distance: 3, match: true},
+		{target: "beer", max: 2, input: "bear", distance: 1, match: true},
+		{target: "beer", max: 2, input: "angst", match: false},
+		{target: "", max: 1, input: "a", distance: 1, match: true},
+		{target: "", max: 1, input: "ab", match: false},
+		{target: "café", max: 1, input: "cafe", distance: 1, match: true},
+		{target: "beer", max: 1, input: "be", match: false},
+		{target: "beer", max: 2, input: "be", distance: 2, match: true},
+	}
+
+	for _, test := range tests {
+		automaton := newLevenshteinAutomaton(test.target, test.max)
+		distance, match := automaton.distance(test.input)
+		if match != test.match {
+			t.Errorf("expected match %v for %s~%d against %s", test.match, test.target, test.max, test.input)
+		}
+		if match && distance != test.distance {
+			t.Errorf("expected distance %d got %d for %s~%d against %s", test.distance, distance, test.target, test.max, test.input)
+		}
+	}
+}
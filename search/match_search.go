@@ -0,0 +1,71 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package search
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/couchbaselabs/cbfullofit/index"
+)
+
+// NewMatchSearcher analyzes the input with the analyzer of the field
+// and matches the documents containing its terms, any of them with
+// the or operator and all of them with the and operator
+func NewMatchSearcher(ctx context.Context, index index.Index, similarity Similarity, query *MatchQuery) (Searcher, error) {
+	terms, err := analyzeMatch(index, query.Field, query.Match)
+	if err != nil {
+		return nil, err
+	}
+	searchers, err := newTermSearchers(index, similarity, query.Field, terms, query.Boost, query.Explain)
+	if err != nil {
+		return nil, err
+	}
+	if query.Operator == MATCH_AND && len(searchers) > 0 {
+		return newTermConjunctionSearcher(ctx, index, similarity, searchers, query.Explain)
+	}
+	return newTermDisjunctionSearcher(ctx, index, similarity, searchers, float64(query.MinimumShouldMatch), query.Explain)
+}
+
+// analyzeMatch lists the distinct terms the analyzer of the field
+// produces for the input, in order
+func analyzeMatch(idx index.Index, fieldName, input string) ([]string, error) {
+	field := schemaField(idx, fieldName)
+	if field == nil {
+		return nil, fmt.Errorf("No field named `%s` in the schema", fieldName)
+	}
+	if field.Type != "" && field.Type != index.TEXT_FIELD {
+		return nil, fmt.Errorf("match query on %s field `%s`, only text fields are analyzed", field.Type, fieldName)
+	}
+	analyzer, err := field.NewAnalyzer()
+	if err != nil {
+		return nil, err
+	}
+
+	rv := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, token := range analyzer.Analyze([]byte(input)) {
+		term := string(token.Term)
+		if !seen[term] {
+			seen[term] = true
+			rv = append(rv, term)
+		}
+	}
+	return rv, nil
+}
+
+// schemaField finds the named field in the schema of the index
+func schemaField(idx index.Index, name string) *index.Field {
+	for _, field := range idx.Fields() {
+		if field.Name == name {
+			return field
+		}
+	}
+	return nil
+}
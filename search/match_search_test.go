@@ -0,0 +1,140 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package search
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestMatchSearch(t *testing.T) {
+
+	tests := []struct {
+		query *MatchQuery
+		ids   []string
+		err   bool
+	}{
+		{
+			query: &MatchQuery{
+				Match: "BEER",
+				Field: "desc",
+				Boost: 1.0,
+			},
+			ids: []string{"1", "2", "3", "4"},
+		},
+		{
+			query: &MatchQuery{
+				Match: "Couch, dank!",
+				Field: "desc",
+				Boost: 1.0,
+			},
+			ids: []string{"2", "3"},
+		},
+		{
+			query: &MatchQuery{
+				Match:    "beer couch",
+				Field:    "desc",
+				Operator: MATCH_AND,
+				Boost:    1.0,
+			},
+			ids: []string{"2"},
+		},
+		{
+			query: &MatchQuery{
+				Match:              "beer couch dank water",
+				Field:              "desc",
+				MinimumShouldMatch: 2,
+				Boost:              1.0,
+			},
+			ids: []string{"2", "3"},
+		},
+		{
+			// only stop words
+			query: &MatchQuery{
+				Match:    "the",
+				Field:    "desc",
+				Operator: MATCH_AND,
+				Boost:    1.0,
+			},
+			ids: []string{},
+		},
+		{
+			query: &MatchQuery{
+				Match: "beer",
+				Field: "nope",
+				Boost: 1.0,
+			},
+			err: true,
+		},
+	}
+
+	for testIndex, test := range tests {
+		searcher, err := NewMatchSearcher(context.Background(), twoDocIndex, DefaultSimilarity, test.query)
+		if test.err {
+			if err == nil {
+				t.Errorf("expected error for test %d", testIndex)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v for test %d", err, testIndex)
+		}
+
+		ids := make([]string, 0)
+		next, err := searcher.Next(context.Background())
+		for err == nil && next != nil {
+			ids = append(ids, next.ID)
+			next, err = searcher.Next(context.Background())
+		}
+		searcher.Close()
+		if err != nil {
+			t.Fatalf("error iterating searcher: %v for test %d", err, testIndex)
+		}
+		if !reflect.DeepEqual(ids, test.ids) {
+			t.Errorf("expected ids %v got %v for test %d", test.ids, ids, testIndex)
+		}
+	}
+}
+
+func TestMatchQueryValidate(t *testing.T) {
+	tests := []struct {
+		query *MatchQuery
+		err   bool
+	}{
+		{
+			query: &MatchQuery{Match: "beer", Field: "desc"},
+		},
+		{
+			query: &MatchQuery{Match: "beer", Field: "desc", Operator: MATCH_OR, MinimumShouldMatch: 1},
+		},
+		{
+			query: &MatchQuery{Match: "beer", Field: "desc", Operator: "xor"},
+			err:   true,
+		},
+		{
+			query: &MatchQuery{Match: "beer", Field: "desc", Operator: MATCH_AND, MinimumShouldMatch: 1},
+			err:   true,
+		},
+		{
+			query: &MatchQuery{Match: "beer", Field: "desc", MinimumShouldMatch: -1},
+			err:   true,
+		},
+	}
+
+	for testIndex, test := range tests {
+		err := test.query.Validate()
+		if test.err && err == nil {
+			t.Errorf("expected error for test %d", testIndex)
+		}
+		if !test.err && err != nil {
+			t.Errorf("unexpected error: %v for test %d", err, testIndex)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package search
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/couchbaselabs/cbfullofit/index"
+)
+
+// DEFAULT_MAX_EXPANSIONS bounds the number of terms a prefix,
+// wildcard or regexp query may expand to when the query does
+// not set its own limit
+var DEFAULT_MAX_EXPANSIONS = 1024
+
+// NewPrefixSearcher matches the terms starting with the prefix
+func NewPrefixSearcher(ctx context.Context, index index.Index, similarity Similarity, query *PrefixQuery) (*TermDisjunctionSearcher, error) {
+	start, end := prefixRange(query.Prefix)
+	terms, err := expandTerms(ctx, index, query.Field, start, end, nil, query.MaxExpansions)
+	if err != nil {
+		return nil, expansionError(ctx, "prefix", query.Prefix, err)
+	}
+	return newMultiTermSearcher(ctx, index, similarity, query.Field, terms, query.Boost, query.Explain)
+}
+
+// NewWildcardSearcher matches the terms matching the pattern,
+// where * matches any number of characters and ? matches one
+func NewWildcardSearcher(ctx context.Context, index index.Index, similarity Similarity, query *WildcardQuery) (*TermDisjunctionSearcher, error) {
+	re, err := query.compile()
+	if err != nil {
+		return nil, err
+	}
+	prefix, _ := re.LiteralPrefix()
+	start, end := prefixRange(prefix)
+	terms, err := expandTerms(ctx, index, query.Field, start, end, re.MatchString, query.MaxExpansions)
+	if err != nil {
+		return nil, expansionError(ctx, "wildcard", query.Wildcard, err)
+	}
+	return newMultiTermSearcher(ctx, index, similarity, query.Field, terms, query.Boost, query.Explain)
+}
+
+// NewRegexpSearcher matches the terms matching the regular
+// expression in full
+func NewRegexpSearcher(ctx context.Context, index index.Index, similarity Similarity, query *RegexpQuery) (*TermDisjunctionSearcher, error) {
+	re, err := query.compile()
+	if err != nil {
+		return nil, err
+	}
+	prefix, _ := re.LiteralPrefix()
+	start, end := prefixRange(prefix)
+	terms, err := expandTerms(ctx, index, query.Field, start, end, re.MatchString, query.MaxExpansions)
+	if err != nil {
+		return nil, expansionError(ctx, "regexp", query.Regexp, err)
+	}
+	return newMultiTermSearcher(ctx, index, similarity, query.Field, terms, query.Boost, query.Explain)
+}
+
+// prefixRange is the term dictionary range holding all the terms
+// starting with prefix, 0xff never occurs in UTF-8 terms
+func prefixRange(prefix string) ([]byte, []byte) {
+	if prefix == "" {
+		return nil, nil
+	}
+	return []byte(prefix), []byte(prefix + "\xff")
+}
+
+// expandTerms lists the terms of the field between start and end
+// accepted by match if not nil, failing if there are more than max.
+// Short prefixes walk much of the dictionary, so the walk stops when
+// the search is cancelled.
+func expandTerms(ctx context.Context, idx index.Index, field string, start, end []byte, match func(term string) bool, max int) ([]string, error) {
+	if max <= 0 {
+		max = DEFAULT_MAX_EXPANSIONS
+	}
+
+	fieldDict, err := idx.FieldDict(field, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer fieldDict.Close()
+
+	rv := make([]string, 0)
+	entry, err := fieldDict.Next()
+	for err == nil && entry != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if match == nil || match(entry.Term) {
+			if len(rv) >= max {
+				return nil, fmt.Errorf("expands to more than %d terms, raise max_expansions or narrow the query", max)
+			}
+			rv = append(rv, entry.Term)
+		}
+		entry, err = fieldDict.Next()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rv, nil
+}
+
+// expansionError names the query which failed to expand, errors
+// stopping the search are returned as is for the caller to tell apart
+func expansionError(ctx context.Context, kind, query string, err error) error {
+	if err == ctx.Err() {
+		return err
+	}
+	return fmt.Errorf("%s query `%s`: %v", kind, query, err)
+}
+
+func newMultiTermSearcher(ctx context.Context, idx index.Index, similarity Similarity, field string, terms []string, boost float64, explain bool) (*TermDisjunctionSearcher, error) {
+	searchers, err := newTermSearchers(idx, similarity, field, terms, boost, explain)
+	if err != nil {
+		return nil, err
+	}
+	return newTermDisjunctionSearcher(ctx, idx, similarity, searchers, 0, explain)
+}
+
+// newTermSearchers opens a term searcher for each of the terms
+func newTermSearchers(idx index.Index, similarity Similarity, field string, terms []string, boost float64, explain bool) (OrderedSearcherList, error) {
+	searchers := make(OrderedSearcherList, len(terms))
+	for i, term := range terms {
+		query := TermQuery{
+			Term:    term,
+			Field:   field,
+			Boost:   boost,
+			Explain: explain,
+		}
+		searcher, err := NewTermSearcher(idx, similarity, &query)
+		if err != nil {
+			for _, opened := range searchers[:i] {
+				opened.Close()
+			}
+			return nil, err
+		}
+		searchers[i] = searcher
+	}
+	return searchers, nil
+}
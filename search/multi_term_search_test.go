@@ -0,0 +1,190 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package search
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestMultiTermSearch(t *testing.T) {
+
+	tests := []struct {
+		query Query
+		ids   []string
+		err   bool
+	}{
+		{
+			query: &PrefixQuery{
+				Prefix: "be",
+				Field:  "desc",
+				Boost:  1.0,
+			},
+			ids: []string{"1", "2", "3", "4"},
+		},
+		{
+			query: &PrefixQuery{
+				Prefix: "d",
+				Field:  "desc",
+				Boost:  1.0,
+			},
+			ids: []string{"2", "3"},
+		},
+		{
+			query: &PrefixQuery{
+				Prefix: "z",
+				Field:  "desc",
+				Boost:  1.0,
+			},
+			ids: []string{},
+		},
+		{
+			query: &WildcardQuery{
+				Wildcard: "*a?e*",
+				Field:    "desc",
+				Boost:    1.0,
+			},
+			// database, water
+			ids: []string{"2", "5"},
+		},
+		{
+			query: &WildcardQuery{
+				Wildcard: "c*",
+				Field:    "desc",
+				Boost:    1.0,
+			},
+			// couch, column
+			ids: []string{"2", "3"},
+		},
+		{
+			query: &RegexpQuery{
+				Regexp: "[a-c].*[hn]",
+				Field:  "desc",
+				Boost:  1.0,
+			},
+			// couch, column
+			ids: []string{"2", "3"},
+		},
+		{
+			query: &RegexpQuery{
+				Regexp: "d.*",
+				Field:  "desc",
+				Boost:  1.0,
+			},
+			// database, dank
+			ids: []string{"2", "3"},
+		},
+		{
+			query: &PrefixQuery{
+				Prefix:        "d",
+				Field:         "desc",
+				MaxExpansions: 1,
+				Boost:         1.0,
+			},
+			err: true,
+		},
+		{
+			query: &RegexpQuery{
+				Regexp: ".*",
+				Field:  "nope",
+				Boost:  1.0,
+			},
+			err: true,
+		},
+	}
+
+	for testIndex, test := range tests {
+		searcher, err := test.query.Searcher(context.Background(), twoDocIndex, DefaultSimilarity)
+		if test.err {
+			if err == nil {
+				t.Errorf("expected error for test %d", testIndex)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v for test %d", err, testIndex)
+		}
+
+		ids := make([]string, 0)
+		next, err := searcher.Next(context.Background())
+		for err == nil && next != nil {
+			ids = append(ids, next.ID)
+			next, err = searcher.Next(context.Background())
+		}
+		searcher.Close()
+		if err != nil {
+			t.Fatalf("error iterating searcher: %v for test %d", err, testIndex)
+		}
+		if !reflect.DeepEqual(ids, test.ids) {
+			t.Errorf("expected ids %v got %v for test %d", test.ids, ids, testIndex)
+		}
+	}
+}
+
+func TestPrefixSearchScoresLikeTerm(t *testing.T) {
+	// a prefix matching a single term scores like that term
+	prefixSearcher, err := NewPrefixSearcher(context.Background(), twoDocIndex, DefaultSimilarity, &PrefixQuery{
+		Prefix: "be",
+		Field:  "desc",
+		Boost:  1.0,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer prefixSearcher.Close()
+	termSearcher, err := NewTermSearcher(twoDocIndex, DefaultSimilarity, &TermQuery{
+		Term:  "beer",
+		Field: "desc",
+		Boost: 1.0,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer termSearcher.Close()
+	termSearcher.SetQueryNorm(DefaultSimilarity.QueryNorm(termSearcher.Weight()))
+
+	for {
+		prefixMatch, err := prefixSearcher.Next(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		termMatch, err := termSearcher.Next(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if prefixMatch == nil || termMatch == nil {
+			if prefixMatch != nil || termMatch != nil {
+				t.Errorf("expected the same number of matches")
+			}
+			break
+		}
+		if prefixMatch.ID != termMatch.ID || prefixMatch.Score != termMatch.Score {
+			t.Errorf("expected %s %f got %s %f", termMatch.ID, termMatch.Score, prefixMatch.ID, prefixMatch.Score)
+		}
+	}
+}
+
+func TestMultiTermSearchCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	queries := []Query{
+		&PrefixQuery{Prefix: "", Field: "desc", Boost: 1.0},
+		&WildcardQuery{Wildcard: "*", Field: "desc", Boost: 1.0},
+		&RegexpQuery{Regexp: ".*", Field: "desc", Boost: 1.0},
+		&FuzzyQuery{Term: "beer", Field: "desc", Fuzziness: 1, Boost: 1.0},
+	}
+	for queryIndex, query := range queries {
+		_, err := query.Searcher(ctx, twoDocIndex, DefaultSimilarity)
+		if err != context.Canceled {
+			t.Errorf("expected context.Canceled, got %v for query %d", err, queryIndex)
+		}
+	}
+}
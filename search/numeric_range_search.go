@@ -0,0 +1,74 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package search
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/couchbaselabs/cbfullofit/index"
+	"github.com/couchbaselabs/cbfullofit/numeric"
+)
+
+// NewNumericRangeSearcher matches the documents with a value in
+// the range, expanded to the fewest prefix coded terms covering it
+func NewNumericRangeSearcher(ctx context.Context, index index.Index, similarity Similarity, query *NumericRangeQuery) (*TermDisjunctionSearcher, error) {
+	min := int64(math.MinInt64)
+	if query.Min != nil {
+		min = numeric.Float64ToInt64(*query.Min)
+		if !query.inclusive() {
+			min++
+		}
+	}
+	max := int64(math.MaxInt64)
+	if query.Max != nil {
+		max = numeric.Float64ToInt64(*query.Max)
+		if !query.inclusive() {
+			max--
+		}
+	}
+
+	searcher, err := newPrefixCodedRangeSearcher(ctx, index, similarity, query.Field, min, max, query.Boost, query.Explain)
+	if err != nil {
+		if err == ctx.Err() {
+			return nil, err
+		}
+		return nil, fmt.Errorf("numeric range query: %v", err)
+	}
+	return searcher, nil
+}
+
+// newPrefixCodedRangeSearcher matches the prefix coded values of
+// the field from min to max inclusive
+func newPrefixCodedRangeSearcher(ctx context.Context, idx index.Index, similarity Similarity, field string, min, max int64, boost float64, explain bool) (*TermDisjunctionSearcher, error) {
+	terms, err := indexedTerms(idx, field, numeric.SplitInt64Range(min, max))
+	if err != nil {
+		return nil, err
+	}
+	return newMultiTermSearcher(ctx, idx, similarity, field, terms, boost, explain)
+}
+
+// indexedTerms keeps the terms occurring in the field, most of the
+// terms covering a range are not indexed by any document
+func indexedTerms(idx index.Index, field string, terms []numeric.PrefixCoded) ([]string, error) {
+	rv := make([]string, 0)
+	for _, term := range terms {
+		reader, err := idx.TermFieldReader(term, field)
+		if err != nil {
+			return nil, err
+		}
+		count := reader.Count()
+		reader.Close()
+		if count > 0 {
+			rv = append(rv, string(term))
+		}
+	}
+	return rv, nil
+}
@@ -0,0 +1,170 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package search
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/couchbaselabs/cbfullofit/index"
+	"github.com/couchbaselabs/cbfullofit/index/mock"
+)
+
+var numericIndexSchema = []*index.Field{
+	&index.Field{
+		Name:     "name",
+		Path:     "/name",
+		Analyzer: "standard",
+	},
+	&index.Field{
+		Name: "abv",
+		Path: "/abv",
+		Type: index.NUMERIC_FIELD,
+	},
+}
+
+var numericIndex *mock.MockIndex = mock.NewMockIndexWithDocs(numericIndexSchema, map[string]interface{}{
+	"1": map[string]interface{}{
+		"name": "light",
+		"abv":  3.2,
+	},
+	"2": map[string]interface{}{
+		"name": "pale",
+		"abv":  5,
+	},
+	"3": map[string]interface{}{
+		"name": "stout",
+		"abv":  7.5,
+	},
+	"4": map[string]interface{}{
+		"name": "barleywine",
+		"abv":  12,
+	},
+	"5": map[string]interface{}{
+		"name": "shandy",
+		"abv":  -1,
+	},
+	"6": map[string]interface{}{
+		"name": "unknown",
+		"abv":  "strong",
+	},
+})
+
+func TestNumericRangeSearch(t *testing.T) {
+	five := 5.0
+	sevenAndAHalf := 7.5
+	zero := 0.0
+	exclusive := false
+
+	tests := []struct {
+		query *NumericRangeQuery
+		ids   []string
+	}{
+		{
+			query: &NumericRangeQuery{
+				Min:   &five,
+				Max:   &sevenAndAHalf,
+				Field: "abv",
+				Boost: 1.0,
+			},
+			ids: []string{"2", "3"},
+		},
+		{
+			query: &NumericRangeQuery{
+				Min:       &five,
+				Max:       &sevenAndAHalf,
+				Inclusive: &exclusive,
+				Field:     "abv",
+				Boost:     1.0,
+			},
+			ids: []string{},
+		},
+		{
+			query: &NumericRangeQuery{
+				Min:   &five,
+				Field: "abv",
+				Boost: 1.0,
+			},
+			ids: []string{"2", "3", "4"},
+		},
+		{
+			query: &NumericRangeQuery{
+				Max:   &zero,
+				Field: "abv",
+				Boost: 1.0,
+			},
+			ids: []string{"5"},
+		},
+		{
+			query: &NumericRangeQuery{
+				Min:   &zero,
+				Field: "abv",
+				Boost: 1.0,
+			},
+			ids: []string{"1", "2", "3", "4"},
+		},
+	}
+
+	for testIndex, test := range tests {
+		searcher, err := NewNumericRangeSearcher(context.Background(), numericIndex, DefaultSimilarity, test.query)
+		if err != nil {
+			t.Fatalf("unexpected error: %v for test %d", err, testIndex)
+		}
+
+		ids := make([]string, 0)
+		next, err := searcher.Next(context.Background())
+		for err == nil && next != nil {
+			ids = append(ids, next.ID)
+			next, err = searcher.Next(context.Background())
+		}
+		searcher.Close()
+		if err != nil {
+			t.Fatalf("error iterating searcher: %v for test %d", err, testIndex)
+		}
+		if !reflect.DeepEqual(ids, test.ids) {
+			t.Errorf("expected ids %v got %v for test %d", test.ids, ids, testIndex)
+		}
+	}
+}
+
+func TestNumericRangeQueryValidate(t *testing.T) {
+	one := 1.0
+	two := 2.0
+
+	tests := []struct {
+		query *NumericRangeQuery
+		err   bool
+	}{
+		{
+			query: &NumericRangeQuery{Min: &one, Max: &two, Field: "abv"},
+		},
+		{
+			query: &NumericRangeQuery{Max: &one, Field: "abv"},
+		},
+		{
+			query: &NumericRangeQuery{Min: &two, Max: &one, Field: "abv"},
+			err:   true,
+		},
+		{
+			query: &NumericRangeQuery{Field: "abv"},
+			err:   true,
+		},
+	}
+
+	for testIndex, test := range tests {
+		err := test.query.Validate()
+		if test.err && err == nil {
+			t.Errorf("expected error for test %d", testIndex)
+		}
+		if !test.err && err != nil {
+			t.Errorf("unexpected error: %v for test %d", err, testIndex)
+		}
+	}
+}
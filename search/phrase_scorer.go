@@ -0,0 +1,132 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package search
+
+import (
+	"fmt"
+	"strings"
+)
+
+type PhraseQueryScorer struct {
+	field                  string
+	phrase                 string
+	boost                  float64
+	similarity             Similarity
+	avgFieldLength         float64
+	idf                    float64
+	explain                bool
+	idfExplanation         *Explanation
+	queryNorm              float64
+	queryWeight            float64
+	queryWeightExplanation *Explanation
+}
+
+func NewPhraseQueryScorer(field string, terms []string, slop int, boost float64, similarity Similarity, docTotal uint64, docTerms []uint64, avgFieldLength float64, explain bool) *PhraseQueryScorer {
+	phrase := strings.Join(terms, " ")
+	if slop > 0 {
+		phrase = fmt.Sprintf("%s~%d", phrase, slop)
+	}
+	rv := PhraseQueryScorer{
+		field:          field,
+		phrase:         phrase,
+		boost:          boost,
+		similarity:     similarity,
+		avgFieldLength: avgFieldLength,
+		explain:        explain,
+		queryWeight:    1.0,
+	}
+
+	// the idf of a phrase is the sum of the idf of its terms
+	var idfExplanations []*Explanation
+	if explain {
+		idfExplanations = make([]*Explanation, len(terms))
+	}
+	for i, docTerm := range docTerms {
+		termIdf := similarity.Idf(docTerm, docTotal)
+		rv.idf += termIdf
+		if explain {
+			idfExplanations[i] = &Explanation{
+				Value:   termIdf,
+				Message: fmt.Sprintf("idf(%s: docFreq=%d, maxDocs=%d)", terms[i], docTerm, docTotal),
+			}
+		}
+	}
+
+	if explain {
+		rv.idfExplanation = &Explanation{
+			Value:    rv.idf,
+			Message:  fmt.Sprintf("idf(%s:\"%s\"), sum of:", field, phrase),
+			Children: idfExplanations,
+		}
+	}
+
+	return &rv
+}
+
+func (s *PhraseQueryScorer) Weight() float64 {
+	sum := s.boost * s.idf
+	return sum * sum
+}
+
+func (s *PhraseQueryScorer) SetQueryNorm(qnorm float64) {
+	s.queryNorm = qnorm
+
+	// update the query weight
+	s.queryWeight = s.similarity.QueryWeight(s.boost, s.idf, s.queryNorm)
+
+	if s.explain {
+		s.queryWeightExplanation = &Explanation{
+			Value:    s.queryWeight,
+			Message:  fmt.Sprintf("queryWeight(%s:\"%s\"^%f), product of:", s.field, s.phrase, s.boost),
+			Children: s.similarity.ExplainQueryWeight(s.boost, s.idfExplanation, s.queryNorm),
+		}
+	}
+}
+
+func (s *PhraseQueryScorer) Score(id string, phraseFreq float64, fieldLength uint64) *DocumentMatch {
+	tf := s.similarity.Tf(phraseFreq, fieldLength, s.avgFieldLength)
+	score := tf * s.idf
+
+	var scoreExplanation *Explanation
+	if s.explain {
+		childrenExplanations := make([]*Explanation, 2)
+		childrenExplanations[0] = s.similarity.ExplainTf(s.field, fmt.Sprintf("\"%s\"", s.phrase), phraseFreq, fieldLength, s.avgFieldLength)
+		childrenExplanations[1] = s.idfExplanation
+		scoreExplanation = &Explanation{
+			Value:    score,
+			Message:  fmt.Sprintf("fieldWeight(%s:\"%s\" in %s), product of:", s.field, s.phrase, id),
+			Children: childrenExplanations,
+		}
+	}
+
+	// if the query weight isn't 1, multiply
+	if s.queryWeight != 1.0 {
+		score = score * s.queryWeight
+		if s.explain {
+			childExplanations := make([]*Explanation, 2)
+			childExplanations[0] = s.queryWeightExplanation
+			childExplanations[1] = scoreExplanation
+			scoreExplanation = &Explanation{
+				Value:    score,
+				Message:  fmt.Sprintf("weight(%s:\"%s\"^%f in %s), product of:", s.field, s.phrase, s.boost, id),
+				Children: childExplanations,
+			}
+		}
+	}
+
+	rv := DocumentMatch{
+		ID:    id,
+		Score: score,
+	}
+	if s.explain {
+		rv.Expl = scoreExplanation
+	}
+
+	return &rv
+}
@@ -0,0 +1,294 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package search
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/couchbaselabs/cbfullofit/index"
+)
+
+type PhraseSearcher struct {
+	index   index.Index
+	field   string
+	terms   []string
+	slop    int
+	readers []index.TermFieldReader
+	currs   []*index.TermFieldDoc
+	scorer  *PhraseQueryScorer
+}
+
+func NewPhraseSearcher(index index.Index, similarity Similarity, query *PhraseQuery) (*PhraseSearcher, error) {
+	return newPhraseSearcher(index, similarity, query.Field, query.Terms, 0, query.Boost, query.Explain)
+}
+
+func NewSloppyPhraseSearcher(index index.Index, similarity Similarity, query *SloppyPhraseQuery) (*PhraseSearcher, error) {
+	return newPhraseSearcher(index, similarity, query.Field, query.Terms, query.Slop, query.Boost, query.Explain)
+}
+
+func newPhraseSearcher(idx index.Index, similarity Similarity, field string, terms []string, slop int, boost float64, explain bool) (*PhraseSearcher, error) {
+	// open a reader for each term, in phrase order
+	readers := make([]index.TermFieldReader, len(terms))
+	docTerms := make([]uint64, len(terms))
+	for i, term := range terms {
+		reader, err := idx.TermFieldReader([]byte(term), field)
+		if err != nil {
+			for _, opened := range readers[:i] {
+				opened.Close()
+			}
+			return nil, err
+		}
+		readers[i] = reader
+		docTerms[i] = reader.Count()
+	}
+
+	avgFieldLength, err := idx.AvgFieldLength(field)
+	if err != nil {
+		for _, opened := range readers {
+			opened.Close()
+		}
+		return nil, err
+	}
+
+	rv := PhraseSearcher{
+		index:   idx,
+		field:   field,
+		terms:   terms,
+		slop:    slop,
+		readers: readers,
+		currs:   make([]*index.TermFieldDoc, len(readers)),
+		scorer:  NewPhraseQueryScorer(field, terms, slop, boost, similarity, idx.DocCount(), docTerms, avgFieldLength, explain),
+	}
+	err = rv.initReaders()
+	if err != nil {
+		rv.Close()
+		return nil, err
+	}
+
+	return &rv, nil
+}
+
+func (s *PhraseSearcher) initReaders() error {
+	var err error
+	// get all readers pointing at their first match
+	for i, reader := range s.readers {
+		s.currs[i], err = reader.Next()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *PhraseSearcher) exhausted() bool {
+	if len(s.currs) == 0 {
+		return true
+	}
+	for _, curr := range s.currs {
+		if curr == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *PhraseSearcher) Count() uint64 {
+	// a phrase can match no more docs than its rarest term
+	var rv uint64
+	for i, reader := range s.readers {
+		if i == 0 || reader.Count() < rv {
+			rv = reader.Count()
+		}
+	}
+	return rv
+}
+
+func (s *PhraseSearcher) Weight() float64 {
+	return s.scorer.Weight()
+}
+
+func (s *PhraseSearcher) SetQueryNorm(qnorm float64) {
+	s.scorer.SetQueryNorm(qnorm)
+}
+
+func (s *PhraseSearcher) Next(ctx context.Context) (*DocumentMatch, error) {
+	var err error
+	for !s.exhausted() {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		// the candidate is the largest doc id under any of the readers
+		candidate := s.currs[0].ID
+		for _, curr := range s.currs[1:] {
+			if curr.ID > candidate {
+				candidate = curr.ID
+			}
+		}
+
+		// advance the readers that are behind the candidate
+		allMatch := true
+		for i, curr := range s.currs {
+			if curr.ID < candidate {
+				s.currs[i], err = s.readers[i].Advance([]byte(candidate))
+				if err != nil {
+					return nil, err
+				}
+				if s.currs[i] == nil {
+					return nil, nil
+				}
+				if s.currs[i].ID != candidate {
+					allMatch = false
+				}
+			}
+		}
+		if !allMatch {
+			continue
+		}
+
+		// every term occurs in the candidate, now verify their positions
+		var freq float64
+		freq, err = s.phraseFrequency()
+		if err != nil {
+			return nil, err
+		}
+		var rv *DocumentMatch
+		if freq > 0 {
+			var fieldLength uint64
+			fieldLength, err = s.index.FieldLength([]byte(candidate), s.field)
+			if err != nil {
+				return nil, err
+			}
+			rv = s.scorer.Score(candidate, freq, fieldLength)
+			rv.Locations = s.locations()
+		}
+
+		// prepare for next entry
+		s.currs[0], err = s.readers[0].Next()
+		if err != nil {
+			return nil, err
+		}
+
+		if rv != nil {
+			return rv, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *PhraseSearcher) Advance(ctx context.Context, ID string) (*DocumentMatch, error) {
+	var err error
+	for i, curr := range s.currs {
+		if curr != nil && curr.ID < ID {
+			s.currs[i], err = s.readers[i].Advance([]byte(ID))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return s.Next(ctx)
+}
+
+// phraseFrequency returns how often the phrase occurs in the
+// document currently under all the readers.  Exact matches count
+// 1, sloppy matches count 1/(distance+1).
+func (s *PhraseSearcher) phraseFrequency() (float64, error) {
+	positions := make([][]int64, len(s.currs))
+	for i, curr := range s.currs {
+		for _, vector := range curr.Vectors {
+			if vector.Field == s.field {
+				positions[i] = append(positions[i], int64(vector.Pos))
+			}
+		}
+		if len(positions[i]) == 0 {
+			return 0, fmt.Errorf("phrase query requires term vectors for field `%s`", s.field)
+		}
+		sort.Sort(int64Slice(positions[i]))
+	}
+
+	var freq float64
+	for _, start := range positions[0] {
+		// place each following term as close as possible to
+		// where it would be in an exact match, tracking how
+		// far apart the placed terms ended up.  A term repeated
+		// in the phrase needs another occurrence for each repeat.
+		used := map[int64]bool{start: true}
+		minOffset := start
+		maxOffset := start
+		placed := true
+		for i := 1; i < len(positions); i++ {
+			pos, ok := closestPosition(positions[i], start+int64(i), used)
+			if !ok {
+				placed = false
+				break
+			}
+			used[pos] = true
+			offset := pos - int64(i)
+			if offset < minOffset {
+				minOffset = offset
+			}
+			if offset > maxOffset {
+				maxOffset = offset
+			}
+		}
+		distance := maxOffset - minOffset
+		if placed && distance <= int64(s.slop) {
+			freq += 1.0 / float64(distance+1)
+		}
+	}
+	return freq, nil
+}
+
+// locations returns where the terms of the phrase occur in the
+// document currently under all the readers
+func (s *PhraseSearcher) locations() FieldTermLocationMap {
+	rv := make(FieldTermLocationMap)
+	for i, curr := range s.currs {
+		vectors := make([]*index.TermFieldVector, 0, len(curr.Vectors))
+		for _, vector := range curr.Vectors {
+			if vector.Field == s.field {
+				vectors = append(vectors, vector)
+			}
+		}
+		rv.AddTermVectors(s.terms[i], vectors)
+	}
+	return rv
+}
+
+func (s *PhraseSearcher) Close() {
+	for _, reader := range s.readers {
+		reader.Close()
+	}
+}
+
+// closestPosition is the position nearest to target not used by
+// another term of the phrase, false if all of them are
+func closestPosition(positions []int64, target int64, used map[int64]bool) (int64, bool) {
+	var rv int64
+	found := false
+	for _, pos := range positions {
+		if used[pos] {
+			continue
+		}
+		if !found || math.Abs(float64(pos-target)) < math.Abs(float64(rv-target)) {
+			rv = pos
+			found = true
+		}
+	}
+	return rv, found
+}
+
+type int64Slice []int64
+
+func (s int64Slice) Len() int           { return len(s) }
+func (s int64Slice) Less(i, j int) bool { return s[i] < s[j] }
+func (s int64Slice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,226 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package search
+
+import (
+	"context"
+	"testing"
+
+	"github.com/couchbaselabs/cbfullofit/index"
+	"github.com/couchbaselabs/cbfullofit/index/mock"
+)
+
+var phraseIndexSchema = []*index.Field{
+	&index.Field{
+		Name:               "desc",
+		Path:               "/description",
+		Analyzer:           "standard",
+		IncludeTermVectors: true,
+	},
+	&index.Field{
+		Name:     "name",
+		Path:     "/name",
+		Analyzer: "standard",
+	},
+}
+
+var phraseIndexDocs = map[string]interface{}{
+	"1": map[string]interface{}{
+		"name":        "marty",
+		"description": "angst beer couch database",
+	},
+	"2": map[string]interface{}{
+		"name":        "steve",
+		"description": "beer angst couch",
+	},
+	"3": map[string]interface{}{
+		"name":        "dustin",
+		"description": "couch beer angst database",
+	},
+	"4": map[string]interface{}{
+		"name":        "ravi",
+		"description": "angst beer angst beer water",
+	},
+}
+
+var phraseIndex *mock.MockIndex = mock.NewMockIndexWithDocs(phraseIndexSchema, phraseIndexDocs)
+
+func TestPhraseSearch(t *testing.T) {
+
+	tests := []struct {
+		index    index.Index
+		searcher func() (Searcher, error)
+		results  []*DocumentMatch
+	}{
+		{
+			index: phraseIndex,
+			searcher: func() (Searcher, error) {
+				return NewPhraseSearcher(phraseIndex, DefaultSimilarity, &PhraseQuery{
+					Terms:   []string{"angst", "beer"},
+					Field:   "desc",
+					Boost:   1.0,
+					Explain: true,
+				})
+			},
+			results: []*DocumentMatch{
+				&DocumentMatch{
+					ID:    "1",
+					Score: 0.7768564486857903,
+				},
+				&DocumentMatch{
+					ID:    "4",
+					Score: 0.9826543171347271,
+				},
+			},
+		},
+		{
+			index: phraseIndex,
+			searcher: func() (Searcher, error) {
+				return NewPhraseSearcher(phraseIndex, DefaultSimilarity, &PhraseQuery{
+					Terms:   []string{"beer", "water"},
+					Field:   "desc",
+					Boost:   1.0,
+					Explain: true,
+				})
+			},
+			results: []*DocumentMatch{
+				&DocumentMatch{
+					ID:    "4",
+					Score: 1.1046192039329306,
+				},
+			},
+		},
+		{
+			index: phraseIndex,
+			searcher: func() (Searcher, error) {
+				return NewSloppyPhraseSearcher(phraseIndex, DefaultSimilarity, &SloppyPhraseQuery{
+					Terms:   []string{"angst", "couch"},
+					Field:   "desc",
+					Slop:    1,
+					Boost:   1.0,
+					Explain: true,
+				})
+			},
+			results: []*DocumentMatch{
+				&DocumentMatch{
+					ID:    "1",
+					Score: 0.6282136220303846,
+				},
+				&DocumentMatch{
+					ID:    "2",
+					Score: 1.0258685489600636,
+				},
+			},
+		},
+		{
+			index: phraseIndex,
+			searcher: func() (Searcher, error) {
+				return NewSloppyPhraseSearcher(phraseIndex, DefaultSimilarity, &SloppyPhraseQuery{
+					Terms:   []string{"angst", "beer"},
+					Field:   "desc",
+					Slop:    2,
+					Boost:   1.0,
+					Explain: true,
+				})
+			},
+			results: []*DocumentMatch{
+				&DocumentMatch{
+					ID:    "1",
+					Score: 0.7768564486857903,
+				},
+				&DocumentMatch{
+					ID:    "2",
+					Score: 0.5179042991238603,
+				},
+				&DocumentMatch{
+					ID:    "3",
+					Score: 0.4485182797704377,
+				},
+				&DocumentMatch{
+					ID:    "4",
+					Score: 0.9826543171347271,
+				},
+			},
+		},
+	}
+
+	for testIndex, test := range tests {
+		searcher, err := test.searcher()
+		if err != nil {
+			t.Fatalf("error building searcher: %v for test %d", err, testIndex)
+		}
+		defer searcher.Close()
+
+		next, err := searcher.Next(context.Background())
+		i := 0
+		for err == nil && next != nil {
+			if i < len(test.results) {
+				if next.ID != test.results[i].ID {
+					t.Errorf("expected result %d to have id %s got %s for test %d", i, test.results[i].ID, next.ID, testIndex)
+				}
+				if next.Score != test.results[i].Score {
+					t.Errorf("expected result %d to have score %v got  %v for test %d", i, test.results[i].Score, next.Score, testIndex)
+					t.Logf("scoring explanation: %s", next.Expl)
+				}
+			}
+			next, err = searcher.Next(context.Background())
+			i++
+		}
+		if err != nil {
+			t.Fatalf("error iterating searcher: %v for test %d", err, testIndex)
+		}
+		if len(test.results) != i {
+			t.Errorf("expected %d results got %d for test %d", len(test.results), i, testIndex)
+		}
+	}
+}
+
+func TestPhraseSearchRequiresTermVectors(t *testing.T) {
+	searcher, err := NewPhraseSearcher(phraseIndex, DefaultSimilarity, &PhraseQuery{
+		Terms: []string{"marty"},
+		Field: "name",
+		Boost: 1.0,
+	})
+	if err != nil {
+		t.Fatalf("error building searcher: %v", err)
+	}
+	defer searcher.Close()
+
+	_, err = searcher.Next(context.Background())
+	if err == nil {
+		t.Errorf("expected error for phrase on field without term vectors")
+	}
+}
+
+func TestSloppyPhraseSearchRepeatedTerm(t *testing.T) {
+	// each angst needs its own occurrence, only 4 has two
+	searcher, err := NewSloppyPhraseSearcher(phraseIndex, DefaultSimilarity, &SloppyPhraseQuery{
+		Terms: []string{"angst", "beer", "angst"},
+		Field: "desc",
+		Slop:  2,
+		Boost: 1.0,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer searcher.Close()
+
+	ids := make([]string, 0)
+	next, err := searcher.Next(context.Background())
+	for err == nil && next != nil {
+		ids = append(ids, next.ID)
+		next, err = searcher.Next(context.Background())
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != "4" {
+		t.Errorf("expected only document 4 to match, got %v", ids)
+	}
+}
@@ -9,15 +9,18 @@
 package search
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"regexp"
+	"time"
 
 	"github.com/couchbaselabs/cbfullofit/index"
 )
 
 type Query interface {
 	GetBoost() float64
-	Searcher(index index.Index) (Searcher, error)
+	Searcher(ctx context.Context, index index.Index, similarity Similarity) (Searcher, error)
 	Validate() error
 }
 
@@ -36,6 +39,98 @@ func ParseQuery(input []byte) (Query, error) {
 		}
 		return rv, nil
 	}
+	_, isPhraseQuery := tmp["phrase"]
+	if isPhraseQuery {
+		_, hasSlop := tmp["slop"]
+		if hasSlop {
+			var rv *SloppyPhraseQuery
+			err := json.Unmarshal(input, &rv)
+			if err != nil {
+				return nil, err
+			}
+			return rv, nil
+		}
+		var rv *PhraseQuery
+		err := json.Unmarshal(input, &rv)
+		if err != nil {
+			return nil, err
+		}
+		return rv, nil
+	}
+	_, isMatchQuery := tmp["match"]
+	if isMatchQuery {
+		var rv *MatchQuery
+		err := json.Unmarshal(input, &rv)
+		if err != nil {
+			return nil, err
+		}
+		return rv, nil
+	}
+	_, isFuzzyQuery := tmp["fuzzy"]
+	if isFuzzyQuery {
+		var rv *FuzzyQuery
+		err := json.Unmarshal(input, &rv)
+		if err != nil {
+			return nil, err
+		}
+		return rv, nil
+	}
+	_, isPrefixQuery := tmp["prefix"]
+	if isPrefixQuery {
+		var rv *PrefixQuery
+		err := json.Unmarshal(input, &rv)
+		if err != nil {
+			return nil, err
+		}
+		return rv, nil
+	}
+	_, isWildcardQuery := tmp["wildcard"]
+	if isWildcardQuery {
+		var rv *WildcardQuery
+		err := json.Unmarshal(input, &rv)
+		if err != nil {
+			return nil, err
+		}
+		return rv, nil
+	}
+	_, isRegexpQuery := tmp["regexp"]
+	if isRegexpQuery {
+		var rv *RegexpQuery
+		err := json.Unmarshal(input, &rv)
+		if err != nil {
+			return nil, err
+		}
+		return rv, nil
+	}
+	_, hasMin := tmp["min"]
+	_, hasMax := tmp["max"]
+	if hasMin || hasMax {
+		var rv *NumericRangeQuery
+		err := json.Unmarshal(input, &rv)
+		if err != nil {
+			return nil, err
+		}
+		return rv, nil
+	}
+	_, hasStart := tmp["start"]
+	_, hasEnd := tmp["end"]
+	if hasStart || hasEnd {
+		var rv *DateRangeQuery
+		err := json.Unmarshal(input, &rv)
+		if err != nil {
+			return nil, err
+		}
+		return rv, nil
+	}
+	_, isQueryStringQuery := tmp["query"]
+	if isQueryStringQuery {
+		var rv *QueryStringQuery
+		err := json.Unmarshal(input, &rv)
+		if err != nil {
+			return nil, err
+		}
+		return rv, nil
+	}
 	_, hasMust := tmp["must"]
 	_, hasShould := tmp["should"]
 	_, hasMustNot := tmp["must_not"]
@@ -61,14 +156,359 @@ func (q *TermQuery) GetBoost() float64 {
 	return q.Boost
 }
 
-func (q *TermQuery) Searcher(index index.Index) (Searcher, error) {
-	return NewTermSearcher(index, q)
+func (q *TermQuery) Searcher(ctx context.Context, index index.Index, similarity Similarity) (Searcher, error) {
+	return NewTermSearcher(index, similarity, q)
 }
 
 func (q *TermQuery) Validate() error {
 	return nil
 }
 
+type PhraseQuery struct {
+	Terms   []string `json:"phrase"`
+	Field   string   `json:"field,omitempty"`
+	Boost   float64  `json:"boost,omitempty"`
+	Explain bool     `json:"explain,omitempty"`
+}
+
+func (q *PhraseQuery) GetBoost() float64 {
+	return q.Boost
+}
+
+func (q *PhraseQuery) Searcher(ctx context.Context, index index.Index, similarity Similarity) (Searcher, error) {
+	return NewPhraseSearcher(index, similarity, q)
+}
+
+func (q *PhraseQuery) Validate() error {
+	if len(q.Terms) < 1 {
+		return fmt.Errorf("Phrase query must contain at least one term")
+	}
+	return nil
+}
+
+type SloppyPhraseQuery struct {
+	Terms   []string `json:"phrase"`
+	Field   string   `json:"field,omitempty"`
+	Slop    int      `json:"slop"`
+	Boost   float64  `json:"boost,omitempty"`
+	Explain bool     `json:"explain,omitempty"`
+}
+
+func (q *SloppyPhraseQuery) GetBoost() float64 {
+	return q.Boost
+}
+
+func (q *SloppyPhraseQuery) Searcher(ctx context.Context, index index.Index, similarity Similarity) (Searcher, error) {
+	return NewSloppyPhraseSearcher(index, similarity, q)
+}
+
+func (q *SloppyPhraseQuery) Validate() error {
+	if len(q.Terms) < 1 {
+		return fmt.Errorf("Phrase query must contain at least one term")
+	}
+	if q.Slop < 0 {
+		return fmt.Errorf("Phrase query slop must not be negative")
+	}
+	return nil
+}
+
+// match query operators
+const (
+	MATCH_OR  = "or"
+	MATCH_AND = "and"
+)
+
+// MatchQuery analyzes the input with the analyzer of the field,
+// unlike TermQuery which searches for the input as it is
+type MatchQuery struct {
+	Match              string  `json:"match"`
+	Field              string  `json:"field,omitempty"`
+	Operator           string  `json:"operator,omitempty"`
+	MinimumShouldMatch int     `json:"minimum_should_match,omitempty"`
+	Boost              float64 `json:"boost,omitempty"`
+	Explain            bool    `json:"explain,omitempty"`
+}
+
+func (q *MatchQuery) GetBoost() float64 {
+	return q.Boost
+}
+
+func (q *MatchQuery) Searcher(ctx context.Context, index index.Index, similarity Similarity) (Searcher, error) {
+	return NewMatchSearcher(ctx, index, similarity, q)
+}
+
+func (q *MatchQuery) Validate() error {
+	switch q.Operator {
+	case "", MATCH_OR:
+	case MATCH_AND:
+		if q.MinimumShouldMatch != 0 {
+			return fmt.Errorf("Match query minimum_should_match only applies to the or operator")
+		}
+	default:
+		return fmt.Errorf("Match query operator must be `and` or `or`")
+	}
+	if q.MinimumShouldMatch < 0 {
+		return fmt.Errorf("Match query minimum_should_match must not be negative")
+	}
+	return nil
+}
+
+type PrefixQuery struct {
+	Prefix        string  `json:"prefix"`
+	Field         string  `json:"field,omitempty"`
+	MaxExpansions int     `json:"max_expansions,omitempty"`
+	Boost         float64 `json:"boost,omitempty"`
+	Explain       bool    `json:"explain,omitempty"`
+}
+
+func (q *PrefixQuery) GetBoost() float64 {
+	return q.Boost
+}
+
+func (q *PrefixQuery) Searcher(ctx context.Context, index index.Index, similarity Similarity) (Searcher, error) {
+	return NewPrefixSearcher(ctx, index, similarity, q)
+}
+
+func (q *PrefixQuery) Validate() error {
+	if q.MaxExpansions < 0 {
+		return fmt.Errorf("Prefix query max_expansions must not be negative")
+	}
+	return nil
+}
+
+// NumericRangeQuery matches numeric field values from min to max,
+// a missing bound leaves that side open
+type NumericRangeQuery struct {
+	Min       *float64 `json:"min,omitempty"`
+	Max       *float64 `json:"max,omitempty"`
+	Inclusive *bool    `json:"inclusive,omitempty"`
+	Field     string   `json:"field,omitempty"`
+	Boost     float64  `json:"boost,omitempty"`
+	Explain   bool     `json:"explain,omitempty"`
+}
+
+func (q *NumericRangeQuery) GetBoost() float64 {
+	return q.Boost
+}
+
+func (q *NumericRangeQuery) Searcher(ctx context.Context, index index.Index, similarity Similarity) (Searcher, error) {
+	return NewNumericRangeSearcher(ctx, index, similarity, q)
+}
+
+func (q *NumericRangeQuery) Validate() error {
+	if q.Min == nil && q.Max == nil {
+		return fmt.Errorf("Numeric range query must specify min or max")
+	}
+	if q.Min != nil && q.Max != nil && *q.Min > *q.Max {
+		return fmt.Errorf("Numeric range query min must not be greater than max")
+	}
+	return nil
+}
+
+// inclusive reports whether the bounds themselves match, they do
+// unless the query says otherwise
+func (q *NumericRangeQuery) inclusive() bool {
+	return q.Inclusive == nil || *q.Inclusive
+}
+
+// DateRangeQuery matches datetime field values from start to end,
+// given in RFC3339 or relative to the time of the search as now,
+// optionally followed by offsets like now-7d, a missing bound
+// leaves that side open
+type DateRangeQuery struct {
+	Start     *string `json:"start,omitempty"`
+	End       *string `json:"end,omitempty"`
+	Inclusive *bool   `json:"inclusive,omitempty"`
+	Field     string  `json:"field,omitempty"`
+	Boost     float64 `json:"boost,omitempty"`
+	Explain   bool    `json:"explain,omitempty"`
+}
+
+func (q *DateRangeQuery) GetBoost() float64 {
+	return q.Boost
+}
+
+func (q *DateRangeQuery) Searcher(ctx context.Context, index index.Index, similarity Similarity) (Searcher, error) {
+	return NewDateRangeSearcher(ctx, index, similarity, q)
+}
+
+func (q *DateRangeQuery) Validate() error {
+	if q.Start == nil && q.End == nil {
+		return fmt.Errorf("Date range query must specify start or end")
+	}
+	start, end, err := q.bounds(time.Now())
+	if err != nil {
+		return err
+	}
+	if q.Start != nil && q.End != nil && start.After(end) {
+		return fmt.Errorf("Date range query start must not be after end")
+	}
+	return nil
+}
+
+func (q *DateRangeQuery) inclusive() bool {
+	return q.Inclusive == nil || *q.Inclusive
+}
+
+// bounds resolves the start and end relative to now, the zero
+// time stands in for a missing bound
+func (q *DateRangeQuery) bounds(now time.Time) (start, end time.Time, err error) {
+	if q.Start != nil {
+		start, err = ParseDateTime(*q.Start, now)
+		if err != nil {
+			return
+		}
+	}
+	if q.End != nil {
+		end, err = ParseDateTime(*q.End, now)
+	}
+	return
+}
+
+// QueryStringQuery is written in the query string language, clauses
+// are a term, a "quoted phrase" or a (group) of clauses, optionally
+// prefixed by field: and suffixed by ^boost, a leading + makes a
+// clause required and - excludes the documents matching it
+type QueryStringQuery struct {
+	Query        string  `json:"query"`
+	DefaultField string  `json:"default_field,omitempty"`
+	Boost        float64 `json:"boost,omitempty"`
+	Explain      bool    `json:"explain,omitempty"`
+}
+
+func (q *QueryStringQuery) GetBoost() float64 {
+	return q.Boost
+}
+
+func (q *QueryStringQuery) Searcher(ctx context.Context, index index.Index, similarity Similarity) (Searcher, error) {
+	return NewQueryStringSearcher(ctx, index, similarity, q)
+}
+
+func (q *QueryStringQuery) Validate() error {
+	_, err := parseQueryString(q.Query, q.DefaultField)
+	return err
+}
+
+// compile parses the query string into a boolean query
+func (q *QueryStringQuery) compile(idx index.Index) (*TermBooleanQuery, error) {
+	clauses, err := parseQueryString(q.Query, q.DefaultField)
+	if err != nil {
+		return nil, err
+	}
+	boost := q.Boost
+	if boost == 0 {
+		boost = 1.0
+	}
+	rv, err := compileQueryString(idx, clauses, boost, q.Explain)
+	if err != nil {
+		return nil, err
+	}
+	if rv == nil {
+		return nil, fmt.Errorf("query string `%s` has no terms left to search for once analyzed", q.Query)
+	}
+	return rv, nil
+}
+
+type WildcardQuery struct {
+	Wildcard      string  `json:"wildcard"`
+	Field         string  `json:"field,omitempty"`
+	MaxExpansions int     `json:"max_expansions,omitempty"`
+	Boost         float64 `json:"boost,omitempty"`
+	Explain       bool    `json:"explain,omitempty"`
+}
+
+func (q *WildcardQuery) GetBoost() float64 {
+	return q.Boost
+}
+
+func (q *WildcardQuery) Searcher(ctx context.Context, index index.Index, similarity Similarity) (Searcher, error) {
+	return NewWildcardSearcher(ctx, index, similarity, q)
+}
+
+func (q *WildcardQuery) Validate() error {
+	if q.MaxExpansions < 0 {
+		return fmt.Errorf("Wildcard query max_expansions must not be negative")
+	}
+	return nil
+}
+
+// compile translates the wildcard pattern into a regular expression
+func (q *WildcardQuery) compile() (*regexp.Regexp, error) {
+	expr := "^"
+	for _, r := range q.Wildcard {
+		switch r {
+		case '*':
+			expr += ".*"
+		case '?':
+			expr += "."
+		default:
+			expr += regexp.QuoteMeta(string(r))
+		}
+	}
+	expr += "$"
+	return regexp.Compile(expr)
+}
+
+type RegexpQuery struct {
+	Regexp        string  `json:"regexp"`
+	Field         string  `json:"field,omitempty"`
+	MaxExpansions int     `json:"max_expansions,omitempty"`
+	Boost         float64 `json:"boost,omitempty"`
+	Explain       bool    `json:"explain,omitempty"`
+}
+
+func (q *RegexpQuery) GetBoost() float64 {
+	return q.Boost
+}
+
+func (q *RegexpQuery) Searcher(ctx context.Context, index index.Index, similarity Similarity) (Searcher, error) {
+	return NewRegexpSearcher(ctx, index, similarity, q)
+}
+
+func (q *RegexpQuery) Validate() error {
+	if q.MaxExpansions < 0 {
+		return fmt.Errorf("Regexp query max_expansions must not be negative")
+	}
+	_, err := q.compile()
+	return err
+}
+
+// compile anchors the expression so that it matches whole terms
+func (q *RegexpQuery) compile() (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + q.Regexp + ")$")
+}
+
+type FuzzyQuery struct {
+	Term          string  `json:"fuzzy"`
+	Field         string  `json:"field,omitempty"`
+	Fuzziness     int     `json:"fuzziness"`
+	PrefixLength  int     `json:"prefix_length,omitempty"`
+	MaxExpansions int     `json:"max_expansions,omitempty"`
+	Boost         float64 `json:"boost,omitempty"`
+	Explain       bool    `json:"explain,omitempty"`
+}
+
+func (q *FuzzyQuery) GetBoost() float64 {
+	return q.Boost
+}
+
+func (q *FuzzyQuery) Searcher(ctx context.Context, index index.Index, similarity Similarity) (Searcher, error) {
+	return NewFuzzySearcher(ctx, index, similarity, q)
+}
+
+func (q *FuzzyQuery) Validate() error {
+	if q.Fuzziness < 0 || q.Fuzziness > MAX_FUZZINESS {
+		return fmt.Errorf("Fuzzy query fuzziness must be between 0 and %d", MAX_FUZZINESS)
+	}
+	if q.PrefixLength < 0 {
+		return fmt.Errorf("Fuzzy query prefix_length must not be negative")
+	}
+	if q.MaxExpansions < 0 {
+		return fmt.Errorf("Fuzzy query max_expansions must not be negative")
+	}
+	return nil
+}
+
 type TermConjunctionQuery struct {
 	Terms   []Query `json:"terms"`
 	Boost   float64 `json:"boost"`
@@ -104,8 +544,8 @@ func (q *TermConjunctionQuery) GetBoost() float64 {
 	return q.Boost
 }
 
-func (q *TermConjunctionQuery) Searcher(index index.Index) (Searcher, error) {
-	return NewTermConjunctionSearcher(index, q)
+func (q *TermConjunctionQuery) Searcher(ctx context.Context, index index.Index, similarity Similarity) (Searcher, error) {
+	return NewTermConjunctionSearcher(ctx, index, similarity, q)
 }
 
 func (q *TermConjunctionQuery) Validate() error {
@@ -150,8 +590,8 @@ func (q *TermDisjunctionQuery) GetBoost() float64 {
 	return q.Boost
 }
 
-func (q *TermDisjunctionQuery) Searcher(index index.Index) (Searcher, error) {
-	return NewTermDisjunctionSearcher(index, q)
+func (q *TermDisjunctionQuery) Searcher(ctx context.Context, index index.Index, similarity Similarity) (Searcher, error) {
+	return NewTermDisjunctionSearcher(ctx, index, similarity, q)
 }
 
 func (q *TermDisjunctionQuery) Validate() error {
@@ -173,8 +613,8 @@ func (q *TermBooleanQuery) GetBoost() float64 {
 	return q.Boost
 }
 
-func (q *TermBooleanQuery) Searcher(index index.Index) (Searcher, error) {
-	return NewTermBooleanSearcher(index, q)
+func (q *TermBooleanQuery) Searcher(ctx context.Context, index index.Index, similarity Similarity) (Searcher, error) {
+	return NewTermBooleanSearcher(ctx, index, similarity, q)
 }
 
 func (q *TermBooleanQuery) Validate() error {
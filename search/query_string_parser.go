@@ -0,0 +1,332 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package search
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// QueryStringSyntaxError reports where in the query string parsing
+// failed, Pos is a byte offset into the query string
+type QueryStringSyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *QueryStringSyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at position %d: %s", e.Pos, e.Msg)
+}
+
+func queryStringErrorf(pos int, format string, args ...interface{}) error {
+	return &QueryStringSyntaxError{
+		Pos: pos,
+		Msg: fmt.Sprintf(format, args...),
+	}
+}
+
+type queryStringTokenType int
+
+const (
+	qsEOF queryStringTokenType = iota
+	qsTerm
+	qsPhrase
+	qsPlus
+	qsMinus
+	qsColon
+	qsCaret
+	qsLParen
+	qsRParen
+)
+
+func (t queryStringTokenType) String() string {
+	switch t {
+	case qsEOF:
+		return "end of query"
+	case qsTerm:
+		return "term"
+	case qsPhrase:
+		return "phrase"
+	case qsPlus:
+		return "+"
+	case qsMinus:
+		return "-"
+	case qsColon:
+		return ":"
+	case qsCaret:
+		return "^"
+	case qsLParen:
+		return "("
+	case qsRParen:
+		return ")"
+	}
+	return "unknown"
+}
+
+type queryStringToken struct {
+	typ   queryStringTokenType
+	value string
+	pos   int
+}
+
+// queryStringLexer splits a query string into tokens, a backslash
+// escapes the character following it in terms and phrases
+type queryStringLexer struct {
+	input string
+	pos   int
+	prev  queryStringTokenType
+}
+
+func isQueryStringSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func isQueryStringSpecial(c byte) bool {
+	return isQueryStringSpace(c) || c == ':' || c == '^' || c == '(' || c == ')' || c == '"'
+}
+
+func (l *queryStringLexer) next() (queryStringToken, error) {
+	for l.pos < len(l.input) && isQueryStringSpace(l.input[l.pos]) {
+		l.pos++
+	}
+	tok, err := l.lex()
+	if err == nil {
+		l.prev = tok.typ
+	}
+	return tok, err
+}
+
+func (l *queryStringLexer) lex() (queryStringToken, error) {
+	start := l.pos
+	if start >= len(l.input) {
+		return queryStringToken{typ: qsEOF, pos: start}, nil
+	}
+
+	switch l.input[start] {
+	case ':':
+		l.pos++
+		return queryStringToken{typ: qsColon, pos: start}, nil
+	case '^':
+		l.pos++
+		return queryStringToken{typ: qsCaret, pos: start}, nil
+	case '(':
+		l.pos++
+		return queryStringToken{typ: qsLParen, pos: start}, nil
+	case ')':
+		l.pos++
+		return queryStringToken{typ: qsRParen, pos: start}, nil
+	case '"':
+		return l.lexPhrase()
+	case '+', '-':
+		// operators only start a clause, field:-1 is a negative number
+		if l.prev != qsColon && l.prev != qsCaret {
+			l.pos++
+			if l.input[start] == '+' {
+				return queryStringToken{typ: qsPlus, pos: start}, nil
+			}
+			return queryStringToken{typ: qsMinus, pos: start}, nil
+		}
+	}
+	return l.lexTerm()
+}
+
+func (l *queryStringLexer) lexTerm() (queryStringToken, error) {
+	start := l.pos
+	value := make([]byte, 0)
+	for l.pos < len(l.input) && !isQueryStringSpecial(l.input[l.pos]) {
+		if l.input[l.pos] == '\\' {
+			l.pos++
+			if l.pos >= len(l.input) {
+				return queryStringToken{}, queryStringErrorf(l.pos-1, "escape character at end of query")
+			}
+		}
+		value = append(value, l.input[l.pos])
+		l.pos++
+	}
+	return queryStringToken{typ: qsTerm, value: string(value), pos: start}, nil
+}
+
+func (l *queryStringLexer) lexPhrase() (queryStringToken, error) {
+	start := l.pos
+	l.pos++ // opening quote
+	value := make([]byte, 0)
+	for l.pos < len(l.input) && l.input[l.pos] != '"' {
+		if l.input[l.pos] == '\\' && l.pos+1 < len(l.input) {
+			l.pos++
+		}
+		value = append(value, l.input[l.pos])
+		l.pos++
+	}
+	if l.pos >= len(l.input) {
+		return queryStringToken{}, queryStringErrorf(start, "unterminated phrase")
+	}
+	l.pos++ // closing quote
+	return queryStringToken{typ: qsPhrase, value: string(value), pos: start}, nil
+}
+
+type queryStringOccur int
+
+const (
+	qsShould queryStringOccur = iota
+	qsMust
+	qsMustNot
+)
+
+// queryStringClause is a term, phrase or parenthesized group of
+// clauses, each with the field it searches resolved
+type queryStringClause struct {
+	occur  queryStringOccur
+	field  string
+	text   string
+	phrase bool
+	group  []*queryStringClause
+	boost  float64
+	pos    int
+}
+
+type queryStringParser struct {
+	lexer *queryStringLexer
+	tok   queryStringToken
+}
+
+// parseQueryString parses the query string, clauses without a
+// field search defaultField
+func parseQueryString(input, defaultField string) ([]*queryStringClause, error) {
+	p := queryStringParser{
+		lexer: &queryStringLexer{input: input},
+	}
+	err := p.advance()
+	if err != nil {
+		return nil, err
+	}
+	rv, err := p.parseClauses(defaultField)
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.typ != qsEOF {
+		return nil, queryStringErrorf(p.tok.pos, "unexpected %v", p.tok.typ)
+	}
+	if len(rv) == 0 {
+		return nil, queryStringErrorf(0, "empty query")
+	}
+	return rv, nil
+}
+
+func (p *queryStringParser) advance() error {
+	var err error
+	p.tok, err = p.lexer.next()
+	return err
+}
+
+func (p *queryStringParser) parseClauses(defaultField string) ([]*queryStringClause, error) {
+	rv := make([]*queryStringClause, 0)
+	for p.tok.typ != qsEOF && p.tok.typ != qsRParen {
+		clause, err := p.parseClause(defaultField)
+		if err != nil {
+			return nil, err
+		}
+		rv = append(rv, clause)
+	}
+	return rv, nil
+}
+
+func (p *queryStringParser) parseClause(defaultField string) (*queryStringClause, error) {
+	rv := queryStringClause{
+		occur: qsShould,
+		field: defaultField,
+		boost: 1.0,
+		pos:   p.tok.pos,
+	}
+
+	switch p.tok.typ {
+	case qsPlus:
+		rv.occur = qsMust
+	case qsMinus:
+		rv.occur = qsMustNot
+	}
+	if rv.occur != qsShould {
+		err := p.advance()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if p.tok.typ == qsTerm {
+		term := p.tok
+		err := p.advance()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.typ != qsColon {
+			rv.text = term.value
+			return p.parseBoost(&rv)
+		}
+		if term.value == "" {
+			return nil, queryStringErrorf(term.pos, "empty field name")
+		}
+		rv.field = term.value
+		err = p.advance()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch p.tok.typ {
+	case qsTerm:
+		rv.text = p.tok.value
+	case qsPhrase:
+		rv.text = p.tok.value
+		rv.phrase = true
+	case qsLParen:
+		open := p.tok.pos
+		err := p.advance()
+		if err != nil {
+			return nil, err
+		}
+		rv.group, err = p.parseClauses(rv.field)
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.typ != qsRParen {
+			return nil, queryStringErrorf(open, "unclosed (")
+		}
+		if len(rv.group) == 0 {
+			return nil, queryStringErrorf(open, "empty group")
+		}
+	default:
+		return nil, queryStringErrorf(p.tok.pos, "expected a term, phrase or group, found %v", p.tok.typ)
+	}
+	err := p.advance()
+	if err != nil {
+		return nil, err
+	}
+	return p.parseBoost(&rv)
+}
+
+func (p *queryStringParser) parseBoost(clause *queryStringClause) (*queryStringClause, error) {
+	if clause.group == nil && clause.field == "" {
+		return nil, queryStringErrorf(clause.pos, "no field for `%s` and no default field", clause.text)
+	}
+	if p.tok.typ != qsCaret {
+		return clause, nil
+	}
+	err := p.advance()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.typ != qsTerm {
+		return nil, queryStringErrorf(p.tok.pos, "expected a boost, found %v", p.tok.typ)
+	}
+	boost, err := strconv.ParseFloat(p.tok.value, 64)
+	if err != nil || boost <= 0 {
+		return nil, queryStringErrorf(p.tok.pos, "boost `%s` is not a positive number", p.tok.value)
+	}
+	clause.boost = boost
+	return clause, p.advance()
+}
@@ -0,0 +1,110 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseQueryString(t *testing.T) {
+	tests := []struct {
+		input        string
+		defaultField string
+		clauses      []*queryStringClause
+	}{
+		{
+			input:        "beer",
+			defaultField: "desc",
+			clauses: []*queryStringClause{
+				&queryStringClause{occur: qsShould, field: "desc", text: "beer", boost: 1.0, pos: 0},
+			},
+		},
+		{
+			input: `+title:couchbase -status:deleted body:"full text"^2`,
+			clauses: []*queryStringClause{
+				&queryStringClause{occur: qsMust, field: "title", text: "couchbase", boost: 1.0, pos: 0},
+				&queryStringClause{occur: qsMustNot, field: "status", text: "deleted", boost: 1.0, pos: 17},
+				&queryStringClause{occur: qsShould, field: "body", text: "full text", phrase: true, boost: 2.0, pos: 33},
+			},
+		},
+		{
+			input:        `name:(marty dustin)^1.5 -e-mail`,
+			defaultField: "desc",
+			clauses: []*queryStringClause{
+				&queryStringClause{
+					occur: qsShould,
+					field: "name",
+					group: []*queryStringClause{
+						&queryStringClause{occur: qsShould, field: "name", text: "marty", boost: 1.0, pos: 6},
+						&queryStringClause{occur: qsShould, field: "name", text: "dustin", boost: 1.0, pos: 12},
+					},
+					boost: 1.5,
+					pos:   0,
+				},
+				&queryStringClause{occur: qsMustNot, field: "desc", text: "e-mail", boost: 1.0, pos: 24},
+			},
+		},
+		{
+			input:        `abv:-1 title:a\:b "say \"hi\""`,
+			defaultField: "desc",
+			clauses: []*queryStringClause{
+				&queryStringClause{occur: qsShould, field: "abv", text: "-1", boost: 1.0, pos: 0},
+				&queryStringClause{occur: qsShould, field: "title", text: "a:b", boost: 1.0, pos: 7},
+				&queryStringClause{occur: qsShould, field: "desc", text: `say "hi"`, phrase: true, boost: 1.0, pos: 18},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		clauses, err := parseQueryString(test.input, test.defaultField)
+		if err != nil {
+			t.Errorf("unexpected error: %v for %s", err, test.input)
+			continue
+		}
+		if !reflect.DeepEqual(clauses, test.clauses) {
+			t.Errorf("expected %v got %v for %s", test.clauses, clauses, test.input)
+		}
+	}
+}
+
+func TestParseQueryStringErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		pos   int
+	}{
+		{input: "", pos: 0},
+		{input: "beer", pos: 0},
+		{input: `desc:"beer`, pos: 5},
+		{input: "desc:beer)", pos: 9},
+		{input: "desc:(beer", pos: 5},
+		{input: "desc:()", pos: 5},
+		{input: "desc:beer^", pos: 10},
+		{input: "desc:beer^big", pos: 10},
+		{input: "desc:beer +", pos: 11},
+		{input: "desc:beer :", pos: 10},
+		{input: `desc:beer\`, pos: 9},
+	}
+
+	for _, test := range tests {
+		_, err := parseQueryString(test.input, "")
+		if err == nil {
+			t.Errorf("expected error for `%s`", test.input)
+			continue
+		}
+		syntaxErr, ok := err.(*QueryStringSyntaxError)
+		if !ok {
+			t.Errorf("expected a syntax error for `%s`, got %v", test.input, err)
+			continue
+		}
+		if syntaxErr.Pos != test.pos {
+			t.Errorf("expected error at %d got %d (%v) for `%s`", test.pos, syntaxErr.Pos, syntaxErr, test.input)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package search
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/couchbaselabs/cbfullofit/index"
+)
+
+// NewQueryStringSearcher parses the query string and searches the
+// query it compiles to
+func NewQueryStringSearcher(ctx context.Context, index index.Index, similarity Similarity, query *QueryStringQuery) (Searcher, error) {
+	compiled, err := query.compile(index)
+	if err != nil {
+		return nil, err
+	}
+	return compiled.Searcher(ctx, index, similarity)
+}
+
+// compileQueryString turns the clauses into a boolean query, running
+// each term through its field's analyzer, nil if no term is left,
+// compound queries ignore their boost so it is applied to the terms
+func compileQueryString(idx index.Index, clauses []*queryStringClause, boost float64, explain bool) (*TermBooleanQuery, error) {
+	must := make([]Query, 0)
+	should := make([]Query, 0)
+	mustNot := make([]Query, 0)
+
+	for _, clause := range clauses {
+		var query Query
+		if clause.group != nil {
+			group, err := compileQueryString(idx, clause.group, boost*clause.boost, explain)
+			if err != nil {
+				return nil, err
+			}
+			if group == nil {
+				continue
+			}
+			query = group
+		} else {
+			var err error
+			query, err = compileQueryStringClause(idx, clause, boost*clause.boost, explain)
+			if err != nil {
+				return nil, err
+			}
+			if query == nil {
+				continue
+			}
+		}
+
+		switch clause.occur {
+		case qsMust:
+			must = append(must, query)
+		case qsMustNot:
+			mustNot = append(mustNot, query)
+		default:
+			should = append(should, query)
+		}
+	}
+
+	if len(must) == 0 && len(should) == 0 {
+		return nil, nil
+	}
+	rv := TermBooleanQuery{
+		Boost:   1.0,
+		Explain: explain,
+	}
+	if len(must) > 0 {
+		rv.Must = &TermConjunctionQuery{
+			Terms:   must,
+			Boost:   1.0,
+			Explain: explain,
+		}
+	}
+	if len(should) > 0 {
+		rv.Should = &TermDisjunctionQuery{
+			Terms:   should,
+			Boost:   1.0,
+			Explain: explain,
+		}
+	}
+	if len(mustNot) > 0 {
+		rv.MustNot = &TermDisjunctionQuery{
+			Terms:   mustNot,
+			Boost:   1.0,
+			Explain: explain,
+		}
+	}
+	return &rv, nil
+}
+
+// compileQueryStringClause builds the query for a term or phrase,
+// nil if the analyzer drops all of it
+func compileQueryStringClause(idx index.Index, clause *queryStringClause, boost float64, explain bool) (Query, error) {
+	field := schemaField(idx, clause.field)
+	if field == nil {
+		return nil, queryStringErrorf(clause.pos, "no field named `%s` in the schema", clause.field)
+	}
+
+	switch field.Type {
+	case index.NUMERIC_FIELD:
+		value, err := strconv.ParseFloat(clause.text, 64)
+		if err != nil {
+			return nil, queryStringErrorf(clause.pos, "`%s` is not a number for numeric field `%s`", clause.text, field.Name)
+		}
+		return &NumericRangeQuery{
+			Min:     &value,
+			Max:     &value,
+			Field:   field.Name,
+			Boost:   boost,
+			Explain: explain,
+		}, nil
+	case index.DATETIME_FIELD:
+		value := clause.text
+		_, err := ParseDateTime(value, time.Now())
+		if err != nil {
+			return nil, queryStringErrorf(clause.pos, "%v for datetime field `%s`", err, field.Name)
+		}
+		return &DateRangeQuery{
+			Start:   &value,
+			End:     &value,
+			Field:   field.Name,
+			Boost:   boost,
+			Explain: explain,
+		}, nil
+	}
+
+	analyzer, err := field.NewAnalyzer()
+	if err != nil {
+		return nil, fmt.Errorf("field `%s`: %v", field.Name, err)
+	}
+	tokens := analyzer.Analyze([]byte(clause.text))
+	switch len(tokens) {
+	case 0:
+		return nil, nil
+	case 1:
+		return &TermQuery{
+			Term:    string(tokens[0].Term),
+			Field:   field.Name,
+			Boost:   boost,
+			Explain: explain,
+		}, nil
+	}
+	// a phrase, or a term the analyzer split into several
+	terms := make([]string, len(tokens))
+	for i, token := range tokens {
+		terms[i] = string(token.Term)
+	}
+	return &PhraseQuery{
+		Terms:   terms,
+		Field:   field.Name,
+		Boost:   boost,
+		Explain: explain,
+	}, nil
+}
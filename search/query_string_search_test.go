@@ -0,0 +1,160 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package search
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestQueryStringCompile(t *testing.T) {
+	tests := []struct {
+		query  *QueryStringQuery
+		output *TermBooleanQuery
+	}{
+		{
+			// analyzed with the standard analyzer, the stop word is dropped
+			query: &QueryStringQuery{
+				Query:        "+Beer the name:(Marty dustin)^2",
+				DefaultField: "desc",
+			},
+			output: &TermBooleanQuery{
+				Must: &TermConjunctionQuery{
+					Terms: []Query{
+						&TermQuery{Term: "beer", Field: "desc", Boost: 1.0},
+					},
+					Boost: 1.0,
+				},
+				Should: &TermDisjunctionQuery{
+					Terms: []Query{
+						&TermBooleanQuery{
+							Should: &TermDisjunctionQuery{
+								Terms: []Query{
+									&TermQuery{Term: "marty", Field: "name", Boost: 2.0},
+									&TermQuery{Term: "dustin", Field: "name", Boost: 2.0},
+								},
+								Boost: 1.0,
+							},
+							Boost: 1.0,
+						},
+					},
+					Boost: 1.0,
+				},
+				Boost: 1.0,
+			},
+		},
+		{
+			query: &QueryStringQuery{
+				Query:   `desc:"couch database"^3 -name:steve`,
+				Boost:   2.0,
+				Explain: true,
+			},
+			output: &TermBooleanQuery{
+				Should: &TermDisjunctionQuery{
+					Terms: []Query{
+						&PhraseQuery{Terms: []string{"couch", "database"}, Field: "desc", Boost: 6.0, Explain: true},
+					},
+					Boost:   1.0,
+					Explain: true,
+				},
+				MustNot: &TermDisjunctionQuery{
+					Terms: []Query{
+						&TermQuery{Term: "steve", Field: "name", Boost: 2.0, Explain: true},
+					},
+					Boost:   1.0,
+					Explain: true,
+				},
+				Boost:   1.0,
+				Explain: true,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		actual, err := test.query.compile(twoDocIndex)
+		if err != nil {
+			t.Errorf("unexpected error: %v for %s", err, test.query.Query)
+			continue
+		}
+		if !reflect.DeepEqual(actual, test.output) {
+			t.Errorf("expected %#v got %#v for %s", test.output, actual, test.query.Query)
+		}
+	}
+}
+
+func TestQueryStringSearch(t *testing.T) {
+	tests := []struct {
+		query *QueryStringQuery
+		ids   []string
+		err   bool
+	}{
+		{
+			query: &QueryStringQuery{
+				Query:        "+beer -name:steve name:marty name:dustin",
+				DefaultField: "desc",
+			},
+			ids: []string{"1", "3", "4"},
+		},
+		{
+			query: &QueryStringQuery{
+				Query:        "COUCH water",
+				DefaultField: "desc",
+			},
+			ids: []string{"2", "5"},
+		},
+		{
+			query: &QueryStringQuery{
+				Query:        "+beer +(name:dustin name:steve)",
+				DefaultField: "desc",
+			},
+			ids: []string{"2", "3"},
+		},
+		{
+			query: &QueryStringQuery{
+				Query:        "the",
+				DefaultField: "desc",
+			},
+			err: true,
+		},
+		{
+			query: &QueryStringQuery{
+				Query: "nope:beer",
+			},
+			err: true,
+		},
+	}
+
+	for testIndex, test := range tests {
+		searcher, err := test.query.Searcher(context.Background(), twoDocIndex, DefaultSimilarity)
+		if test.err {
+			if err == nil {
+				t.Errorf("expected error for test %d", testIndex)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v for test %d", err, testIndex)
+		}
+
+		ids := make([]string, 0)
+		next, err := searcher.Next(context.Background())
+		for err == nil && next != nil {
+			ids = append(ids, next.ID)
+			next, err = searcher.Next(context.Background())
+		}
+		searcher.Close()
+		if err != nil {
+			t.Fatalf("error iterating searcher: %v for test %d", err, testIndex)
+		}
+		if !reflect.DeepEqual(ids, test.ids) {
+			t.Errorf("expected ids %v got %v for test %d", test.ids, ids, testIndex)
+		}
+	}
+}
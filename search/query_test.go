@@ -15,6 +15,12 @@ import (
 )
 
 func TestParseQuery(t *testing.T) {
+	five := 5.0
+	sevenAndAHalf := 7.5
+	exclusive := false
+	weekAgo := "now-7d"
+	christmas := "2013-12-25T00:00:00Z"
+
 	tests := []struct {
 		input []byte
 		query Query
@@ -72,6 +78,94 @@ func TestParseQuery(t *testing.T) {
 				Explain: true,
 			},
 		},
+		{
+			input: []byte(`{"phrase":["couch","database"],"field":"desc","boost":1.0}`),
+			query: &PhraseQuery{
+				Terms: []string{"couch", "database"},
+				Field: "desc",
+				Boost: 1.0,
+			},
+		},
+		{
+			input: []byte(`{"phrase":["couch","database"],"field":"desc","slop":2,"boost":1.0}`),
+			query: &SloppyPhraseQuery{
+				Terms: []string{"couch", "database"},
+				Field: "desc",
+				Slop:  2,
+				Boost: 1.0,
+			},
+		},
+		{
+			input: []byte(`{"fuzzy":"cuoch","field":"desc","fuzziness":2,"prefix_length":1,"boost":1.0}`),
+			query: &FuzzyQuery{
+				Term:         "cuoch",
+				Field:        "desc",
+				Fuzziness:    2,
+				PrefixLength: 1,
+				Boost:        1.0,
+			},
+		},
+		{
+			input: []byte(`{"prefix":"cou","field":"desc","max_expansions":10,"boost":1.0}`),
+			query: &PrefixQuery{
+				Prefix:        "cou",
+				Field:         "desc",
+				MaxExpansions: 10,
+				Boost:         1.0,
+			},
+		},
+		{
+			input: []byte(`{"min":5,"max":7.5,"inclusive":false,"field":"abv","boost":1.0}`),
+			query: &NumericRangeQuery{
+				Min:       &five,
+				Max:       &sevenAndAHalf,
+				Inclusive: &exclusive,
+				Field:     "abv",
+				Boost:     1.0,
+			},
+		},
+		{
+			input: []byte(`{"start":"now-7d","end":"2013-12-25T00:00:00Z","field":"created","boost":1.0}`),
+			query: &DateRangeQuery{
+				Start: &weekAgo,
+				End:   &christmas,
+				Field: "created",
+				Boost: 1.0,
+			},
+		},
+		{
+			input: []byte(`{"query":"+beer -name:steve","default_field":"desc","boost":1.0}`),
+			query: &QueryStringQuery{
+				Query:        "+beer -name:steve",
+				DefaultField: "desc",
+				Boost:        1.0,
+			},
+		},
+		{
+			input: []byte(`{"match":"Couch Database","field":"desc","operator":"and","boost":1.0}`),
+			query: &MatchQuery{
+				Match:    "Couch Database",
+				Field:    "desc",
+				Operator: MATCH_AND,
+				Boost:    1.0,
+			},
+		},
+		{
+			input: []byte(`{"wildcard":"c?u*","field":"desc","boost":1.0}`),
+			query: &WildcardQuery{
+				Wildcard: "c?u*",
+				Field:    "desc",
+				Boost:    1.0,
+			},
+		},
+		{
+			input: []byte(`{"regexp":"co[ul].*","field":"desc","boost":1.0}`),
+			query: &RegexpQuery{
+				Regexp: "co[ul].*",
+				Field:  "desc",
+				Boost:  1.0,
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -0,0 +1,188 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package search
+
+import (
+	"time"
+
+	"github.com/couchbaselabs/cbfullofit/index"
+	"github.com/couchbaselabs/cbfullofit/numeric"
+)
+
+// NumericRangeFacet counts the values from Min up to but excluding
+// Max, a missing bound leaves that side open
+type NumericRangeFacet struct {
+	Name  string   `json:"name"`
+	Min   *float64 `json:"min,omitempty"`
+	Max   *float64 `json:"max,omitempty"`
+	Count int      `json:"count"`
+}
+
+// DateRangeFacet counts the datetimes from Start up to but excluding
+// End, a missing bound leaves that side open
+type DateRangeFacet struct {
+	Name  string  `json:"name"`
+	Start *string `json:"start,omitempty"`
+	End   *string `json:"end,omitempty"`
+	Count int     `json:"count"`
+}
+
+// NumericRangeFacetBuilder counts the values of a numeric field
+// falling in each range, ranges may overlap
+type NumericRangeFacetBuilder struct {
+	field   string
+	ranges  []*NumericRangeFacet
+	total   int
+	missing int
+	other   int
+}
+
+func NewNumericRangeFacetBuilder(field string) *NumericRangeFacetBuilder {
+	return &NumericRangeFacetBuilder{
+		field:  field,
+		ranges: make([]*NumericRangeFacet, 0),
+	}
+}
+
+func (fb *NumericRangeFacetBuilder) AddRange(name string, min, max *float64) {
+	fb.ranges = append(fb.ranges, &NumericRangeFacet{
+		Name: name,
+		Min:  min,
+		Max:  max,
+	})
+}
+
+func (fb *NumericRangeFacetBuilder) Update(fieldTerms index.FieldTerms) {
+	values := prefixCodedValues(fieldTerms[fb.field])
+	if len(values) == 0 {
+		fb.missing++
+		return
+	}
+	for _, value := range values {
+		f := numeric.Int64ToFloat64(value)
+		fb.total++
+		counted := false
+		for _, r := range fb.ranges {
+			if (r.Min == nil || f >= *r.Min) && (r.Max == nil || f < *r.Max) {
+				r.Count++
+				counted = true
+			}
+		}
+		if !counted {
+			fb.other++
+		}
+	}
+}
+
+func (fb *NumericRangeFacetBuilder) Result() *FacetResult {
+	return &FacetResult{
+		Field:         fb.field,
+		Total:         fb.total,
+		Missing:       fb.missing,
+		Other:         fb.other,
+		NumericRanges: fb.ranges,
+	}
+}
+
+type dateRange struct {
+	start *time.Time
+	end   *time.Time
+	facet *DateRangeFacet
+}
+
+// DateRangeFacetBuilder counts the datetimes of a datetime field
+// falling in each range, ranges may overlap
+type DateRangeFacetBuilder struct {
+	field   string
+	ranges  []*dateRange
+	total   int
+	missing int
+	other   int
+}
+
+func NewDateRangeFacetBuilder(field string) *DateRangeFacetBuilder {
+	return &DateRangeFacetBuilder{
+		field:  field,
+		ranges: make([]*dateRange, 0),
+	}
+}
+
+func (fb *DateRangeFacetBuilder) AddRange(name string, start, end *time.Time) {
+	facet := DateRangeFacet{
+		Name: name,
+	}
+	if start != nil {
+		formatted := start.Format(time.RFC3339Nano)
+		facet.Start = &formatted
+	}
+	if end != nil {
+		formatted := end.Format(time.RFC3339Nano)
+		facet.End = &formatted
+	}
+	fb.ranges = append(fb.ranges, &dateRange{
+		start: start,
+		end:   end,
+		facet: &facet,
+	})
+}
+
+func (fb *DateRangeFacetBuilder) Update(fieldTerms index.FieldTerms) {
+	values := prefixCodedValues(fieldTerms[fb.field])
+	if len(values) == 0 {
+		fb.missing++
+		return
+	}
+	for _, value := range values {
+		// datetimes are indexed as nanoseconds since the epoch
+		t := time.Unix(0, value)
+		fb.total++
+		counted := false
+		for _, r := range fb.ranges {
+			if (r.start == nil || !t.Before(*r.start)) && (r.end == nil || t.Before(*r.end)) {
+				r.facet.Count++
+				counted = true
+			}
+		}
+		if !counted {
+			fb.other++
+		}
+	}
+}
+
+func (fb *DateRangeFacetBuilder) Result() *FacetResult {
+	rv := FacetResult{
+		Field:      fb.field,
+		Total:      fb.total,
+		Missing:    fb.missing,
+		Other:      fb.other,
+		DateRanges: make([]*DateRangeFacet, len(fb.ranges)),
+	}
+	for i, r := range fb.ranges {
+		rv.DateRanges[i] = r.facet
+	}
+	return &rv
+}
+
+// prefixCodedValues decodes the full precision values among the
+// prefix coded terms of a numeric or datetime field
+func prefixCodedValues(terms []string) []int64 {
+	rv := make([]int64, 0)
+	for _, term := range terms {
+		prefixCoded := numeric.PrefixCoded(term)
+		shift, err := prefixCoded.Shift()
+		if err != nil || shift != 0 {
+			continue
+		}
+		value, err := prefixCoded.Int64()
+		if err == nil {
+			rv = append(rv, value)
+		}
+	}
+	return rv
+}
@@ -0,0 +1,134 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package search
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/couchbaselabs/cbfullofit/index"
+	"github.com/couchbaselabs/cbfullofit/index/mock"
+)
+
+func TestRangeFacets(t *testing.T) {
+	now := time.Now()
+	facetIndex := mock.NewMockIndexWithDocs([]*index.Field{
+		&index.Field{
+			Name:     "name",
+			Path:     "/name",
+			Analyzer: "standard",
+		},
+		&index.Field{
+			Name: "price",
+			Path: "/price",
+			Type: index.NUMERIC_FIELD,
+		},
+		&index.Field{
+			Name: "created",
+			Path: "/created",
+			Type: index.DATETIME_FIELD,
+		},
+	}, map[string]interface{}{
+		"1": map[string]interface{}{
+			"name":    "cheap beer",
+			"price":   4.5,
+			"created": now.Add(-time.Hour).Format(time.RFC3339Nano),
+		},
+		"2": map[string]interface{}{
+			"name":    "craft beer",
+			"price":   10,
+			"created": now.AddDate(0, 0, -3).Format(time.RFC3339Nano),
+		},
+		"3": map[string]interface{}{
+			"name":    "rare beer",
+			"price":   120,
+			"created": now.AddDate(-1, 0, 0).Format(time.RFC3339Nano),
+		},
+		"4": map[string]interface{}{
+			"name":  "free beer",
+			"price": -1,
+		},
+		"5": map[string]interface{}{
+			"name": "mystery beer",
+		},
+		"6": map[string]interface{}{
+			"name":  "wine",
+			"price": 20,
+		},
+	})
+
+	zero := 0.0
+	ten := 10.0
+	fifty := 50.0
+	prices := NewNumericRangeFacetBuilder("price")
+	prices.AddRange("0-10", &zero, &ten)
+	prices.AddRange("10-50", &ten, &fifty)
+	prices.AddRange("50+", &fifty, nil)
+
+	dayAgo := now.AddDate(0, 0, -1)
+	weekAgo := now.AddDate(0, 0, -7)
+	created := NewDateRangeFacetBuilder("created")
+	created.AddRange("last 24h", &dayAgo, nil)
+	created.AddRange("last week", &weekAgo, nil)
+	created.AddRange("older", nil, &weekAgo)
+
+	collector := NewFacetsCollector(NewTopScorerCollector(10), facetIndex)
+	collector.AddFacet("prices", prices)
+	collector.AddFacet("created", created)
+	searcher, err := NewTermSearcher(facetIndex, DefaultSimilarity, &TermQuery{
+		Term:  "beer",
+		Field: "name",
+		Boost: 1.0,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer searcher.Close()
+
+	err = collector.Collect(context.Background(), searcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dayAgoString := dayAgo.Format(time.RFC3339Nano)
+	weekAgoString := weekAgo.Format(time.RFC3339Nano)
+	expected := FacetResults{
+		"prices": &FacetResult{
+			Field:   "price",
+			Total:   4,
+			Missing: 1,
+			Other:   1,
+			NumericRanges: []*NumericRangeFacet{
+				&NumericRangeFacet{Name: "0-10", Min: &zero, Max: &ten, Count: 1},
+				&NumericRangeFacet{Name: "10-50", Min: &ten, Max: &fifty, Count: 1},
+				&NumericRangeFacet{Name: "50+", Min: &fifty, Count: 1},
+			},
+		},
+		"created": &FacetResult{
+			Field:   "created",
+			Total:   3,
+			Missing: 2,
+			Other:   0,
+			DateRanges: []*DateRangeFacet{
+				&DateRangeFacet{Name: "last 24h", Start: &dayAgoString, Count: 1},
+				&DateRangeFacet{Name: "last week", Start: &weekAgoString, Count: 2},
+				&DateRangeFacet{Name: "older", End: &weekAgoString, Count: 1},
+			},
+		},
+	}
+	actual := collector.FacetResults()
+	if !reflect.DeepEqual(actual, expected) {
+		for name, result := range actual {
+			t.Logf("%s: %#v", name, result)
+		}
+		t.Errorf("expected %v got %v", expected, actual)
+	}
+}
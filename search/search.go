@@ -8,23 +8,97 @@
 //  and limitations under the License.
 package search
 
+import (
+	"context"
+	"github.com/couchbaselabs/cbfullofit/index"
+)
+
+type Location struct {
+	Pos   uint64 `json:"pos"`
+	Start uint64 `json:"start"`
+	End   uint64 `json:"end"`
+}
+
+type Locations []*Location
+
+type TermLocationMap map[string]Locations
+
+type FieldTermLocationMap map[string]TermLocationMap
+
+// AddTermVectors records where the term occurs in each field
+func (ftlm FieldTermLocationMap) AddTermVectors(term string, vectors []*index.TermFieldVector) {
+	for _, vector := range vectors {
+		tlm, ok := ftlm[vector.Field]
+		if !ok {
+			tlm = make(TermLocationMap)
+			ftlm[vector.Field] = tlm
+		}
+		loc := Location{
+			Pos:   vector.Pos,
+			Start: vector.Start,
+			End:   vector.End,
+		}
+		tlm[term] = append(tlm[term], &loc)
+	}
+}
+
+// mergeLocations combines the locations of the constituents
+// of a compound match, nil if none of them have locations
+func mergeLocations(constituents []*DocumentMatch) FieldTermLocationMap {
+	var rv FieldTermLocationMap
+	for _, docMatch := range constituents {
+		for field, tlm := range docMatch.Locations {
+			if rv == nil {
+				rv = make(FieldTermLocationMap)
+			}
+			rvtlm, ok := rv[field]
+			if !ok {
+				rvtlm = make(TermLocationMap)
+				rv[field] = rvtlm
+			}
+			for term, locations := range tlm {
+				rvtlm[term] = append(rvtlm[term], locations...)
+			}
+		}
+	}
+	return rv
+}
+
 type DocumentMatch struct {
-	ID    string       `json:"id"`
-	Score float64      `json:"score"`
-	Expl  *Explanation `json:"explanation,omitempty"`
+	ID        string                 `json:"id"`
+	Score     float64                `json:"score"`
+	Expl      *Explanation           `json:"explanation,omitempty"`
+	Locations FieldTermLocationMap   `json:"-"`
+	Fields    map[string]interface{} `json:"fields,omitempty"`
+	Fragments map[string][]string    `json:"fragments,omitempty"`
+	// Sort holds the values the document was sorted by
+	Sort []string `json:"sort,omitempty"`
+
+	sortValues [][]byte
 }
 
 type DocumentMatchCollection []*DocumentMatch
 
 type Searcher interface {
-	Next() (*DocumentMatch, error)
-	Advance(ID string) (*DocumentMatch, error)
+	// Next and Advance return the context error
+	// once the context is cancelled or times out
+	Next(ctx context.Context) (*DocumentMatch, error)
+	Advance(ctx context.Context, ID string) (*DocumentMatch, error)
 	Close()
 	Weight() float64
 	SetQueryNorm(float64)
 	Count() uint64
 }
 
+// MinScoreSearcher is a Searcher which can skip scoring documents
+// that cannot score above a minimum, collectors keeping the best hits
+// raise it as they fill up.  Such documents are still returned, with
+// a Score below the minimum.
+type MinScoreSearcher interface {
+	Searcher
+	SetMinScore(minScore float64)
+}
+
 type OrderedSearcherList []Searcher
 
 // sort.Interface
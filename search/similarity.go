@@ -0,0 +1,228 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package search
+
+import (
+	"fmt"
+	"math"
+)
+
+// Similarity decides how the statistics of a term match are
+// combined into a score.  A match is scored as:
+//
+//	Tf(freq, fieldLength, avgFieldLength) * idf * QueryWeight(boost, idf, queryNorm)
+//
+// where idf comes from Idf() and queryNorm from QueryNorm().
+type Similarity interface {
+	// Idf rewards terms that occur in few documents
+	Idf(docFreq, docTotal uint64) float64
+
+	// Tf rewards frequent terms, normalized by the field length,
+	// it must not grow with the field length so that a fieldLength
+	// of freq bounds the score of a match
+	Tf(freq float64, fieldLength uint64, avgFieldLength float64) float64
+
+	// QueryNorm makes scores comparable across queries
+	QueryNorm(sumOfSquaredWeights float64) float64
+
+	// QueryWeight is the query side weight of a single term
+	QueryWeight(boost, idf, queryNorm float64) float64
+
+	// Coord rewards documents matching more of the disjunction
+	Coord(matching, total int) float64
+
+	// explanations of the values above
+	ExplainTf(field, term string, freq float64, fieldLength uint64, avgFieldLength float64) *Explanation
+	ExplainQueryWeight(boost float64, idf *Explanation, queryNorm float64) []*Explanation
+}
+
+var DefaultSimilarity Similarity = NewClassicSimilarity()
+
+// CLASSIC
+
+// ClassicSimilarity is the lucene style tf-idf with query norm
+type ClassicSimilarity struct{}
+
+func NewClassicSimilarity() *ClassicSimilarity {
+	return &ClassicSimilarity{}
+}
+
+func (s *ClassicSimilarity) Idf(docFreq, docTotal uint64) float64 {
+	return 1.0 + math.Log(float64(docTotal)/float64(docFreq+1.0))
+}
+
+func (s *ClassicSimilarity) Tf(freq float64, fieldLength uint64, avgFieldLength float64) float64 {
+	return s.tf(freq) * fieldNorm(fieldLength)
+}
+
+func (s *ClassicSimilarity) tf(freq float64) float64 {
+	if freq < MAX_SQRT_CACHE && freq == math.Floor(freq) {
+		return SQRT_CACHE[int(freq)]
+	}
+	return math.Sqrt(freq)
+}
+
+func (s *ClassicSimilarity) QueryNorm(sumOfSquaredWeights float64) float64 {
+	return 1.0 / math.Sqrt(sumOfSquaredWeights)
+}
+
+func (s *ClassicSimilarity) QueryWeight(boost, idf, queryNorm float64) float64 {
+	return boost * idf * queryNorm
+}
+
+func (s *ClassicSimilarity) Coord(matching, total int) float64 {
+	return float64(matching) / float64(total)
+}
+
+func (s *ClassicSimilarity) ExplainTf(field, term string, freq float64, fieldLength uint64, avgFieldLength float64) *Explanation {
+	childrenExplanations := make([]*Explanation, 2)
+	childrenExplanations[0] = &Explanation{
+		Value:   s.tf(freq),
+		Message: fmt.Sprintf("tf(termFreq(%s:%s)=%v", field, term, freq),
+	}
+	childrenExplanations[1] = &Explanation{
+		Value:   fieldNorm(fieldLength),
+		Message: fmt.Sprintf("fieldNorm(field=%s, length=%d)", field, fieldLength),
+	}
+	return &Explanation{
+		Value:    s.Tf(freq, fieldLength, avgFieldLength),
+		Message:  "product of:",
+		Children: childrenExplanations,
+	}
+}
+
+func (s *ClassicSimilarity) ExplainQueryWeight(boost float64, idf *Explanation, queryNorm float64) []*Explanation {
+	childrenExplanations := make([]*Explanation, 3)
+	childrenExplanations[0] = &Explanation{
+		Value:   boost,
+		Message: "boost",
+	}
+	childrenExplanations[1] = idf
+	childrenExplanations[2] = &Explanation{
+		Value:   queryNorm,
+		Message: "queryNorm",
+	}
+	return childrenExplanations
+}
+
+// BM25
+
+const DEFAULT_BM25_K1 = 1.2
+const DEFAULT_BM25_B = 0.75
+
+// BM25Similarity is Okapi BM25, k1 controls term frequency
+// saturation, b controls field length normalization
+type BM25Similarity struct {
+	K1 float64
+	B  float64
+}
+
+func NewBM25Similarity(k1, b float64) *BM25Similarity {
+	return &BM25Similarity{
+		K1: k1,
+		B:  b,
+	}
+}
+
+func (s *BM25Similarity) Idf(docFreq, docTotal uint64) float64 {
+	return math.Log(1.0 + (float64(docTotal)-float64(docFreq)+0.5)/(float64(docFreq)+0.5))
+}
+
+func (s *BM25Similarity) Tf(freq float64, fieldLength uint64, avgFieldLength float64) float64 {
+	lengthRatio := 1.0
+	if avgFieldLength > 0 {
+		lengthRatio = float64(fieldLength) / avgFieldLength
+	}
+	return (freq * (s.K1 + 1.0)) / (freq + s.K1*(1.0-s.B+s.B*lengthRatio))
+}
+
+func (s *BM25Similarity) QueryNorm(sumOfSquaredWeights float64) float64 {
+	return 1.0
+}
+
+func (s *BM25Similarity) QueryWeight(boost, idf, queryNorm float64) float64 {
+	return boost
+}
+
+func (s *BM25Similarity) Coord(matching, total int) float64 {
+	return 1.0
+}
+
+func (s *BM25Similarity) ExplainTf(field, term string, freq float64, fieldLength uint64, avgFieldLength float64) *Explanation {
+	childrenExplanations := make([]*Explanation, 5)
+	childrenExplanations[0] = &Explanation{
+		Value:   freq,
+		Message: fmt.Sprintf("termFreq(%s:%s)", field, term),
+	}
+	childrenExplanations[1] = &Explanation{
+		Value:   s.K1,
+		Message: "k1",
+	}
+	childrenExplanations[2] = &Explanation{
+		Value:   s.B,
+		Message: "b",
+	}
+	childrenExplanations[3] = &Explanation{
+		Value:   float64(fieldLength),
+		Message: fmt.Sprintf("fieldLength(field=%s)", field),
+	}
+	childrenExplanations[4] = &Explanation{
+		Value:   avgFieldLength,
+		Message: fmt.Sprintf("avgFieldLength(field=%s)", field),
+	}
+	return &Explanation{
+		Value:    s.Tf(freq, fieldLength, avgFieldLength),
+		Message:  "tfNorm, computed from (freq * (k1 + 1)) / (freq + k1 * (1 - b + b * fieldLength / avgFieldLength)):",
+		Children: childrenExplanations,
+	}
+}
+
+func (s *BM25Similarity) ExplainQueryWeight(boost float64, idf *Explanation, queryNorm float64) []*Explanation {
+	childrenExplanations := make([]*Explanation, 1)
+	childrenExplanations[0] = &Explanation{
+		Value:   boost,
+		Message: "boost",
+	}
+	return childrenExplanations
+}
+
+// SimilarityConfig is the JSON representation of a similarity
+// as found in index definitions and search requests
+type SimilarityConfig struct {
+	Type string   `json:"type"`
+	K1   *float64 `json:"k1,omitempty"`
+	B    *float64 `json:"b,omitempty"`
+}
+
+func (c *SimilarityConfig) Similarity() (Similarity, error) {
+	if c == nil {
+		return DefaultSimilarity, nil
+	}
+	switch c.Type {
+	case "", "classic":
+		return NewClassicSimilarity(), nil
+	case "bm25":
+		k1 := DEFAULT_BM25_K1
+		if c.K1 != nil {
+			k1 = *c.K1
+		}
+		b := DEFAULT_BM25_B
+		if c.B != nil {
+			b = *c.B
+		}
+		if k1 < 0 {
+			return nil, fmt.Errorf("BM25 k1 must not be negative")
+		}
+		if b < 0 || b > 1 {
+			return nil, fmt.Errorf("BM25 b must be between 0 and 1")
+		}
+		return NewBM25Similarity(k1, b), nil
+	}
+	return nil, fmt.Errorf("Unknown similarity '%s'", c.Type)
+}
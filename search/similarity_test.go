@@ -0,0 +1,172 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package search
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/couchbaselabs/cbfullofit/index"
+)
+
+func TestBM25TermSearch(t *testing.T) {
+
+	tests := []struct {
+		index   index.Index
+		query   *TermQuery
+		results []*DocumentMatch
+	}{
+		{
+			index: twoDocIndex,
+			query: &TermQuery{
+				Term:    "beer",
+				Field:   "desc",
+				Boost:   1.0,
+				Explain: true,
+			},
+			results: []*DocumentMatch{
+				&DocumentMatch{
+					ID:    "1",
+					Score: 0.5587577094818971,
+				},
+				&DocumentMatch{
+					ID:    "2",
+					Score: 0.4134526267397455,
+				},
+				&DocumentMatch{
+					ID:    "3",
+					Score: 0.4134526267397455,
+				},
+				&DocumentMatch{
+					ID:    "4",
+					Score: 0.5957789480174464,
+				},
+			},
+		},
+		{
+			index: twoDocIndex,
+			query: &TermQuery{
+				Term:    "marty",
+				Field:   "name",
+				Boost:   1.0,
+				Explain: true,
+			},
+			results: []*DocumentMatch{
+				&DocumentMatch{
+					ID:    "1",
+					Score: 1.3862943611198906,
+				},
+			},
+		},
+	}
+
+	similarity := NewBM25Similarity(DEFAULT_BM25_K1, DEFAULT_BM25_B)
+	for testIndex, test := range tests {
+		searcher, err := NewTermSearcher(test.index, similarity, test.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer searcher.Close()
+
+		next, err := searcher.Next(context.Background())
+		i := 0
+		for err == nil && next != nil {
+			if i < len(test.results) {
+				if next.ID != test.results[i].ID {
+					t.Errorf("expected result %d to have id %s got %s for test %d", i, test.results[i].ID, next.ID, testIndex)
+				}
+				if next.Score != test.results[i].Score {
+					t.Errorf("expected result %d to have score %v got  %v for test %d", i, test.results[i].Score, next.Score, testIndex)
+					t.Logf("explanation: %v", next.Expl)
+				}
+			}
+			next, err = searcher.Next(context.Background())
+			i++
+		}
+		if err != nil {
+			t.Fatalf("error iterating searcher: %v for test %d", err, testIndex)
+		}
+		if len(test.results) != i {
+			t.Errorf("expected %d results got %d for test %d", len(test.results), i, testIndex)
+		}
+	}
+}
+
+func TestSimilarityConfig(t *testing.T) {
+	k1 := 2.0
+	badB := 1.5
+
+	tests := []struct {
+		config     *SimilarityConfig
+		similarity Similarity
+		err        bool
+	}{
+		{
+			config:     nil,
+			similarity: DefaultSimilarity,
+		},
+		{
+			config:     &SimilarityConfig{Type: "classic"},
+			similarity: NewClassicSimilarity(),
+		},
+		{
+			config:     &SimilarityConfig{Type: "bm25"},
+			similarity: NewBM25Similarity(DEFAULT_BM25_K1, DEFAULT_BM25_B),
+		},
+		{
+			config:     &SimilarityConfig{Type: "bm25", K1: &k1},
+			similarity: NewBM25Similarity(2.0, DEFAULT_BM25_B),
+		},
+		{
+			config: &SimilarityConfig{Type: "bm25", B: &badB},
+			err:    true,
+		},
+		{
+			config: &SimilarityConfig{Type: "dfr"},
+			err:    true,
+		},
+	}
+
+	for i, test := range tests {
+		similarity, err := test.config.Similarity()
+		if test.err {
+			if err == nil {
+				t.Errorf("expected error for test %d", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error for test %d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(similarity, test.similarity) {
+			t.Errorf("expected %#v got %#v for test %d", test.similarity, similarity, i)
+		}
+	}
+}
+
+func TestFieldNorm(t *testing.T) {
+	tests := []struct {
+		fieldLength uint64
+		norm        float64
+	}{
+		{fieldLength: 0, norm: 1.0},
+		{fieldLength: 1, norm: 1.0},
+		{fieldLength: 4, norm: 0.5},
+		{fieldLength: 400, norm: 0.05},
+	}
+
+	for _, test := range tests {
+		norm := fieldNorm(test.fieldLength)
+		if norm != test.norm {
+			t.Errorf("expected norm %f for length %d, got %f", test.norm, test.fieldLength, norm)
+		}
+	}
+}
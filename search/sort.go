@@ -0,0 +1,195 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package search
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/couchbaselabs/cbfullofit/index"
+	"github.com/couchbaselabs/cbfullofit/numeric"
+)
+
+// pseudo fields sorting by the score and the ID of the document
+const (
+	SORT_SCORE = "_score"
+	SORT_ID    = "_id"
+)
+
+// SortField orders documents by a field, the natural order is
+// ascending except for the score where the best matches come first.
+// Descending reverses it, documents without a value always sort last.
+type SortField struct {
+	Field      string
+	Descending bool
+	fieldType  string
+}
+
+func (sf *SortField) String() string {
+	if sf.Descending {
+		return "-" + sf.Field
+	}
+	return sf.Field
+}
+
+// SortOrder compares documents by each field in turn
+type SortOrder []*SortField
+
+// ParseSortOrder reads fields like ["-price", "name", "_score", "_id"],
+// a leading - reverses the order of the field
+func ParseSortOrder(fields []string) (SortOrder, error) {
+	rv := make(SortOrder, len(fields))
+	for i, field := range fields {
+		sf := SortField{Field: field}
+		if strings.HasPrefix(field, "-") {
+			sf.Field = field[1:]
+			sf.Descending = true
+		}
+		if sf.Field == "" {
+			return nil, fmt.Errorf("sort field must have a name")
+		}
+		rv[i] = &sf
+	}
+	return rv, nil
+}
+
+// Validate checks the sort fields exist in the schema of the index
+// and are sortable, and remembers their types to format the sort values
+func (so SortOrder) Validate(idx index.Index) error {
+	for _, sf := range so {
+		if sf.Field == SORT_SCORE || sf.Field == SORT_ID {
+			continue
+		}
+		field := schemaField(idx, sf.Field)
+		if field == nil {
+			return fmt.Errorf("No field named `%s` in the schema", sf.Field)
+		}
+		if !field.Sortable {
+			return fmt.Errorf("Field `%s` is not sortable", sf.Field)
+		}
+		sf.fieldType = field.Type
+	}
+	return nil
+}
+
+// loadSortValues reads the values the document is sorted by
+func (so SortOrder) loadSortValues(idx index.Index, dm *DocumentMatch) error {
+	dm.sortValues = make([][]byte, len(so))
+	for i, sf := range so {
+		if sf.Field == SORT_SCORE || sf.Field == SORT_ID {
+			continue
+		}
+		sortValue, err := idx.SortValue([]byte(dm.ID), sf.Field)
+		if err != nil {
+			return err
+		}
+		dm.sortValues[i] = sortValue
+	}
+	return nil
+}
+
+// compare is negative when a sorts before b, ties are broken by ID
+func (so SortOrder) compare(a, b *DocumentMatch) int {
+	for i, sf := range so {
+		var c int
+		switch sf.Field {
+		case SORT_SCORE:
+			c = compareFloat64(b.Score, a.Score)
+		case SORT_ID:
+			c = compareString(a.ID, b.ID)
+		default:
+			av, bv := a.sortValues[i], b.sortValues[i]
+			if av == nil || bv == nil {
+				// missing values sort last whatever the direction
+				if av != nil {
+					return -1
+				} else if bv != nil {
+					return 1
+				}
+				continue
+			}
+			c = bytes.Compare(av, bv)
+		}
+		if sf.Descending {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return compareString(a.ID, b.ID)
+}
+
+// sortsAfterOnScore tells if a sorts after b whatever the other
+// fields, which is only known when sorting by score first
+func (so SortOrder) sortsAfterOnScore(a, b *DocumentMatch) bool {
+	if len(so) == 0 || so[0].Field != SORT_SCORE {
+		return false
+	}
+	if so[0].Descending {
+		return a.Score > b.Score
+	}
+	return a.Score < b.Score
+}
+
+// formatSortValues fills in the readable sort values of the document
+func (so SortOrder) formatSortValues(dm *DocumentMatch) {
+	dm.Sort = make([]string, len(so))
+	for i, sf := range so {
+		switch sf.Field {
+		case SORT_SCORE:
+			dm.Sort[i] = strconv.FormatFloat(dm.Score, 'f', -1, 64)
+		case SORT_ID:
+			dm.Sort[i] = dm.ID
+		default:
+			dm.Sort[i] = formatSortValue(sf.fieldType, dm.sortValues[i])
+		}
+	}
+}
+
+// formatSortValue decodes a sort value, numbers and datetimes
+// are prefix coded, text sorts by its own bytes
+func formatSortValue(fieldType string, sortValue []byte) string {
+	if sortValue == nil {
+		return ""
+	}
+	switch fieldType {
+	case index.NUMERIC_FIELD, index.DATETIME_FIELD:
+		i64, err := numeric.PrefixCoded(sortValue).Int64()
+		if err != nil {
+			return ""
+		}
+		if fieldType == index.DATETIME_FIELD {
+			return time.Unix(0, i64).UTC().Format(time.RFC3339Nano)
+		}
+		return strconv.FormatFloat(numeric.Int64ToFloat64(i64), 'f', -1, 64)
+	}
+	return string(sortValue)
+}
+
+func compareFloat64(a, b float64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+func compareString(a, b string) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
@@ -9,13 +9,13 @@
 package search
 
 import (
-	"math"
-
+	"context"
 	"github.com/couchbaselabs/cbfullofit/index"
 )
 
 type TermBooleanSearcher struct {
 	index           index.Index
+	similarity      Similarity
 	mustSearcher    *TermConjunctionSearcher
 	shouldSearcher  *TermDisjunctionSearcher
 	mustNotSearcher *TermDisjunctionSearcher
@@ -28,26 +28,26 @@ type TermBooleanSearcher struct {
 	scorer          *TermConjunctionQueryScorer
 }
 
-func NewTermBooleanSearcher(index index.Index, query *TermBooleanQuery) (*TermBooleanSearcher, error) {
+func NewTermBooleanSearcher(ctx context.Context, index index.Index, similarity Similarity, query *TermBooleanQuery) (*TermBooleanSearcher, error) {
 	// build the downstream searchres
 	var err error
 	var mustSearcher *TermConjunctionSearcher
 	if query.Must != nil {
-		mustSearcher, err = NewTermConjunctionSearcher(index, query.Must)
+		mustSearcher, err = NewTermConjunctionSearcher(ctx, index, similarity, query.Must)
 		if err != nil {
 			return nil, err
 		}
 	}
 	var shouldSearcher *TermDisjunctionSearcher
 	if query.Should != nil {
-		shouldSearcher, err = NewTermDisjunctionSearcher(index, query.Should)
+		shouldSearcher, err = NewTermDisjunctionSearcher(ctx, index, similarity, query.Should)
 		if err != nil {
 			return nil, err
 		}
 	}
 	var mustNotSearcher *TermDisjunctionSearcher
 	if query.MustNot != nil {
-		mustNotSearcher, err = NewTermDisjunctionSearcher(index, query.MustNot)
+		mustNotSearcher, err = NewTermDisjunctionSearcher(ctx, index, similarity, query.MustNot)
 		if err != nil {
 			return nil, err
 		}
@@ -56,13 +56,14 @@ func NewTermBooleanSearcher(index index.Index, query *TermBooleanQuery) (*TermBo
 	// build our searcher
 	rv := TermBooleanSearcher{
 		index:           index,
+		similarity:      similarity,
 		mustSearcher:    mustSearcher,
 		shouldSearcher:  shouldSearcher,
 		mustNotSearcher: mustNotSearcher,
 		scorer:          NewTermConjunctionQueryScorer(query.Explain),
 	}
 	rv.computeQueryNorm()
-	err = rv.initSearchers()
+	err = rv.initSearchers(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -81,7 +82,7 @@ func (s *TermBooleanSearcher) computeQueryNorm() {
 	}
 
 	// now compute query norm from this
-	s.queryNorm = 1.0 / math.Sqrt(sumOfSquaredWeights)
+	s.queryNorm = s.similarity.QueryNorm(sumOfSquaredWeights)
 	// finally tell all the downsteam searchers the norm
 	if s.mustSearcher != nil {
 		s.mustSearcher.SetQueryNorm(s.queryNorm)
@@ -91,25 +92,25 @@ func (s *TermBooleanSearcher) computeQueryNorm() {
 	}
 }
 
-func (s *TermBooleanSearcher) initSearchers() error {
+func (s *TermBooleanSearcher) initSearchers(ctx context.Context) error {
 	var err error
 	// get all searchers pointing at their first match
 	if s.mustSearcher != nil {
-		s.currMust, err = s.mustSearcher.Next()
+		s.currMust, err = s.mustSearcher.Next(ctx)
 		if err != nil {
 			return err
 		}
 	}
 
 	if s.shouldSearcher != nil {
-		s.currShould, err = s.shouldSearcher.Next()
+		s.currShould, err = s.shouldSearcher.Next(ctx)
 		if err != nil {
 			return err
 		}
 	}
 
 	if s.mustNotSearcher != nil {
-		s.currMustNot, err = s.mustNotSearcher.Next()
+		s.currMustNot, err = s.mustNotSearcher.Next(ctx)
 		if err != nil {
 			return err
 		}
@@ -126,16 +127,16 @@ func (s *TermBooleanSearcher) initSearchers() error {
 	return nil
 }
 
-func (s *TermBooleanSearcher) advanceNextMust() error {
+func (s *TermBooleanSearcher) advanceNextMust(ctx context.Context) error {
 	var err error
 
 	if s.mustSearcher != nil {
-		s.currMust, err = s.mustSearcher.Next()
+		s.currMust, err = s.mustSearcher.Next(ctx)
 		if err != nil {
 			return err
 		}
 	} else if s.mustSearcher == nil {
-		s.currShould, err = s.shouldSearcher.Next()
+		s.currShould, err = s.shouldSearcher.Next(ctx)
 		if err != nil {
 			return err
 		}
@@ -153,18 +154,26 @@ func (s *TermBooleanSearcher) advanceNextMust() error {
 
 func (s *TermBooleanSearcher) Weight() float64 {
 	var rv float64
-	rv += s.mustSearcher.Weight()
-	rv += s.shouldSearcher.Weight()
+	if s.mustSearcher != nil {
+		rv += s.mustSearcher.Weight()
+	}
+	if s.shouldSearcher != nil {
+		rv += s.shouldSearcher.Weight()
+	}
 
 	return rv
 }
 
 func (s *TermBooleanSearcher) SetQueryNorm(qnorm float64) {
-	s.mustSearcher.SetQueryNorm(qnorm)
-	s.shouldSearcher.SetQueryNorm(qnorm)
+	if s.mustSearcher != nil {
+		s.mustSearcher.SetQueryNorm(qnorm)
+	}
+	if s.shouldSearcher != nil {
+		s.shouldSearcher.SetQueryNorm(qnorm)
+	}
 }
 
-func (s *TermBooleanSearcher) Next() (*DocumentMatch, error) {
+func (s *TermBooleanSearcher) Next(ctx context.Context) (*DocumentMatch, error) {
 
 	var err error
 	var rv *DocumentMatch
@@ -172,24 +181,30 @@ func (s *TermBooleanSearcher) Next() (*DocumentMatch, error) {
 	for s.currentId != "" {
 		if s.currMustNot != nil && s.currMustNot.ID < s.currentId {
 			// advance must not searcher to our candidate entry
-			s.currMustNot, err = s.mustNotSearcher.Advance(s.currentId)
+			s.currMustNot, err = s.mustNotSearcher.Advance(ctx, s.currentId)
 			if err != nil {
 				return nil, err
 			}
 			if s.currMustNot != nil && s.currMustNot.ID == s.currentId {
 				// the candidate is excluded
-				s.advanceNextMust()
+				err = s.advanceNextMust(ctx)
+				if err != nil {
+					return nil, err
+				}
 				continue
 			}
 		} else if s.currMustNot != nil && s.currMustNot.ID == s.currentId {
 			// the candidate is excluded
-			s.advanceNextMust()
+			err = s.advanceNextMust(ctx)
+			if err != nil {
+				return nil, err
+			}
 			continue
 		}
 
 		if s.currShould != nil && s.currShould.ID < s.currentId {
 			// advance shoudl searcher to our candidate entry
-			s.currShould, err = s.shouldSearcher.Advance(s.currentId)
+			s.currShould, err = s.shouldSearcher.Advance(ctx, s.currentId)
 			if err != nil {
 				return nil, err
 			}
@@ -201,12 +216,18 @@ func (s *TermBooleanSearcher) Next() (*DocumentMatch, error) {
 				}
 				cons = append(cons, s.currShould)
 				rv = s.scorer.Score(cons)
-				s.advanceNextMust()
+				err = s.advanceNextMust(ctx)
+				if err != nil {
+					return nil, err
+				}
 				break
 			} else if s.shouldSearcher.min == 0 {
 				// match is OK anyway
 				rv = s.scorer.Score([]*DocumentMatch{s.currMust})
-				s.advanceNextMust()
+				err = s.advanceNextMust(ctx)
+				if err != nil {
+					return nil, err
+				}
 				break
 			}
 		} else if s.currShould != nil && s.currShould.ID == s.currentId {
@@ -217,30 +238,43 @@ func (s *TermBooleanSearcher) Next() (*DocumentMatch, error) {
 			}
 			cons = append(cons, s.currShould)
 			rv = s.scorer.Score(cons)
-			s.advanceNextMust()
+			err = s.advanceNextMust(ctx)
+			if err != nil {
+				return nil, err
+			}
 			break
 		} else if s.shouldSearcher == nil || s.shouldSearcher.min == 0 {
 			// match is OK anyway
 			rv = s.scorer.Score([]*DocumentMatch{s.currMust})
-			s.advanceNextMust()
+			err = s.advanceNextMust(ctx)
+			if err != nil {
+				return nil, err
+			}
 			break
 		}
 
-		s.advanceNextMust()
+		err = s.advanceNextMust(ctx)
+		if err != nil {
+			return nil, err
+		}
 	}
 	return rv, nil
 }
 
-func (s *TermBooleanSearcher) Advance(ID string) (*DocumentMatch, error) {
+func (s *TermBooleanSearcher) Advance(ctx context.Context, ID string) (*DocumentMatch, error) {
 	s.currentId = ID
-	return s.Next()
+	return s.Next(ctx)
 }
 
 func (s *TermBooleanSearcher) Count() uint64 {
 	// for now return a worst case
 	var sum uint64 = 0
-	sum += s.mustSearcher.Count()
-	sum += s.shouldSearcher.Count()
+	if s.mustSearcher != nil {
+		sum += s.mustSearcher.Count()
+	}
+	if s.shouldSearcher != nil {
+		sum += s.shouldSearcher.Count()
+	}
 	return sum
 }
 
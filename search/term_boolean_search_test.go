@@ -9,6 +9,7 @@
 package search
 
 import (
+	"context"
 	"testing"
 
 	"github.com/couchbaselabs/cbfullofit/index"
@@ -85,10 +86,10 @@ func TestTermBooleanSearch(t *testing.T) {
 	}
 
 	for testIndex, test := range tests {
-		searcher, err := test.query.Searcher(test.index)
+		searcher, err := test.query.Searcher(context.Background(), test.index, DefaultSimilarity)
 		defer searcher.Close()
 
-		next, err := searcher.Next()
+		next, err := searcher.Next(context.Background())
 		i := 0
 		for err == nil && next != nil {
 			if i < len(test.results) {
@@ -100,7 +101,7 @@ func TestTermBooleanSearch(t *testing.T) {
 					t.Logf("scoring explanation: %s", next.Expl)
 				}
 			}
-			next, err = searcher.Next()
+			next, err = searcher.Next(context.Background())
 			i++
 		}
 		if err != nil {
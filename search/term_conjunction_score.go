@@ -42,5 +42,7 @@ func (s *TermConjunctionQueryScorer) Score(constituents []*DocumentMatch) *Docum
 		rv.Expl = &Explanation{Value: sum, Message: "sum of:", Children: childrenExplanations}
 	}
 
+	rv.Locations = mergeLocations(constituents)
+
 	return &rv
 }
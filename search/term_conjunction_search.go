@@ -9,42 +9,48 @@
 package search
 
 import (
-	"math"
+	"context"
 	"sort"
 
 	"github.com/couchbaselabs/cbfullofit/index"
 )
 
 type TermConjunctionSearcher struct {
-	index     index.Index
-	searchers OrderedSearcherList
-	queryNorm float64
-	currs     []*DocumentMatch
-	currentId string
-	scorer    *TermConjunctionQueryScorer
+	index      index.Index
+	similarity Similarity
+	searchers  OrderedSearcherList
+	queryNorm  float64
+	currs      []*DocumentMatch
+	currentId  string
+	scorer     *TermConjunctionQueryScorer
 }
 
-func NewTermConjunctionSearcher(index index.Index, query *TermConjunctionQuery) (*TermConjunctionSearcher, error) {
+func NewTermConjunctionSearcher(ctx context.Context, index index.Index, similarity Similarity, query *TermConjunctionQuery) (*TermConjunctionSearcher, error) {
 	// build the downstream searchres
 	searchers := make(OrderedSearcherList, len(query.Terms))
 	for i, termQuery := range query.Terms {
-		searcher, err := termQuery.Searcher(index)
+		searcher, err := termQuery.Searcher(ctx, index, similarity)
 		if err != nil {
 			return nil, err
 		}
 		searchers[i] = searcher
 	}
+	return newTermConjunctionSearcher(ctx, index, similarity, searchers, query.Explain)
+}
+
+func newTermConjunctionSearcher(ctx context.Context, index index.Index, similarity Similarity, searchers OrderedSearcherList, explain bool) (*TermConjunctionSearcher, error) {
 	// sort the searchers
 	sort.Sort(searchers)
 	// build our searcher
 	rv := TermConjunctionSearcher{
-		index:     index,
-		searchers: searchers,
-		currs:     make([]*DocumentMatch, len(searchers)),
-		scorer:    NewTermConjunctionQueryScorer(query.Explain),
+		index:      index,
+		similarity: similarity,
+		searchers:  searchers,
+		currs:      make([]*DocumentMatch, len(searchers)),
+		scorer:     NewTermConjunctionQueryScorer(explain),
 	}
 	rv.computeQueryNorm()
-	err := rv.initSearchers()
+	err := rv.initSearchers(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -59,18 +65,18 @@ func (s *TermConjunctionSearcher) computeQueryNorm() {
 		sumOfSquaredWeights += termSearcher.Weight()
 	}
 	// now compute query norm from this
-	s.queryNorm = 1.0 / math.Sqrt(sumOfSquaredWeights)
+	s.queryNorm = s.similarity.QueryNorm(sumOfSquaredWeights)
 	// finally tell all the downsteam searchers the norm
 	for _, termSearcher := range s.searchers {
 		termSearcher.SetQueryNorm(s.queryNorm)
 	}
 }
 
-func (s *TermConjunctionSearcher) initSearchers() error {
+func (s *TermConjunctionSearcher) initSearchers(ctx context.Context) error {
 	var err error
 	// get all searchers pointing at their first match
 	for i, termSearcher := range s.searchers {
-		s.currs[i], err = termSearcher.Next()
+		s.currs[i], err = termSearcher.Next(ctx)
 		if err != nil {
 			return err
 		}
@@ -100,7 +106,7 @@ func (s *TermConjunctionSearcher) SetQueryNorm(qnorm float64) {
 	}
 }
 
-func (s *TermConjunctionSearcher) Next() (*DocumentMatch, error) {
+func (s *TermConjunctionSearcher) Next(ctx context.Context) (*DocumentMatch, error) {
 	var rv *DocumentMatch
 	var err error
 OUTER:
@@ -109,7 +115,7 @@ OUTER:
 		for i, termSearcher := range s.searchers {
 			if s.currs[i].ID != s.currentId {
 				// this reader doesn't have the currentId, try to advance
-				s.currs[i], err = termSearcher.Advance(s.currentId)
+				s.currs[i], err = termSearcher.Advance(ctx, s.currentId)
 				if err != nil {
 					return nil, err
 				}
@@ -119,7 +125,7 @@ OUTER:
 				}
 				if s.currs[i].ID != s.currentId {
 					// if it still doesn't have the currentId, next and start over
-					s.currs[i], err = termSearcher.Next()
+					s.currs[i], err = termSearcher.Next(ctx)
 					if err != nil {
 						return nil, err
 					}
@@ -136,7 +142,7 @@ OUTER:
 		rv = s.scorer.Score(s.currs)
 
 		// prepare for next entry
-		s.currs[0], err = s.searchers[0].Next()
+		s.currs[0], err = s.searchers[0].Next(ctx)
 		if err != nil {
 			return nil, err
 		}
@@ -151,9 +157,9 @@ OUTER:
 	return rv, nil
 }
 
-func (s *TermConjunctionSearcher) Advance(ID string) (*DocumentMatch, error) {
+func (s *TermConjunctionSearcher) Advance(ctx context.Context, ID string) (*DocumentMatch, error) {
 	s.currentId = ID
-	return s.Next()
+	return s.Next(ctx)
 }
 
 func (s *TermConjunctionSearcher) Count() uint64 {
@@ -9,6 +9,7 @@
 package search
 
 import (
+	"context"
 	"testing"
 
 	"github.com/couchbaselabs/cbfullofit/index"
@@ -50,10 +51,10 @@ func TestTermConjunctionSearch(t *testing.T) {
 	}
 
 	for testIndex, test := range tests {
-		searcher, err := NewTermConjunctionSearcher(test.index, test.query)
+		searcher, err := NewTermConjunctionSearcher(context.Background(), test.index, DefaultSimilarity, test.query)
 		defer searcher.Close()
 
-		next, err := searcher.Next()
+		next, err := searcher.Next(context.Background())
 		i := 0
 		for err == nil && next != nil {
 			if i < len(test.results) {
@@ -65,7 +66,7 @@ func TestTermConjunctionSearch(t *testing.T) {
 					t.Logf("scoring explanation: %s", next.Expl)
 				}
 			}
-			next, err = searcher.Next()
+			next, err = searcher.Next(context.Background())
 			i++
 		}
 		if err != nil {
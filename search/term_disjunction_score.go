@@ -13,12 +13,14 @@ import (
 )
 
 type TermDisjunctionQueryScorer struct {
-	explain bool
+	similarity Similarity
+	explain    bool
 }
 
-func NewTermDisjunctionQueryScorer(explain bool) *TermDisjunctionQueryScorer {
+func NewTermDisjunctionQueryScorer(similarity Similarity, explain bool) *TermDisjunctionQueryScorer {
 	return &TermDisjunctionQueryScorer{
-		explain: explain,
+		similarity: similarity,
+		explain:    explain,
 	}
 }
 
@@ -45,7 +47,7 @@ func (s *TermDisjunctionQueryScorer) Score(constituents []*DocumentMatch, countM
 		rawExpl = &Explanation{Value: sum, Message: "sum of:", Children: childrenExplanations}
 	}
 
-	coord := float64(countMatch) / float64(countTotal)
+	coord := s.similarity.Coord(countMatch, countTotal)
 	rv.Score = sum * coord
 	if s.explain {
 		ce := make([]*Explanation, 2)
@@ -54,5 +56,7 @@ func (s *TermDisjunctionQueryScorer) Score(constituents []*DocumentMatch, countM
 		rv.Expl = &Explanation{Value: rv.Score, Message: "product of:", Children: ce}
 	}
 
+	rv.Locations = mergeLocations(constituents)
+
 	return &rv
 }
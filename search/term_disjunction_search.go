@@ -9,44 +9,50 @@
 package search
 
 import (
-	"math"
+	"context"
 	"sort"
 
 	"github.com/couchbaselabs/cbfullofit/index"
 )
 
 type TermDisjunctionSearcher struct {
-	index     index.Index
-	searchers OrderedSearcherList
-	queryNorm float64
-	currs     []*DocumentMatch
-	currentId string
-	scorer    *TermDisjunctionQueryScorer
-	min       float64
+	index      index.Index
+	similarity Similarity
+	searchers  OrderedSearcherList
+	queryNorm  float64
+	currs      []*DocumentMatch
+	currentId  string
+	scorer     *TermDisjunctionQueryScorer
+	min        float64
 }
 
-func NewTermDisjunctionSearcher(index index.Index, query *TermDisjunctionQuery) (*TermDisjunctionSearcher, error) {
+func NewTermDisjunctionSearcher(ctx context.Context, index index.Index, similarity Similarity, query *TermDisjunctionQuery) (*TermDisjunctionSearcher, error) {
 	// build the downstream searchres
 	searchers := make(OrderedSearcherList, len(query.Terms))
 	for i, termQuery := range query.Terms {
-		searcher, err := termQuery.Searcher(index)
+		searcher, err := termQuery.Searcher(ctx, index, similarity)
 		if err != nil {
 			return nil, err
 		}
 		searchers[i] = searcher
 	}
+	return newTermDisjunctionSearcher(ctx, index, similarity, searchers, query.Min, query.Explain)
+}
+
+func newTermDisjunctionSearcher(ctx context.Context, index index.Index, similarity Similarity, searchers OrderedSearcherList, min float64, explain bool) (*TermDisjunctionSearcher, error) {
 	// sort the searchers
 	sort.Sort(sort.Reverse(searchers))
 	// build our searcher
 	rv := TermDisjunctionSearcher{
-		index:     index,
-		searchers: searchers,
-		currs:     make([]*DocumentMatch, len(searchers)),
-		scorer:    NewTermDisjunctionQueryScorer(query.Explain),
-		min:       query.Min,
+		index:      index,
+		similarity: similarity,
+		searchers:  searchers,
+		currs:      make([]*DocumentMatch, len(searchers)),
+		scorer:     NewTermDisjunctionQueryScorer(similarity, explain),
+		min:        min,
 	}
 	rv.computeQueryNorm()
-	err := rv.initSearchers()
+	err := rv.initSearchers(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -61,18 +67,18 @@ func (s *TermDisjunctionSearcher) computeQueryNorm() {
 		sumOfSquaredWeights += termSearcher.Weight()
 	}
 	// now compute query norm from this
-	s.queryNorm = 1.0 / math.Sqrt(sumOfSquaredWeights)
+	s.queryNorm = s.similarity.QueryNorm(sumOfSquaredWeights)
 	// finally tell all the downsteam searchers the norm
 	for _, termSearcher := range s.searchers {
 		termSearcher.SetQueryNorm(s.queryNorm)
 	}
 }
 
-func (s *TermDisjunctionSearcher) initSearchers() error {
+func (s *TermDisjunctionSearcher) initSearchers(ctx context.Context) error {
 	var err error
 	// get all searchers pointing at their first match
 	for i, termSearcher := range s.searchers {
-		s.currs[i], err = termSearcher.Next()
+		s.currs[i], err = termSearcher.Next(ctx)
 		if err != nil {
 			return err
 		}
@@ -106,7 +112,7 @@ func (s *TermDisjunctionSearcher) SetQueryNorm(qnorm float64) {
 	}
 }
 
-func (s *TermDisjunctionSearcher) Next() (*DocumentMatch, error) {
+func (s *TermDisjunctionSearcher) Next(ctx context.Context) (*DocumentMatch, error) {
 	var err error
 	var rv *DocumentMatch
 	matching := make([]*DocumentMatch, 0)
@@ -131,7 +137,7 @@ func (s *TermDisjunctionSearcher) Next() (*DocumentMatch, error) {
 		for i, curr := range s.currs {
 			if curr != nil && curr.ID == s.currentId {
 				searcher := s.searchers[i]
-				s.currs[i], err = searcher.Next()
+				s.currs[i], err = searcher.Next(ctx)
 				if err != nil {
 					return nil, err
 				}
@@ -142,12 +148,12 @@ func (s *TermDisjunctionSearcher) Next() (*DocumentMatch, error) {
 	return rv, nil
 }
 
-func (s *TermDisjunctionSearcher) Advance(ID string) (*DocumentMatch, error) {
+func (s *TermDisjunctionSearcher) Advance(ctx context.Context, ID string) (*DocumentMatch, error) {
 
 	// get all searchers pointing at their first match
 	var err error
 	for i, termSearcher := range s.searchers {
-		s.currs[i], err = termSearcher.Advance(ID)
+		s.currs[i], err = termSearcher.Advance(ctx, ID)
 		if err != nil {
 			return nil, err
 		}
@@ -155,7 +161,7 @@ func (s *TermDisjunctionSearcher) Advance(ID string) (*DocumentMatch, error) {
 
 	s.currentId = s.nextSmallestId()
 
-	return s.Next()
+	return s.Next(ctx)
 }
 
 func (s *TermDisjunctionSearcher) Count() uint64 {
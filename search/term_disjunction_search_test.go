@@ -9,6 +9,7 @@
 package search
 
 import (
+	"context"
 	"testing"
 
 	"github.com/couchbaselabs/cbfullofit/index"
@@ -55,10 +56,10 @@ func TestTermDisjunctionSearch(t *testing.T) {
 	}
 
 	for testIndex, test := range tests {
-		searcher, err := test.query.Searcher(test.index)
+		searcher, err := test.query.Searcher(context.Background(), test.index, DefaultSimilarity)
 		defer searcher.Close()
 
-		next, err := searcher.Next()
+		next, err := searcher.Next(context.Background())
 		i := 0
 		for err == nil && next != nil {
 			if i < len(test.results) {
@@ -70,7 +71,7 @@ func TestTermDisjunctionSearch(t *testing.T) {
 					t.Logf("scoring explanation: %s", next.Expl)
 				}
 			}
-			next, err = searcher.Next()
+			next, err = searcher.Next(context.Background())
 			i++
 		}
 		if err != nil {
@@ -102,8 +103,8 @@ func TestDisjunctionAdvance(t *testing.T) {
 		Min:     0,
 	}
 
-	searcher, err := query.Searcher(twoDocIndex)
-	match, err := searcher.Advance("3")
+	searcher, err := query.Searcher(context.Background(), twoDocIndex, DefaultSimilarity)
+	match, err := searcher.Advance(context.Background(), "3")
 	if err != nil {
 		t.Errorf("unexpected error: %v", err)
 	}
@@ -17,29 +17,40 @@ import (
 
 const MAX_SCORE_CACHE = 64
 
+// scores only depend on the term frequency and the field length
+// so they can be cached for small values of both
+type scoreCacheKey struct {
+	freq        uint64
+	fieldLength uint64
+}
+
 type TermQueryScorer struct {
 	query                  *TermQuery
+	similarity             Similarity
 	docTerm                uint64
 	docTotal               uint64
+	avgFieldLength         float64
 	idf                    float64
 	explain                bool
 	idfExplanation         *Explanation
-	scoreCache             map[int]float64
-	scoreExplanationCache  map[int]*Explanation
+	scoreCache             map[scoreCacheKey]float64
+	scoreExplanationCache  map[scoreCacheKey]*Explanation
 	queryNorm              float64
 	queryWeight            float64
 	queryWeightExplanation *Explanation
 }
 
-func NewTermQueryScorer(query *TermQuery, docTotal, docTerm uint64, explain bool) *TermQueryScorer {
+func NewTermQueryScorer(query *TermQuery, similarity Similarity, docTotal, docTerm uint64, avgFieldLength float64, explain bool) *TermQueryScorer {
 	rv := TermQueryScorer{
 		query:                 query,
+		similarity:            similarity,
 		docTerm:               docTerm,
 		docTotal:              docTotal,
-		idf:                   1.0 + math.Log(float64(docTotal)/float64(docTerm+1.0)),
+		avgFieldLength:        avgFieldLength,
+		idf:                   similarity.Idf(docTerm, docTotal),
 		explain:               explain,
-		scoreCache:            make(map[int]float64, MAX_SCORE_CACHE),
-		scoreExplanationCache: make(map[int]*Explanation, MAX_SCORE_CACHE),
+		scoreCache:            make(map[scoreCacheKey]float64, MAX_SCORE_CACHE),
+		scoreExplanationCache: make(map[scoreCacheKey]*Explanation, MAX_SCORE_CACHE),
 		queryWeight:           1.0,
 	}
 
@@ -62,54 +73,41 @@ func (s *TermQueryScorer) SetQueryNorm(qnorm float64) {
 	s.queryNorm = qnorm
 
 	// update the query weight
-	s.queryWeight = s.query.Boost * s.idf * s.queryNorm
+	s.queryWeight = s.similarity.QueryWeight(s.query.Boost, s.idf, s.queryNorm)
 
 	if s.explain {
-		childrenExplanations := make([]*Explanation, 3)
-		childrenExplanations[0] = &Explanation{
-			Value:   s.query.Boost,
-			Message: "boost",
-		}
-		childrenExplanations[1] = s.idfExplanation
-		childrenExplanations[2] = &Explanation{
-			Value:   s.queryNorm,
-			Message: "queryNorm",
-		}
 		s.queryWeightExplanation = &Explanation{
 			Value:    s.queryWeight,
 			Message:  fmt.Sprintf("queryWeight(%s:%s^%f), product of:", s.query.Field, string(s.query.Term), s.query.Boost),
-			Children: childrenExplanations,
+			Children: s.similarity.ExplainQueryWeight(s.query.Boost, s.idfExplanation, s.queryNorm),
 		}
 	}
 }
 
-func (s *TermQueryScorer) Score(termMatch *index.TermFieldDoc) *DocumentMatch {
+// MaxScore bounds the score of a match with the term freq times,
+// the field holds at least freq terms whatever its length
+func (s *TermQueryScorer) MaxScore(freq uint64) float64 {
+	if s.queryWeight < 0 {
+		return math.Inf(1)
+	}
+	return s.similarity.Tf(float64(freq), freq, s.avgFieldLength) * s.idf * s.queryWeight
+}
+
+func (s *TermQueryScorer) Score(termMatch *index.TermFieldDoc, fieldLength uint64) *DocumentMatch {
 
 	var scoreExplanation *Explanation
 	// see if the score was cached
-	score, ok := s.scoreCache[int(termMatch.Freq)]
+	cacheKey := scoreCacheKey{freq: termMatch.Freq, fieldLength: fieldLength}
+	score, ok := s.scoreCache[cacheKey]
 	if !ok {
 		// need to compute score
-		var tf float64
-		if termMatch.Freq < MAX_SQRT_CACHE {
-			tf = SQRT_CACHE[int(termMatch.Freq)]
-		} else {
-			tf = math.Sqrt(float64(termMatch.Freq))
-		}
-
-		score = tf * termMatch.Norm * s.idf
+		tf := s.similarity.Tf(float64(termMatch.Freq), fieldLength, s.avgFieldLength)
+		score = tf * s.idf
 
 		if s.explain {
-			childrenExplanations := make([]*Explanation, 3)
-			childrenExplanations[0] = &Explanation{
-				Value:   tf,
-				Message: fmt.Sprintf("tf(termFreq(%s:%s)=%d", s.query.Field, string(s.query.Term), termMatch.Freq),
-			}
-			childrenExplanations[1] = &Explanation{
-				Value:   termMatch.Norm,
-				Message: fmt.Sprintf("fieldNorm(field=%s, doc=%s)", s.query.Field, termMatch.ID),
-			}
-			childrenExplanations[2] = s.idfExplanation
+			childrenExplanations := make([]*Explanation, 2)
+			childrenExplanations[0] = s.similarity.ExplainTf(s.query.Field, string(s.query.Term), float64(termMatch.Freq), fieldLength, s.avgFieldLength)
+			childrenExplanations[1] = s.idfExplanation
 			scoreExplanation = &Explanation{
 				Value:    score,
 				Message:  fmt.Sprintf("fieldWeight(%s:%s in %s), product of:", s.query.Field, string(s.query.Term), termMatch.ID),
@@ -132,16 +130,16 @@ func (s *TermQueryScorer) Score(termMatch *index.TermFieldDoc) *DocumentMatch {
 			}
 		}
 
-		if termMatch.Freq < MAX_SCORE_CACHE {
-			s.scoreCache[int(termMatch.Freq)] = score
+		if termMatch.Freq < MAX_SCORE_CACHE && fieldLength < MAX_SCORE_CACHE {
+			s.scoreCache[cacheKey] = score
 			if s.explain {
-				s.scoreExplanationCache[int(termMatch.Freq)] = scoreExplanation
+				s.scoreExplanationCache[cacheKey] = scoreExplanation
 			}
 		}
 	}
 
 	if ok && s.explain {
-		scoreExplanation = s.scoreExplanationCache[int(termMatch.Freq)]
+		scoreExplanation = s.scoreExplanationCache[cacheKey]
 	}
 
 	rv := DocumentMatch{
@@ -152,5 +150,22 @@ func (s *TermQueryScorer) Score(termMatch *index.TermFieldDoc) *DocumentMatch {
 		rv.Expl = scoreExplanation
 	}
 
+	if len(termMatch.Vectors) > 0 {
+		rv.Locations = make(FieldTermLocationMap)
+		rv.Locations.AddTermVectors(s.query.Term, termMatch.Vectors)
+	}
+
 	return &rv
 }
+
+// fieldNorm favors matches in shorter fields, an empty field is
+// treated as holding a single term
+func fieldNorm(fieldLength uint64) float64 {
+	if fieldLength == 0 {
+		return 1.0
+	}
+	if fieldLength < MAX_SQRT_CACHE {
+		return 1.0 / SQRT_CACHE[int(fieldLength)]
+	}
+	return 1.0 / math.Sqrt(float64(fieldLength))
+}
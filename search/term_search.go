@@ -9,22 +9,29 @@
 package search
 
 import (
+	"context"
 	"github.com/couchbaselabs/cbfullofit/index"
 )
 
 type TermSearcher struct {
-	index  index.Index
-	query  *TermQuery
-	reader index.TermFieldReader
-	scorer *TermQueryScorer
+	index    index.Index
+	query    *TermQuery
+	reader   index.TermFieldReader
+	scorer   *TermQueryScorer
+	minScore float64
 }
 
-func NewTermSearcher(index index.Index, query *TermQuery) (*TermSearcher, error) {
+func NewTermSearcher(index index.Index, similarity Similarity, query *TermQuery) (*TermSearcher, error) {
 	reader, err := index.TermFieldReader([]byte(query.Term), query.Field)
 	if err != nil {
 		return nil, err
 	}
-	scorer := NewTermQueryScorer(query, index.DocCount(), reader.Count(), query.Explain)
+	avgFieldLength, err := index.AvgFieldLength(query.Field)
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+	scorer := NewTermQueryScorer(query, similarity, index.DocCount(), reader.Count(), avgFieldLength, query.Explain)
 	return &TermSearcher{
 		index:  index,
 		query:  query,
@@ -45,7 +52,13 @@ func (s *TermSearcher) SetQueryNorm(qnorm float64) {
 	s.scorer.SetQueryNorm(qnorm)
 }
 
-func (s *TermSearcher) Next() (*DocumentMatch, error) {
+func (s *TermSearcher) Next(ctx context.Context) (*DocumentMatch, error) {
+	// every searcher ends up reading terms, so checking here
+	// is enough to stop any query
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
 	termMatch, err := s.reader.Next()
 	if err != nil {
 		return nil, err
@@ -55,14 +68,14 @@ func (s *TermSearcher) Next() (*DocumentMatch, error) {
 		return nil, nil
 	}
 
-	// score match
-	docMatch := s.scorer.Score(termMatch)
-	// return doc match
-	return docMatch, nil
-
+	return s.score(termMatch)
 }
 
-func (s *TermSearcher) Advance(ID string) (*DocumentMatch, error) {
+func (s *TermSearcher) Advance(ctx context.Context, ID string) (*DocumentMatch, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
 	termMatch, err := s.reader.Advance([]byte(ID))
 	if err != nil {
 		return nil, err
@@ -72,11 +85,33 @@ func (s *TermSearcher) Advance(ID string) (*DocumentMatch, error) {
 		return nil, nil
 	}
 
-	// score match
-	docMatch := s.scorer.Score(termMatch)
+	return s.score(termMatch)
+}
+
+// SetMinScore skips reading the field length of the matches which
+// could not score above minScore, they are scored at their bound
+func (s *TermSearcher) SetMinScore(minScore float64) {
+	s.minScore = minScore
+}
+
+func (s *TermSearcher) score(termMatch *index.TermFieldDoc) (*DocumentMatch, error) {
+	if s.minScore > 0 {
+		maxScore := s.scorer.MaxScore(termMatch.Freq)
+		if maxScore < s.minScore {
+			return &DocumentMatch{
+				ID:    termMatch.ID,
+				Score: maxScore,
+			}, nil
+		}
+	}
 
-	// return doc match
-	return docMatch, nil
+	fieldLength, err := s.index.FieldLength([]byte(termMatch.ID), s.query.Field)
+	if err != nil {
+		return nil, err
+	}
+
+	// score match
+	return s.scorer.Score(termMatch, fieldLength), nil
 }
 
 func (s *TermSearcher) Close() {
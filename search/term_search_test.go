@@ -9,6 +9,7 @@
 package search
 
 import (
+	"context"
 	"testing"
 
 	"github.com/couchbaselabs/cbfullofit/index"
@@ -66,10 +67,10 @@ func TestTermSearch(t *testing.T) {
 	}
 
 	for testIndex, test := range tests {
-		searcher, err := NewTermSearcher(test.index, test.query)
+		searcher, err := NewTermSearcher(test.index, DefaultSimilarity, test.query)
 		defer searcher.Close()
 
-		next, err := searcher.Next()
+		next, err := searcher.Next(context.Background())
 		i := 0
 		for err == nil && next != nil {
 			if i < len(test.results) {
@@ -81,7 +82,7 @@ func TestTermSearch(t *testing.T) {
 					t.Logf("explanation: %v", next.Expl)
 				}
 			}
-			next, err = searcher.Next()
+			next, err = searcher.Next(context.Background())
 			i++
 		}
 		if err != nil {
@@ -0,0 +1,75 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package search
+
+import (
+	"sort"
+
+	"github.com/couchbaselabs/cbfullofit/index"
+)
+
+// TermsFacetBuilder counts the terms of a field, keeping the size
+// most frequent ones
+type TermsFacetBuilder struct {
+	field      string
+	size       int
+	termsCount map[string]int
+	total      int
+	missing    int
+}
+
+func NewTermsFacetBuilder(field string, size int) *TermsFacetBuilder {
+	return &TermsFacetBuilder{
+		field:      field,
+		size:       size,
+		termsCount: make(map[string]int),
+	}
+}
+
+func (fb *TermsFacetBuilder) Update(fieldTerms index.FieldTerms) {
+	found := false
+	for _, term := range fieldTerms[fb.field] {
+		// single token analyzers index an empty term for a missing value
+		if term == "" {
+			continue
+		}
+		found = true
+		fb.termsCount[term]++
+		fb.total++
+	}
+	if !found {
+		fb.missing++
+	}
+}
+
+func (fb *TermsFacetBuilder) Result() *FacetResult {
+	terms := make(TermFacets, 0, len(fb.termsCount))
+	for term, count := range fb.termsCount {
+		terms = append(terms, &TermFacet{
+			Term:  term,
+			Count: count,
+		})
+	}
+	sort.Sort(terms)
+	if len(terms) > fb.size {
+		terms = terms[:fb.size]
+	}
+
+	rv := FacetResult{
+		Field:   fb.field,
+		Total:   fb.total,
+		Missing: fb.missing,
+		Other:   fb.total,
+		Terms:   terms,
+	}
+	for _, term := range terms {
+		rv.Other -= term.Count
+	}
+	return &rv
+}
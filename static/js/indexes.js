@@ -206,9 +206,26 @@ function IndexCtrl($scope, $http, $routeParams, $log) {
 		}
 	};
 
-	$scope.search = function() {
-		$http.get('/api/index/' + $scope.theindex.name + '/_searchTerm?q=' + $scope.term + '&f=' + $scope.field).
+	$scope.pageSize = 10;
+
+	$scope.search = function(from) {
+		delete $scope.results;
+		delete $scope.errorMessage;
+		from = from || 0;
+		var requestBody = {
+			"query": {
+				"query": $scope.term,
+				"default_field": $scope.field,
+				"boost": 1.0,
+				"explain": true
+			},
+			explain: true,
+			size: $scope.pageSize,
+			from: from
+		};
+		$http.post('/api/index/' + $scope.theindex.name + '/_search', requestBody).
 		success(function(data) {
+			$scope.from = from;
 			$scope.results = data;
 			for(var i in $scope.results.hits) {
 				hit = $scope.results.hits[i];
@@ -217,10 +234,18 @@ function IndexCtrl($scope, $http, $routeParams, $log) {
 			}
 		}).
 		error(function(data, code) {
-
+			$scope.errorMessage = data;
 		});
 	};
 
+	$scope.previousPage = function() {
+		$scope.search(Math.max($scope.from - $scope.pageSize, 0));
+	};
+
+	$scope.nextPage = function() {
+		$scope.search($scope.from + $scope.pageSize);
+	};
+
 	$scope.expl = function(explanation) {
 		rv = "" + $scope.roundScore(explanation.value) + " - " + explanation.message;
 		rv = rv + "<ul>";
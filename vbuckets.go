@@ -0,0 +1,292 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package main
+
+import (
+	"fmt"
+	"hash/crc32"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const NUM_VBUCKETS = 1024
+
+// vbucketOf hashes keys to vbuckets the way Couchbase does
+func vbucketOf(key string) uint16 {
+	return uint16(((crc32.ChecksumIEEE([]byte(key)) >> 16) & 0x7fff) % NUM_VBUCKETS)
+}
+
+// VBucketRange is the vbuckets from First to Last inclusive, the
+// partition of an index a node holds
+type VBucketRange struct {
+	First uint16
+	Last  uint16
+}
+
+// ParseVBucketRange reads a partition like 0-511, the empty
+// partition is the whole index and has no range
+func ParseVBucketRange(partition string) (*VBucketRange, error) {
+	if partition == "" {
+		return nil, nil
+	}
+	bounds := strings.Split(partition, "-")
+	if len(bounds) != 2 {
+		return nil, fmt.Errorf("partition '%s' is not a vbucket range like 0-511", partition)
+	}
+	first, err := strconv.ParseUint(bounds[0], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("partition '%s' has an invalid first vbucket: %v", partition, err)
+	}
+	last, err := strconv.ParseUint(bounds[1], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("partition '%s' has an invalid last vbucket: %v", partition, err)
+	}
+	if first > last || last >= NUM_VBUCKETS {
+		return nil, fmt.Errorf("partition '%s' must be a range within 0-%d", partition, NUM_VBUCKETS-1)
+	}
+	return &VBucketRange{
+		First: uint16(first),
+		Last:  uint16(last),
+	}, nil
+}
+
+func (r *VBucketRange) String() string {
+	return fmt.Sprintf("%d-%d", r.First, r.Last)
+}
+
+// VBuckets lists the vbuckets of the range
+func (r *VBucketRange) VBuckets() []uint16 {
+	rv := make([]uint16, 0, int(r.Last-r.First)+1)
+	for vb := int(r.First); vb <= int(r.Last); vb++ {
+		rv = append(rv, uint16(vb))
+	}
+	return rv
+}
+
+// VBucketRanges is the partition of an index a node holds, the
+// vbuckets of a node can be several ranges after a rebalance
+type VBucketRanges []*VBucketRange
+
+// ParseVBucketRanges reads a partition like 0-255,512-767, the empty
+// partition is the whole index and has no ranges
+func ParseVBucketRanges(partition string) (VBucketRanges, error) {
+	if partition == "" {
+		return nil, nil
+	}
+	rv := make(VBucketRanges, 0)
+	for _, part := range strings.Split(partition, ",") {
+		r, err := ParseVBucketRange(part)
+		if err != nil {
+			return nil, err
+		}
+		if r == nil {
+			return nil, fmt.Errorf("partition '%s' has an empty range", partition)
+		}
+		rv = append(rv, r)
+	}
+	return rv, nil
+}
+
+// vbucketRangesOf packs the vbuckets in as few ranges as possible,
+// the vbuckets must be sorted
+func vbucketRangesOf(vbuckets []uint16) VBucketRanges {
+	rv := make(VBucketRanges, 0)
+	for _, vb := range vbuckets {
+		if len(rv) > 0 && rv[len(rv)-1].Last+1 == vb {
+			rv[len(rv)-1].Last = vb
+			continue
+		}
+		rv = append(rv, &VBucketRange{First: vb, Last: vb})
+	}
+	return rv
+}
+
+func (rs VBucketRanges) String() string {
+	parts := make([]string, len(rs))
+	for i, r := range rs {
+		parts[i] = r.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// VBuckets lists the vbuckets of the ranges, all of them when there
+// are no ranges
+func (rs VBucketRanges) VBuckets() []uint16 {
+	if rs == nil {
+		return (&VBucketRange{First: 0, Last: NUM_VBUCKETS - 1}).VBuckets()
+	}
+	rv := make([]uint16, 0)
+	for _, r := range rs {
+		rv = append(rv, r.VBuckets()...)
+	}
+	return rv
+}
+
+// Contains is whether the vbucket is in one of the ranges, every
+// vbucket is when there are no ranges
+func (rs VBucketRanges) Contains(vbucket uint16) bool {
+	if rs == nil {
+		return true
+	}
+	for _, r := range rs {
+		if vbucket >= r.First && vbucket <= r.Last {
+			return true
+		}
+	}
+	return false
+}
+
+// planPartitions gives the nodes about as many vbuckets each while
+// moving as few of them as possible. partitions maps the nodes to the
+// partition they hold now, joining is a node holding nothing yet.
+// A single node holds the whole index.
+func planPartitions(partitions map[string]string, joining string) (map[string]string, error) {
+	nodes := make([]string, 0, len(partitions))
+	for node := range partitions {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	if len(nodes) > NUM_VBUCKETS {
+		return nil, fmt.Errorf("cannot split %d vbuckets across %d nodes", NUM_VBUCKETS, len(nodes))
+	}
+	rv := make(map[string]string, len(nodes))
+	if len(nodes) == 1 {
+		rv[nodes[0]] = ""
+		return rv, nil
+	}
+
+	// every vbucket stays with the first node holding it, vbuckets of
+	// overlapping partitions move off the other nodes
+	var owned [NUM_VBUCKETS]bool
+	held := make(map[string][]uint16, len(nodes))
+	for _, node := range nodes {
+		if node == joining {
+			continue
+		}
+		ranges, err := ParseVBucketRanges(partitions[node])
+		if err != nil {
+			log.Printf("node '%s' holds an invalid partition, moving it: %v", node, err)
+			continue
+		}
+		for _, vb := range ranges.VBuckets() {
+			if !owned[vb] {
+				owned[vb] = true
+				held[node] = append(held[node], vb)
+			}
+		}
+	}
+
+	// the nodes already holding the most keep the odd vbuckets
+	byHeld := make([]string, len(nodes))
+	copy(byHeld, nodes)
+	sort.Stable(nodesByHeld{byHeld, held})
+	targets := make(map[string]int, len(nodes))
+	for i, node := range byHeld {
+		targets[node] = NUM_VBUCKETS / len(nodes)
+		if i < NUM_VBUCKETS%len(nodes) {
+			targets[node]++
+		}
+	}
+
+	// nodes holding too many give up their last vbuckets, and the
+	// nodes holding too few pick up the ones nobody holds
+	for _, node := range nodes {
+		if extra := held[node]; len(extra) > targets[node] {
+			for _, vb := range extra[targets[node]:] {
+				owned[vb] = false
+			}
+			held[node] = extra[:targets[node]]
+		}
+	}
+	free := make([]uint16, 0)
+	for vb := 0; vb < NUM_VBUCKETS; vb++ {
+		if !owned[vb] {
+			free = append(free, uint16(vb))
+		}
+	}
+	for _, node := range nodes {
+		missing := targets[node] - len(held[node])
+		if missing <= 0 {
+			continue
+		}
+		held[node] = append(held[node], free[:missing]...)
+		free = free[missing:]
+		sort.Sort(vbucketList(held[node]))
+	}
+
+	for _, node := range nodes {
+		rv[node] = vbucketRangesOf(held[node]).String()
+	}
+	return rv, nil
+}
+
+// nodesByHeld sorts nodes by how many vbuckets they hold, most first
+type nodesByHeld struct {
+	nodes []string
+	held  map[string][]uint16
+}
+
+func (s nodesByHeld) Len() int      { return len(s.nodes) }
+func (s nodesByHeld) Swap(i, j int) { s.nodes[i], s.nodes[j] = s.nodes[j], s.nodes[i] }
+func (s nodesByHeld) Less(i, j int) bool {
+	return len(s.held[s.nodes[i]]) > len(s.held[s.nodes[j]])
+}
+
+type vbucketList []uint16
+
+func (l vbucketList) Len() int           { return len(l) }
+func (l vbucketList) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l vbucketList) Less(i, j int) bool { return l[i] < l[j] }
+
+// rebalanceIndex moves vbuckets between the nodes assigned to the
+// index until they hold about as many each, joining is a node just
+// assigned which holds nothing yet. Nodes pick up their new partition
+// the next time they look up their assignments, and drop the
+// documents of the vbuckets they no longer hold.
+func rebalanceIndex(indexName string, joining string) error {
+	assigned, err := partitionsAssignedToIndex(indexName)
+	if err != nil {
+		return err
+	}
+
+	partitions := make(map[string]string, len(assigned))
+	for _, assignment := range assigned {
+		partitions[assignment.Node] = assignment.Partition
+	}
+	planned, err := planPartitions(partitions, joining)
+	if err != nil {
+		return err
+	}
+
+	nodes := make([]string, 0, len(planned))
+	for node := range planned {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	for _, node := range nodes {
+		partition := planned[node]
+		if partitions[node] == partition {
+			continue
+		}
+		log.Printf("moving partition of index '%s' on node '%s' from '%s' to '%s'", indexName, node, partitions[node], partition)
+		assignment := Assignment{
+			Index:     indexName,
+			Node:      node,
+			Partition: partition,
+			Type:      "assignment",
+		}
+		err = db.Set("assignment_"+node+indexName, 0, assignment)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
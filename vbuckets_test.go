@@ -0,0 +1,130 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+package main
+
+import (
+	"testing"
+)
+
+func TestVBucketRanges(t *testing.T) {
+	ranges, err := ParseVBucketRanges("0-255,512-767")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ranges.VBuckets()) != 512 {
+		t.Errorf("expected 512 vbuckets, got %d", len(ranges.VBuckets()))
+	}
+	for vbucket, expected := range map[uint16]bool{0: true, 255: true, 256: false, 512: true, 768: false} {
+		if ranges.Contains(vbucket) != expected {
+			t.Errorf("expected vbucket %d contained: %t", vbucket, expected)
+		}
+	}
+	if vbucketRangesOf(ranges.VBuckets()).String() != "0-255,512-767" {
+		t.Errorf("expected ranges to pack back, got %s", vbucketRangesOf(ranges.VBuckets()))
+	}
+
+	ranges, err = ParseVBucketRanges("")
+	if err != nil || ranges != nil || len(ranges.VBuckets()) != NUM_VBUCKETS {
+		t.Errorf("expected the empty partition to be every vbucket, got %v, %v", ranges, err)
+	}
+	for _, partition := range []string{"0-511,", "0-1024", "5-1", "a-b"} {
+		_, err := ParseVBucketRanges(partition)
+		if err == nil {
+			t.Errorf("expected partition '%s' to be invalid", partition)
+		}
+	}
+}
+
+// ownersOf maps each vbucket to the node holding it, and fails unless
+// every vbucket is held once
+func ownersOf(t *testing.T, partitions map[string]string) map[uint16]string {
+	rv := make(map[uint16]string)
+	for node, partition := range partitions {
+		ranges, err := ParseVBucketRanges(partition)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, vbucket := range ranges.VBuckets() {
+			if owner, ok := rv[vbucket]; ok {
+				t.Fatalf("vbucket %d held by '%s' and '%s'", vbucket, owner, node)
+			}
+			rv[vbucket] = node
+		}
+	}
+	if len(rv) != NUM_VBUCKETS {
+		t.Fatalf("expected %d vbuckets held, got %d", NUM_VBUCKETS, len(rv))
+	}
+	return rv
+}
+
+func TestPlanPartitions(t *testing.T) {
+	tests := []struct {
+		name     string
+		current  map[string]string
+		joining  string
+		expected map[string]string
+		moved    int
+	}{
+		{
+			name:     "second node joins",
+			current:  map[string]string{"a": "", "b": ""},
+			joining:  "b",
+			expected: map[string]string{"a": "0-511", "b": "512-1023"},
+			moved:    512,
+		},
+		{
+			name:     "third node joins",
+			current:  map[string]string{"a": "0-511", "b": "512-1023", "c": ""},
+			joining:  "c",
+			expected: map[string]string{"a": "0-341", "b": "512-852", "c": "342-511,853-1023"},
+			moved:    341,
+		},
+		{
+			name:     "node leaves",
+			current:  map[string]string{"a": "0-341", "b": "512-852"},
+			expected: map[string]string{"a": "0-511", "b": "512-1023"},
+			moved:    341,
+		},
+		{
+			name:     "last node holds the whole index",
+			current:  map[string]string{"b": "512-1023"},
+			expected: map[string]string{"b": ""},
+			moved:    512,
+		},
+		{
+			name:     "overlapping partitions",
+			current:  map[string]string{"a": "0-767", "b": "256-1023"},
+			expected: map[string]string{"a": "0-511", "b": "512-1023"},
+			moved:    0,
+		},
+	}
+
+	for _, test := range tests {
+		planned, err := planPartitions(test.current, test.joining)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		for node, partition := range test.expected {
+			if planned[node] != partition {
+				t.Errorf("%s: expected node '%s' to hold '%s', got '%s'", test.name, node, partition, planned[node])
+			}
+		}
+		after := ownersOf(t, planned)
+		moved := 0
+		for vbucket, node := range after {
+			ranges, _ := ParseVBucketRanges(test.current[node])
+			if node == test.joining || !ranges.Contains(vbucket) {
+				moved++
+			}
+		}
+		if moved != test.moved {
+			t.Errorf("%s: expected %d vbuckets to move, got %d", test.name, test.moved, moved)
+		}
+	}
+}